@@ -0,0 +1,559 @@
+package discord
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var baseURL = "https://discord.com/api/v10/"
+
+const (
+	// Name of the webhooks the bot creates in channels to post alerts.
+	webhookName = "Lowstock"
+
+	flagEphemeral             = 1 << 6
+	flagSuppressNotifications = 1 << 12
+
+	componentActionRow = 1
+	componentButton    = 2
+
+	stylePrimary = 1
+	styleLink    = 5
+
+	channelDM      = 1
+	channelGroupDM = 3
+
+	// Discord message limits.
+	maxRows        = 5
+	maxButtons     = 5
+	maxCustomID    = 100
+	maxContent     = 2000
+	maxDescription = 4096
+	maxTitle       = 256
+
+	// Etsy orange.
+	embedColor = 0xF1641E
+
+	// Wait timeout of Updates, same as Telegram long polling.
+	timeout = 60 * time.Second
+	// Updates waiting for LowStock, interactions are rejected once it is full.
+	queueSize = 100
+)
+
+// Discord implements lowstock.Messenger with channel webhooks for messages and interactions for commands.
+// Channel and user snowflakes are used as chat and user IDs.
+type Discord struct {
+	token     string
+	publicKey ed25519.PublicKey
+
+	mu       sync.Mutex
+	webhooks map[int64]Webhook
+	// Direct message channels, the bot posts to them itself.
+	dms map[int64]bool
+	// Interactions waiting for a reply, by update.
+	pending map[int64]pendingResponse
+	// Update LowStock is handling, Updates returns them one at a time.
+	handling int64
+	lastID   int64
+
+	updates chan lowstock.MessengerUpdate
+	limiter *limiter
+
+	now     func() time.Time
+	timeout time.Duration
+}
+
+// New creates a Discord messenger with the bot token and the hex encoded public key of the application.
+func New(token, publicKey string) (*Discord, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("bad public key %q", publicKey)
+	}
+
+	return &Discord{
+		token:     token,
+		publicKey: ed25519.PublicKey(key),
+		webhooks:  map[int64]Webhook{},
+		dms:       map[int64]bool{},
+		pending:   map[int64]pendingResponse{},
+		updates:   make(chan lowstock.MessengerUpdate, queueSize),
+		limiter:   newLimiter(),
+		now:       time.Now,
+		timeout:   timeout,
+	}, nil
+}
+
+type Channel struct {
+	ID   string `json:"id"`
+	Type int    `json:"type"`
+}
+
+type Webhook struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+}
+
+type Component struct {
+	Type       int         `json:"type"`
+	Style      int         `json:"style,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	CustomID   string      `json:"custom_id,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	Components []Component `json:"components,omitempty"`
+}
+
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// WebhookMessage is sent to webhooks and interactions. Slices are never nil, edits clear what is empty.
+type WebhookMessage struct {
+	Content         string          `json:"content"`
+	Embeds          []Embed         `json:"embeds"`
+	Components      []Component     `json:"components"`
+	Flags           int             `json:"flags,omitempty"`
+	AllowedMentions AllowedMentions `json:"allowed_mentions"`
+}
+
+type ErrorResponse struct {
+	Message    string  `json:"message"`
+	Code       int     `json:"code"`
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+var (
+	linkTag = regexp.MustCompile(`<a href="([^"]*)">(.*?)</a>`)
+
+	htmlTags = strings.NewReplacer(
+		"<b>", "**", "</b>", "**",
+		"<i>", "*", "</i>", "*",
+		"<code>", "`", "</code>", "`",
+		"<pre>", "```\n", "</pre>", "\n```",
+	)
+)
+
+// markdown converts the HTML subset of lowstock messages to Discord markdown.
+func markdown(text string) string {
+	text = linkTag.ReplaceAllString(text, "[$2]($1)")
+	return html.UnescapeString(htmlTags.Replace(text))
+}
+
+// truncate cuts text to max characters.
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:max-1]) + "…"
+}
+
+func toComponents(rows [][]lowstock.Button) []Component {
+	components := []Component{}
+
+	for _, row := range rows {
+		if len(components) == maxRows {
+			break
+		}
+
+		actions := Component{Type: componentActionRow}
+		for _, b := range row {
+			if len(actions.Components) == maxButtons {
+				break
+			}
+
+			button := Component{Type: componentButton, Label: b.Text}
+			switch {
+			case b.URL != "":
+				button.Style, button.URL = styleLink, b.URL
+			case b.Data != "" && len(b.Data) <= maxCustomID:
+				button.Style, button.CustomID = stylePrimary, b.Data
+			default:
+				continue
+			}
+			actions.Components = append(actions.Components, button)
+		}
+
+		if len(actions.Components) > 0 {
+			components = append(components, actions)
+		}
+	}
+
+	return components
+}
+
+// toWebhookMessage renders alerts as embeds with the title, SKUs and shop of the listing, other messages as text.
+func toWebhookMessage(m lowstock.Message) WebhookMessage {
+	msg := WebhookMessage{
+		Embeds:          []Embed{},
+		Components:      toComponents(m.Buttons),
+		AllowedMentions: AllowedMentions{Parse: []string{}},
+	}
+
+	if m.Silent {
+		msg.Flags |= flagSuppressNotifications
+	}
+
+	if m.Alert == nil {
+		msg.Content = truncate(markdown(m.Text), maxContent)
+		return msg
+	}
+
+	a := m.Alert
+	embed := Embed{
+		Title:       truncate(a.Title, maxTitle),
+		URL:         a.ListingURL,
+		Description: truncate(markdown(m.Text), maxDescription),
+		Color:       embedColor,
+		Timestamp:   a.Time.Format(time.RFC3339),
+	}
+
+	if len(a.SKUs) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "SKU", Value: strings.Join(a.SKUs, ", "), Inline: true})
+	}
+	if a.ShopName != "" {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "Shop", Value: a.ShopName, Inline: true})
+	}
+	msg.Embeds = append(msg.Embeds, embed)
+
+	return msg
+}
+
+func apiCall(name string, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`discord_api_calls{status=%q, method=%q}`, status, name)).Inc()
+}
+
+// do calls the API at path and decodes the response into v.
+// Requests to the route wait for its rate limit, 429 responses are returned as lowstock.RetryAfterError.
+func (d *Discord) do(name, method, route, path string, request, v interface{}) (err error) {
+	defer func() { apiCall(name, err) }()
+
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to serialize request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bot "+d.token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	d.limiter.wait(route)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	d.limiter.update(route, resp.Header)
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		err := fmt.Errorf("failed to call %s, status: %s, body: %s", name, resp.Status, string(respBody))
+
+		var errResp ErrorResponse
+		if resp.StatusCode == http.StatusTooManyRequests && json.Unmarshal(respBody, &errResp) == nil && errResp.RetryAfter > 0 {
+			retryAfter := time.Duration(errResp.RetryAfter * float64(time.Second))
+			d.limiter.retryAfter(route, retryAfter, errResp.Global)
+
+			return &lowstock.RetryAfterError{RetryAfter: retryAfter, Err: err}
+		}
+
+		// Bad requests and missing permissions fail again on retries.
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: %s", lowstock.ErrUndeliverable, err)
+		}
+
+		return err
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(respBody, v); err != nil {
+			return fmt.Errorf("failed to unmarshal %s response: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// webhook returns the webhook of the bot in the channel, it is created when missing.
+func (d *Discord) webhook(chatID int64) (Webhook, error) {
+	d.mu.Lock()
+	w, ok := d.webhooks[chatID]
+	d.mu.Unlock()
+
+	if ok {
+		return w, nil
+	}
+
+	route := "channels/" + strconv.FormatInt(chatID, 10)
+
+	var hooks []Webhook
+	if err := d.do("getChannelWebhooks", http.MethodGet, route, route+"/webhooks", nil, &hooks); err != nil {
+		return Webhook{}, err
+	}
+
+	found := false
+	for _, h := range hooks {
+		if h.Name == webhookName && h.Token != "" {
+			w, found = h, true
+			break
+		}
+	}
+
+	if !found {
+		if err := d.do("createWebhook", http.MethodPost, route, route+"/webhooks", Webhook{Name: webhookName}, &w); err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	d.mu.Lock()
+	d.webhooks[chatID] = w
+	d.mu.Unlock()
+
+	return w, nil
+}
+
+// isDM reports whether the channel is a direct message channel.
+// Channels not seen in interactions are looked up, e.g. after a restart.
+func (d *Discord) isDM(chatID int64, lookup bool) bool {
+	d.mu.Lock()
+	dm := d.dms[chatID]
+	d.mu.Unlock()
+
+	if dm || !lookup {
+		return dm
+	}
+
+	route := "channels/" + strconv.FormatInt(chatID, 10)
+
+	var ch Channel
+	if err := d.do("getChannel", http.MethodGet, route, route, nil, &ch); err != nil {
+		return false
+	}
+
+	if ch.Type != channelDM && ch.Type != channelGroupDM {
+		return false
+	}
+
+	d.mu.Lock()
+	d.dms[chatID] = true
+	d.mu.Unlock()
+
+	return true
+}
+
+// sendDM posts the message to a direct message channel with the bot token.
+func (d *Discord) sendDM(msg WebhookMessage, chatID int64) error {
+	route := "channels/" + strconv.FormatInt(chatID, 10)
+	return d.do("createMessage", http.MethodPost, route, route+"/messages", msg, nil)
+}
+
+// forgetWebhook makes the next message look the webhook up again, it may have been deleted.
+func (d *Discord) forgetWebhook(chatID int64) {
+	d.mu.Lock()
+	delete(d.webhooks, chatID)
+	d.mu.Unlock()
+}
+
+// SendTextMessage to the channel with provided ID, LowStock sends text messages in reply to commands only.
+func (d *Discord) SendTextMessage(text string, chatID int64) error {
+	return d.SendMessage(lowstock.Message{Text: text, Reply: true}, chatID)
+}
+
+// SendMessage to the channel. Replies to a command complete its interaction, other messages,
+// e.g. alerts and digests, are posted with the channel webhook, or by the bot in direct messages.
+func (d *Discord) SendMessage(m lowstock.Message, chatID int64) error {
+	msg := toWebhookMessage(m)
+
+	if m.Reply {
+		if p, ok := d.reply(chatID); ok {
+			return d.sendReply(p, msg)
+		}
+	}
+
+	if d.isDM(chatID, false) {
+		return d.sendDM(msg, chatID)
+	}
+
+	w, err := d.webhook(chatID)
+	if err != nil {
+		// Direct messages have no webhooks.
+		if d.isDM(chatID, true) {
+			return d.sendDM(msg, chatID)
+		}
+
+		return fmt.Errorf("failed to get webhook of channel %d: %w", chatID, err)
+	}
+
+	route := "webhooks/" + w.ID
+	if err := d.do("executeWebhook", http.MethodPost, route, route+"/"+w.Token+"?wait=true", msg, nil); err != nil {
+		d.forgetWebhook(chatID)
+		return err
+	}
+
+	return nil
+}
+
+// EditMessage replaces text and buttons of a message sent by the bot.
+func (d *Discord) EditMessage(m lowstock.Message, chatID, messageID int64) error {
+	msg := toWebhookMessage(m)
+	msg.Flags = 0
+
+	d.mu.Lock()
+	p, ok := d.handled(chatID)
+	d.mu.Unlock()
+
+	// Messages with pressed buttons are edited through the interaction, it works in direct messages as well.
+	if ok && p.messageID == messageID {
+		route := "webhooks/" + p.appID + "/" + p.token
+		return d.do("editInteractionResponse", http.MethodPatch, route, route+"/messages/@original", msg, nil)
+	}
+
+	if d.isDM(chatID, false) {
+		route := "channels/" + strconv.FormatInt(chatID, 10)
+		return d.do("editMessage", http.MethodPatch, route, fmt.Sprintf("%s/messages/%d", route, messageID), msg, nil)
+	}
+
+	w, err := d.webhook(chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook of channel %d: %w", chatID, err)
+	}
+
+	route := "webhooks/" + w.ID
+	path := fmt.Sprintf("%s/%s/messages/%d", route, w.Token, messageID)
+
+	return d.do("editWebhookMessage", http.MethodPatch, route, path, msg, nil)
+}
+
+// AnswerCallback does nothing, button presses are acknowledged by Handler.
+func (d *Discord) AnswerCallback(callbackID string) error {
+	return nil
+}
+
+// SendLoginURL sends the text with a login button.
+func (d *Discord) SendLoginURL(text, uri string, chatID int64) error {
+	msg := lowstock.Message{
+		Text:    text,
+		Buttons: [][]lowstock.Button{[]lowstock.Button{lowstock.Button{Text: "Login to Etsy", URL: uri}}},
+		Reply:   true,
+	}
+
+	return d.SendMessage(msg, chatID)
+}
+
+// IsChatAdmin reports whether the member may manage the channel, Discord sends their permissions with the interaction.
+// Only the member of the update LowStock is handling is known.
+func (d *Discord) IsChatAdmin(chatID, userID int64) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.handled(chatID)
+	if !ok || p.userID != userID {
+		return false, fmt.Errorf("no interaction of member %d in channel %d", userID, chatID)
+	}
+
+	return p.admin, nil
+}
+
+// Updates returns the next command or button press received by Handler, lastMsgID is the next ID LowStock expects.
+// It waits for one as long as Telegram long polling does.
+// Updates come one at a time, so replies sent until the next call answer the interaction of the returned update.
+func (d *Discord) Updates(lastMsgID int64) ([]lowstock.MessengerUpdate, error) {
+	d.forgetReplies(lastMsgID)
+
+	select {
+	case upd := <-d.updates:
+		d.mu.Lock()
+		d.handling = upd.ID
+		d.mu.Unlock()
+
+		return []lowstock.MessengerUpdate{upd}, nil
+	case <-time.After(d.timeout):
+		return nil, nil
+	}
+}
+
+type Option struct {
+	Type        int    `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type Command struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Options     []Option `json:"options,omitempty"`
+}
+
+const optionString = 3
+
+var commands = []Command{
+	Command{Name: "start", Description: "Link your Etsy shop"},
+	Command{
+		Name:        "pin",
+		Description: "Finish linking with the code from Etsy",
+		Options:     []Option{Option{Type: optionString, Name: "code", Description: "Verification code", Required: true}},
+	},
+	Command{Name: "help", Description: "List available commands"},
+}
+
+// RegisterCommands makes /start, /pin and /help available in every server of the application.
+func (d *Discord) RegisterCommands(appID string) error {
+	route := "applications/" + appID
+	return d.do("bulkOverwriteCommands", http.MethodPut, route, route+"/commands", commands, nil)
+}
@@ -0,0 +1,237 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ lowstock.Messenger = (*Discord)(nil)
+
+// testDiscord returns a Discord messenger with a fresh key pair and a limiter that does not sleep.
+func testDiscord(t *testing.T) (*Discord, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+
+	d, err := New("bot-token", hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	d.limiter.sleep = func(time.Duration) {}
+
+	return d, priv
+}
+
+func TestNewBadKey(t *testing.T) {
+	if _, err := New("bot-token", "c0ffee"); err == nil {
+		t.Error("Expected an error for a short key")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	text := `<b>Sold out</b> <a href="https://www.etsy.com/listing/42">Mug &amp; cup</a>` + "\n<i>SKU</i> <code>m-1</code> &#39;x&#39;"
+	expected := "**Sold out** [Mug & cup](https://www.etsy.com/listing/42)\n*SKU* `m-1` 'x'"
+
+	if got := markdown(text); got != expected {
+		t.Errorf("Got: %q, expected: %q", got, expected)
+	}
+}
+
+func TestToWebhookMessage(t *testing.T) {
+	alert := lowstock.AlertData{
+		Update:     lowstock.Update{Title: "Mug", ShopName: "MugShop", ListingID: 42},
+		Kind:       "sold_out",
+		SKUs:       []string{"m-1", "m-2"},
+		ListingURL: "https://www.etsy.com/listing/42",
+		Time:       time.Unix(1590000000, 0).UTC(),
+	}
+
+	msg := lowstock.Message{
+		Text: "<b>Sold out</b>",
+		Buttons: [][]lowstock.Button{
+			[]lowstock.Button{
+				lowstock.Button{Text: "Open", URL: "https://www.etsy.com/listing/42"},
+				lowstock.Button{Text: "Snooze", Data: "/mute 42 24h #7"},
+			},
+		},
+		Silent: true,
+		Alert:  &alert,
+	}
+
+	expected := WebhookMessage{
+		Embeds: []Embed{
+			Embed{
+				Title:       "Mug",
+				URL:         "https://www.etsy.com/listing/42",
+				Description: "**Sold out**",
+				Color:       embedColor,
+				Fields: []EmbedField{
+					EmbedField{Name: "SKU", Value: "m-1, m-2", Inline: true},
+					EmbedField{Name: "Shop", Value: "MugShop", Inline: true},
+				},
+				Timestamp: "2020-05-20T18:40:00Z",
+			},
+		},
+		Components: []Component{
+			Component{Type: componentActionRow, Components: []Component{
+				Component{Type: componentButton, Style: styleLink, Label: "Open", URL: "https://www.etsy.com/listing/42"},
+				Component{Type: componentButton, Style: stylePrimary, Label: "Snooze", CustomID: "/mute 42 24h #7"},
+			}},
+		},
+		Flags:           flagSuppressNotifications,
+		AllowedMentions: AllowedMentions{Parse: []string{}},
+	}
+
+	if diff := cmp.Diff(expected, toWebhookMessage(msg)); diff != "" {
+		t.Errorf("Message mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	var calls []string
+	var got WebhookMessage
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+
+		if auth := r.Header.Get("Authorization"); auth != "Bot bot-token" {
+			t.Errorf("Unexpected Authorization: %q", auth)
+		}
+
+		switch r.URL.Path {
+		case "/api/channels/100/webhooks":
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `[{"id":"1","name":"Other","token":"t1"}]`)
+				return
+			}
+			fmt.Fprint(w, `{"id":"2","name":"Lowstock","token":"t2"}`)
+		case "/api/webhooks/2/t2":
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode request: %s", err)
+			}
+			fmt.Fprint(w, `{"id":"500"}`)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = ts.URL + "/api/"
+
+	d, _ := testDiscord(t)
+
+	for i := 0; i < 2; i++ {
+		if err := d.SendTextMessage("<b>Hi</b>", 100); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	expectedCalls := []string{
+		"GET /api/channels/100/webhooks",
+		"POST /api/channels/100/webhooks",
+		"POST /api/webhooks/2/t2?wait=true",
+		"POST /api/webhooks/2/t2?wait=true",
+	}
+
+	if diff := cmp.Diff(expectedCalls, calls); diff != "" {
+		t.Errorf("Calls mismatch (-want +got):\n%s", diff)
+	}
+
+	if got.Content != "**Hi**" {
+		t.Errorf("Got content: %q, expected: %q", got.Content, "**Hi**")
+	}
+}
+
+func TestSendMessageDM(t *testing.T) {
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/api/channels/200/webhooks":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"message":"Cannot execute action on a DM channel","code":50003}`)
+		case "/api/channels/200":
+			fmt.Fprint(w, `{"id":"200","type":1}`)
+		case "/api/channels/200/messages", "/api/channels/200/messages/500":
+			fmt.Fprint(w, `{"id":"500"}`)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = ts.URL + "/api/"
+
+	d, _ := testDiscord(t)
+	alert := lowstock.Message{Text: "Sold out", Alert: &lowstock.AlertData{}}
+
+	// The channel is looked up once, later alerts go straight to it.
+	for i := 0; i < 2; i++ {
+		if err := d.SendMessage(alert, 200); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	if err := d.EditMessage(alert, 200, 500); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expectedCalls := []string{
+		"GET /api/channels/200/webhooks",
+		"GET /api/channels/200",
+		"POST /api/channels/200/messages",
+		"POST /api/channels/200/messages",
+		"PATCH /api/channels/200/messages/500",
+	}
+
+	if diff := cmp.Diff(expectedCalls, calls); diff != "" {
+		t.Errorf("Calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSendMessageRateLimited(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message":"You are being rate limited.","retry_after":1.5,"global":false}`)
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = ts.URL + "/api/"
+
+	d, _ := testDiscord(t)
+	d.webhooks[100] = Webhook{ID: "2", Token: "t2"}
+
+	err := d.SendTextMessage("hi", 100)
+
+	var retryErr *lowstock.RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter != 1500*time.Millisecond {
+		t.Fatalf("Got error: %v, expected retry after 1.5s", err)
+	}
+
+	if d := d.limiter.delay("webhooks/2"); d <= 0 {
+		t.Error("Expected the webhook to be held back")
+	}
+
+	if _, ok := d.webhooks[100]; ok {
+		t.Error("Expected the webhook to be looked up again")
+	}
+}
@@ -0,0 +1,361 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	signatureHeader = "X-Signature-Ed25519"
+	timestampHeader = "X-Signature-Timestamp"
+
+	// Requests signed earlier are rejected as replays.
+	maxRequestAge = 5 * time.Minute
+	// Interactions are larger only when something is wrong.
+	maxRequestSize = 1 << 20
+
+	// Interaction tokens are valid this long.
+	interactionTTL = 15 * time.Minute
+
+	interactionPing      = 1
+	interactionCommand   = 2
+	interactionComponent = 3
+
+	responsePong           = 1
+	responseDeferred       = 5
+	responseDeferredUpdate = 6
+
+	// Permissions that make a member a chat admin.
+	permAdministrator  = 1 << 3
+	permManageChannels = 1 << 4
+	permManageGuild    = 1 << 5
+)
+
+// Replies to these commands are seen only by the member who used them, login links are personal.
+var privateCommands = map[string]bool{
+	"/start": true,
+	"/pin":   true,
+}
+
+var (
+	acceptedCounter = metrics.NewCounter(`discord_interactions_total{status="accepted"}`)
+	rejectedCounter = metrics.NewCounter(`discord_interactions_total{status="rejected"}`)
+)
+
+// pendingResponse is an interaction that was acknowledged by Handler and waits for LowStock to reply.
+type pendingResponse struct {
+	updateID int64
+	chatID   int64
+	userID   int64
+	// Whether the member may manage the channel, from permissions of the interaction.
+	admin   bool
+	appID   string
+	token   string
+	command string
+	// Message with the pressed button, zero for commands.
+	messageID int64
+	answered  bool
+	expires   time.Time
+}
+
+// handled returns the interaction of the update LowStock is handling, when it came from the chat.
+// Other commands of the chat wait for their turn, their replies must not answer this one.
+func (d *Discord) handled(chatID int64) (pendingResponse, bool) {
+	p, ok := d.pending[d.handling]
+	if !ok || p.chatID != chatID || !d.now().Before(p.expires) {
+		return pendingResponse{}, false
+	}
+
+	return p, true
+}
+
+// reply returns the interaction that a message to the chat answers.
+func (d *Discord) reply(chatID int64) (pendingResponse, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.handled(chatID)
+	if !ok {
+		return pendingResponse{}, false
+	}
+
+	// The next reply is a follow-up.
+	answered := p
+	answered.answered = true
+	d.pending[p.updateID] = answered
+
+	return p, true
+}
+
+// sendReply completes a deferred command response, later replies and replies to buttons are follow-ups.
+func (d *Discord) sendReply(p pendingResponse, msg WebhookMessage) error {
+	route := "webhooks/" + p.appID + "/" + p.token
+
+	if p.messageID == 0 && !p.answered {
+		msg.Flags = 0
+		return d.do("editInteractionResponse", http.MethodPatch, route, route+"/messages/@original", msg, nil)
+	}
+
+	if privateCommands[p.command] {
+		msg.Flags |= flagEphemeral
+	}
+
+	return d.do("createFollowupMessage", http.MethodPost, route, route, msg, nil)
+}
+
+// forgetReplies drops interactions of updates before lastMsgID, LowStock is done with them.
+func (d *Discord) forgetReplies(lastMsgID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id := range d.pending {
+		if id < lastMsgID {
+			delete(d.pending, id)
+		}
+	}
+}
+
+type User struct {
+	ID string `json:"id"`
+}
+
+type Interaction struct {
+	ID            string `json:"id"`
+	ApplicationID string `json:"application_id"`
+	Type          int    `json:"type"`
+	Token         string `json:"token"`
+	GuildID       string `json:"guild_id"`
+	ChannelID     string `json:"channel_id"`
+	Locale        string `json:"locale"`
+
+	// Member is set in servers and User in direct messages.
+	Member *struct {
+		User        User   `json:"user"`
+		Permissions string `json:"permissions"`
+	} `json:"member"`
+	User *User `json:"user"`
+
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Value interface{} `json:"value"`
+		} `json:"options"`
+		CustomID string `json:"custom_id"`
+	} `json:"data"`
+
+	Message *struct {
+		ID string `json:"id"`
+	} `json:"message"`
+}
+
+type InteractionResponse struct {
+	Type int                      `json:"type"`
+	Data *InteractionResponseData `json:"data,omitempty"`
+}
+
+type InteractionResponseData struct {
+	Flags int `json:"flags"`
+}
+
+// verify checks the Ed25519 signature Discord puts on every interaction.
+func (d *Discord) verify(header http.Header, body []byte) error {
+	ts := header.Get(timestampHeader)
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("bad request timestamp")
+	}
+
+	if age := d.now().Sub(time.Unix(sec, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("request is too old")
+	}
+
+	sig, err := hex.DecodeString(header.Get(signatureHeader))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("bad request signature")
+	}
+
+	if !ed25519.Verify(d.publicKey, append([]byte(ts), body...), sig) {
+		return errors.New("bad request signature")
+	}
+
+	return nil
+}
+
+func snowflake(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad snowflake %q: %w", id, err)
+	}
+
+	return n, nil
+}
+
+// toMessengerUpdate reads a command or a button press, ok is false for interactions that carry no command.
+func toMessengerUpdate(i Interaction) (lowstock.MessengerUpdate, bool, error) {
+	var upd lowstock.MessengerUpdate
+
+	switch i.Type {
+	case interactionCommand:
+		args := []string{"/" + i.Data.Name}
+		for _, o := range i.Data.Options {
+			args = append(args, fmt.Sprint(o.Value))
+		}
+		upd.Text = strings.Join(args, " ")
+	case interactionComponent:
+		if !strings.HasPrefix(i.Data.CustomID, "/") || i.Message == nil {
+			return upd, false, nil
+		}
+
+		messageID, err := snowflake(i.Message.ID)
+		if err != nil {
+			return upd, false, err
+		}
+
+		upd.Text, upd.CallbackID, upd.MessageID = i.Data.CustomID, i.ID, messageID
+	default:
+		return upd, false, fmt.Errorf("unsupported interaction type %d", i.Type)
+	}
+
+	upd.Command = strings.Fields(upd.Text)[0]
+	upd.LanguageCode = i.Locale
+
+	user := i.User
+	upd.ChatType = "private"
+	if i.Member != nil {
+		user = &i.Member.User
+		upd.ChatType = "group"
+	}
+
+	if user == nil {
+		return upd, false, errors.New("interaction without user")
+	}
+
+	var err error
+	if upd.ChatID, err = snowflake(i.ChannelID); err != nil {
+		return upd, false, err
+	}
+
+	if upd.UserID, err = snowflake(user.ID); err != nil {
+		return upd, false, err
+	}
+
+	return upd, true, nil
+}
+
+func respond(w http.ResponseWriter, resp InteractionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		rejectedCounter.Inc()
+	}
+}
+
+// Handler accepts interactions signed by Discord and queues commands for Updates.
+// Interactions are acknowledged right away with a deferred response, LowStock replies complete it.
+func (d *Discord) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rejectedCounter.Inc()
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		// Discord checks that requests with bad signatures get 401.
+		if err := d.verify(r.Header, body); err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var i Interaction
+		if err := json.Unmarshal(body, &i); err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, "failed to parse interaction", http.StatusBadRequest)
+			return
+		}
+
+		if i.Type == interactionPing {
+			respond(w, InteractionResponse{Type: responsePong})
+			return
+		}
+
+		upd, ok, err := toMessengerUpdate(i)
+		if err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !ok {
+			respond(w, InteractionResponse{Type: responseDeferredUpdate})
+			return
+		}
+
+		admin := false
+		if i.Member != nil {
+			perms, _ := strconv.ParseUint(i.Member.Permissions, 10, 64)
+			admin = perms&(permAdministrator|permManageChannels|permManageGuild) != 0
+		}
+
+		d.mu.Lock()
+		d.lastID++
+		upd.ID = d.lastID
+
+		d.pending[upd.ID] = pendingResponse{
+			updateID:  upd.ID,
+			chatID:    upd.ChatID,
+			userID:    upd.UserID,
+			admin:     admin,
+			appID:     i.ApplicationID,
+			token:     i.Token,
+			command:   upd.Command,
+			messageID: upd.MessageID,
+			expires:   d.now().Add(interactionTTL),
+		}
+
+		// Interactions outside of servers come from direct messages, they have no webhooks.
+		if i.GuildID == "" {
+			d.dms[upd.ChatID] = true
+		}
+		d.mu.Unlock()
+
+		select {
+		case d.updates <- upd:
+			acceptedCounter.Inc()
+		default:
+			rejectedCounter.Inc()
+			http.Error(w, "too many requests", http.StatusServiceUnavailable)
+			return
+		}
+
+		if upd.MessageID != 0 {
+			respond(w, InteractionResponse{Type: responseDeferredUpdate})
+			return
+		}
+
+		resp := InteractionResponse{Type: responseDeferred, Data: &InteractionResponseData{}}
+		if privateCommands[upd.Command] {
+			resp.Data.Flags = flagEphemeral
+		}
+		respond(w, resp)
+	})
+}
@@ -0,0 +1,221 @@
+package discord
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	pinCommand  = `{"id":"9","application_id":"77","type":2,"token":"itoken","guild_id":"1","channel_id":"100","locale":"de","member":{"user":{"id":"7"},"permissions":"32"},"data":{"name":"pin","options":[{"name":"code","value":"1234"}]}}`
+	helpCommand = `{"id":"11","application_id":"77","type":2,"token":"itoken2","guild_id":"1","channel_id":"100","member":{"user":{"id":"8"},"permissions":"0"},"data":{"name":"help"}}`
+	startInDM   = `{"id":"9","application_id":"77","type":2,"token":"itoken","channel_id":"200","user":{"id":"7"},"data":{"name":"start"}}`
+	buttonPress = `{"id":"10","application_id":"77","type":3,"token":"itoken","guild_id":"1","channel_id":"100","member":{"user":{"id":"8"},"permissions":"0"},"data":{"custom_id":"/restocked 42 #7"},"message":{"id":"500"}}`
+)
+
+func signedRequest(priv ed25519.PrivateKey, ts time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+
+	req := httptest.NewRequest(http.MethodPost, "/discord", bytes.NewBufferString(body))
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, hex.EncodeToString(ed25519.Sign(priv, []byte(timestamp+body))))
+
+	return req
+}
+
+func TestHandler(t *testing.T) {
+	now := time.Unix(1590000000, 0)
+
+	tests := []struct {
+		name     string
+		body     string
+		ts       time.Time
+		forged   bool
+		status   int
+		response InteractionResponse
+		expected []lowstock.MessengerUpdate
+	}{
+		{
+			name:     "ping",
+			body:     `{"type":1}`,
+			ts:       now,
+			status:   http.StatusOK,
+			response: InteractionResponse{Type: responsePong},
+		},
+		{
+			name:     "command",
+			body:     pinCommand,
+			ts:       now,
+			status:   http.StatusOK,
+			response: InteractionResponse{Type: responseDeferred, Data: &InteractionResponseData{Flags: flagEphemeral}},
+			expected: []lowstock.MessengerUpdate{
+				lowstock.MessengerUpdate{ID: 1, Command: "/pin", Text: "/pin 1234", ChatID: 100, UserID: 7, ChatType: "group", LanguageCode: "de"},
+			},
+		},
+		{
+			name:     "direct message",
+			body:     startInDM,
+			ts:       now,
+			status:   http.StatusOK,
+			response: InteractionResponse{Type: responseDeferred, Data: &InteractionResponseData{Flags: flagEphemeral}},
+			expected: []lowstock.MessengerUpdate{
+				lowstock.MessengerUpdate{ID: 1, Command: "/start", Text: "/start", ChatID: 200, UserID: 7, ChatType: "private"},
+			},
+		},
+		{
+			name:     "button",
+			body:     buttonPress,
+			ts:       now,
+			status:   http.StatusOK,
+			response: InteractionResponse{Type: responseDeferredUpdate},
+			expected: []lowstock.MessengerUpdate{
+				lowstock.MessengerUpdate{ID: 1, Command: "/restocked", Text: "/restocked 42 #7", ChatID: 100, UserID: 8, ChatType: "group", CallbackID: "10", MessageID: 500},
+			},
+		},
+		{
+			name:   "forged",
+			body:   pinCommand,
+			ts:     now,
+			forged: true,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "replay",
+			body:   pinCommand,
+			ts:     now.Add(-10 * time.Minute),
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, priv := testDiscord(t)
+			d.now = func() time.Time { return now }
+			d.timeout = time.Millisecond
+
+			if test.forged {
+				_, priv, _ = ed25519.GenerateKey(nil)
+			}
+
+			rec := httptest.NewRecorder()
+			d.Handler().ServeHTTP(rec, signedRequest(priv, test.ts, test.body))
+
+			if rec.Code != test.status {
+				t.Fatalf("Got status: %d, expected: %d, body: %s", rec.Code, test.status, rec.Body)
+			}
+
+			if test.status == http.StatusOK {
+				var resp InteractionResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %s", err)
+				}
+
+				if diff := cmp.Diff(test.response, resp); diff != "" {
+					t.Errorf("Response mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			updates, err := d.Updates(0)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expected, updates); diff != "" {
+				t.Errorf("Updates mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReplies(t *testing.T) {
+	var calls []string
+	var flags []int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		var msg WebhookMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatalf("Failed to decode request: %s", err)
+		}
+		flags = append(flags, msg.Flags)
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = ts.URL + "/api/"
+
+	d, priv := testDiscord(t)
+	d.timeout = time.Millisecond
+	d.Handler().ServeHTTP(httptest.NewRecorder(), signedRequest(priv, time.Now(), pinCommand))
+	// The next command in the same channel comes before LowStock replies to the first one.
+	d.Handler().ServeHTTP(httptest.NewRecorder(), signedRequest(priv, time.Now(), helpCommand))
+
+	if updates, _ := d.Updates(0); len(updates) != 1 || updates[0].Command != "/pin" {
+		t.Fatalf("Unexpected updates: %+v", updates)
+	}
+
+	// Permissions come with the interaction being handled.
+	if isAdmin, err := d.IsChatAdmin(100, 7); err != nil || !isAdmin {
+		t.Errorf("Member with Manage Server permission is expected to be an admin, got: %t, %v", isAdmin, err)
+	}
+
+	if _, err := d.IsChatAdmin(100, 8); err == nil {
+		t.Error("Expected an error for a member of another interaction")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.SendTextMessage("Linked", 100); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	if updates, _ := d.Updates(2); len(updates) != 1 || updates[0].Command != "/help" {
+		t.Fatalf("Unexpected updates: %+v", updates)
+	}
+
+	if isAdmin, err := d.IsChatAdmin(100, 8); err != nil || isAdmin {
+		t.Errorf("Member without permissions is expected not to be an admin, got: %t, %v", isAdmin, err)
+	}
+
+	// Queued messages, e.g. digests, do not answer the command.
+	d.webhooks[100] = Webhook{ID: "5", Name: webhookName, Token: "wtoken"}
+	if err := d.SendMessage(lowstock.Message{Text: "Digest"}, 100); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := d.SendTextMessage("Help", 100); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expectedCalls := []string{
+		"PATCH /api/webhooks/77/itoken/messages/@original",
+		"POST /api/webhooks/77/itoken",
+		"POST /api/webhooks/5/wtoken",
+		"PATCH /api/webhooks/77/itoken2/messages/@original",
+	}
+
+	if diff := cmp.Diff(expectedCalls, calls); diff != "" {
+		t.Errorf("Calls mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]int{0, flagEphemeral, 0, 0}, flags); diff != "" {
+		t.Errorf("Flags mismatch (-want +got):\n%s", diff)
+	}
+
+	// Once LowStock is done with the update, messages go to the channel webhook again.
+	d.Updates(3)
+	if _, ok := d.reply(100); ok {
+		t.Error("Expected no pending reply")
+	}
+}
@@ -0,0 +1,107 @@
+package discord
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	remainingHeader  = "X-RateLimit-Remaining"
+	resetAfterHeader = "X-RateLimit-Reset-After"
+
+	// Route of the global limit.
+	globalRoute = ""
+)
+
+var (
+	throttledCounter  = metrics.NewCounter(`discord_throttled_requests_total{reason="limit"}`)
+	retryAfterCounter = metrics.NewCounter(`discord_throttled_requests_total{reason="retry_after"}`)
+)
+
+// limiter follows rate limits Discord reports in response headers.
+// Limits are per route, e.g. a webhook or an interaction, once one is exhausted requests wait for its reset.
+type limiter struct {
+	mu sync.Mutex
+
+	// Reset time of exhausted routes.
+	resets map[string]time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		resets: map[string]time.Time{},
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// delay returns how long requests to the route have to wait.
+func (l *limiter) delay(route string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	var wait time.Duration
+	for _, r := range []string{globalRoute, route} {
+		if reset, ok := l.resets[r]; ok {
+			if d := reset.Sub(now); d > wait {
+				wait = d
+			} else if d <= 0 {
+				delete(l.resets, r)
+			}
+		}
+	}
+
+	return wait
+}
+
+// wait blocks until a request to the route can be made.
+func (l *limiter) wait(route string) {
+	if d := l.delay(route); d > 0 {
+		throttledCounter.Inc()
+		l.sleep(d)
+	}
+}
+
+func (l *limiter) block(route string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	reset := l.now().Add(d)
+	if reset.After(l.resets[route]) {
+		l.resets[route] = reset
+	}
+}
+
+// update holds the route back until its reset once no requests remain.
+func (l *limiter) update(route string, header http.Header) {
+	if header.Get(remainingHeader) != "0" {
+		return
+	}
+
+	resetAfter, err := strconv.ParseFloat(header.Get(resetAfterHeader), 64)
+	if err != nil || resetAfter <= 0 {
+		return
+	}
+
+	l.block(route, time.Duration(resetAfter*float64(time.Second)))
+}
+
+// retryAfter holds the route, or every route when the global limit is hit, back for d.
+func (l *limiter) retryAfter(route string, d time.Duration, global bool) {
+	retryAfterCounter.Inc()
+
+	if global {
+		route = globalRoute
+	}
+
+	l.block(route, d)
+}
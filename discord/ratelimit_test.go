@@ -0,0 +1,75 @@
+package discord
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeLimiter returns a limiter with a clock that moves only when it sleeps.
+func fakeLimiter() (*limiter, *time.Duration) {
+	start := time.Unix(1590000000, 0)
+	var slept time.Duration
+
+	l := newLimiter()
+	l.now = func() time.Time { return start.Add(slept) }
+	l.sleep = func(d time.Duration) { slept += d }
+
+	return l, &slept
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	l, slept := fakeLimiter()
+
+	header := http.Header{}
+	header.Set(remainingHeader, "1")
+	header.Set(resetAfterHeader, "2.5")
+
+	l.update("webhooks/1", header)
+	l.wait("webhooks/1")
+	if *slept != 0 {
+		t.Errorf("Got wait: %s with requests remaining, expected none", *slept)
+	}
+
+	header.Set(remainingHeader, "0")
+	l.update("webhooks/1", header)
+
+	l.wait("webhooks/2")
+	if *slept != 0 {
+		t.Errorf("Got wait: %s for another route, expected none", *slept)
+	}
+
+	l.wait("webhooks/1")
+	if *slept != 2500*time.Millisecond {
+		t.Errorf("Got wait: %s, expected: 2.5s", *slept)
+	}
+
+	l.wait("webhooks/1")
+	if *slept != 2500*time.Millisecond {
+		t.Errorf("Got wait: %s after the reset, expected none", *slept-2500*time.Millisecond)
+	}
+}
+
+func TestLimiterRetryAfter(t *testing.T) {
+	l, slept := fakeLimiter()
+
+	l.retryAfter("webhooks/1", 7*time.Second, false)
+
+	l.wait("webhooks/2")
+	if *slept != 0 {
+		t.Errorf("Got wait: %s for another route, expected none", *slept)
+	}
+
+	l.wait("webhooks/1")
+	if *slept != 7*time.Second {
+		t.Errorf("Got wait: %s, expected: 7s", *slept)
+	}
+
+	// The global limit holds every route back.
+	l.retryAfter("webhooks/1", 3*time.Second, true)
+
+	l.wait("webhooks/2")
+	if *slept != 10*time.Second {
+		t.Errorf("Got wait: %s, expected: 10s", *slept)
+	}
+}
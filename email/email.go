@@ -0,0 +1,282 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// SecurityStartTLS upgrades a plain connection, usually on port 587. Servers without STARTTLS are refused.
+	SecurityStartTLS = "starttls"
+	// SecurityTLS connects with TLS right away, usually on port 465.
+	SecurityTLS = "tls"
+
+	AuthPlain = "plain"
+	AuthLogin = "login"
+
+	// Limit for a whole SMTP session.
+	timeout = 30 * time.Second
+)
+
+var (
+	sendSuccessCounter = metrics.NewCounter(`smtp_sends_total{status="success"}`)
+	sendFailureCounter = metrics.NewCounter(`smtp_sends_total{status="failure"}`)
+)
+
+type Config struct {
+	Host string
+	Port int
+
+	// Security is SecurityStartTLS or SecurityTLS, empty is SecurityStartTLS.
+	Security string
+	// Auth is AuthPlain or AuthLogin, empty is AuthPlain. No authentication without Username.
+	Auth     string
+	Username string
+	Password string
+
+	// From is the sender address, e.g. "Lowstock <lowstock@example.com>".
+	From string
+}
+
+// SMTP implements lowstock.Mailer, a connection is made for every email.
+type SMTP struct {
+	cfg  Config
+	from *mail.Address
+
+	tlsConfig *tls.Config
+	now       func() time.Time
+}
+
+func New(cfg Config) (*SMTP, error) {
+	if cfg.Security == "" {
+		cfg.Security = SecurityStartTLS
+	}
+	if cfg.Auth == "" {
+		cfg.Auth = AuthPlain
+	}
+
+	if cfg.Security != SecurityStartTLS && cfg.Security != SecurityTLS {
+		return nil, fmt.Errorf("unsupported security %q", cfg.Security)
+	}
+
+	if cfg.Auth != AuthPlain && cfg.Auth != AuthLogin {
+		return nil, fmt.Errorf("unsupported auth %q", cfg.Auth)
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("bad sender address %q: %w", cfg.From, err)
+	}
+
+	return &SMTP{
+		cfg:       cfg,
+		from:      from,
+		tlsConfig: &tls.Config{ServerName: cfg.Host},
+		now:       time.Now,
+	}, nil
+}
+
+// loginAuth is the LOGIN mechanism, net/smtp has PLAIN only. Like PLAIN, it is refused without TLS.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(string(fromServer))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %q", fromServer)
+	}
+}
+
+func (s *SMTP) auth() smtp.Auth {
+	if s.cfg.Auth == AuthLogin {
+		return &loginAuth{username: s.cfg.Username, password: s.cfg.Password, host: s.cfg.Host}
+	}
+
+	return smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+}
+
+func (s *SMTP) dial() (net.Conn, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	if s.cfg.Security == SecurityTLS {
+		return tls.DialWithDialer(dialer, "tcp", addr, s.tlsConfig)
+	}
+
+	return dialer.Dial("tcp", addr)
+}
+
+// SendMail delivers the mail with text and HTML alternatives.
+func (s *SMTP) SendMail(to string, m lowstock.Mail) error {
+	if err := s.sendMail(to, m); err != nil {
+		sendFailureCounter.Inc()
+		return err
+	}
+
+	sendSuccessCounter.Inc()
+
+	return nil
+}
+
+func (s *SMTP) sendMail(to string, m lowstock.Mail) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("bad recipient address %q: %w", to, err)
+	}
+
+	msg, err := message(s.from, rcpt, m, s.now())
+	if err != nil {
+		return fmt.Errorf("failed to compose email: %w", err)
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.cfg.Host, err)
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if s.cfg.Security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		if err := c.Auth(s.auth()); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+
+	if err := c.Rcpt(rcpt.Address); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start data: %w", err)
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return c.Quit()
+}
+
+func writePart(mw *multipart.Writer, contentType, body string) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := io.WriteString(qp, body); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+// message composes a multipart/alternative email, the HTML part goes last as the preferred one.
+func message(from, to *mail.Address, m lowstock.Mail, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+	if err := writePart(mw, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if err := writePart(mw, "text/html", m.HTML); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(m.Subject)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%d.%x@%s>\r\n", now.UnixNano(), id, domain)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,253 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+)
+
+var _ lowstock.Mailer = (*SMTP)(nil)
+
+// session is what the fake SMTP server received.
+type session struct {
+	tls      bool
+	commands []string
+	data     string
+}
+
+// serveSMTP answers a single SMTP session, enough for net/smtp.
+func serveSMTP(t *testing.T, l net.Listener, cert tls.Certificate, startTLS bool, done chan<- session) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Errorf("Failed to accept: %s", err)
+		close(done)
+		return
+	}
+	defer conn.Close()
+
+	var s session
+	_, s.tls = conn.(*tls.Conn)
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			w.WriteString(line + "\r\n")
+		}
+		w.Flush()
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.commands = append(s.commands, line)
+
+		cmd := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch {
+		case cmd == "EHLO" && startTLS && !s.tls:
+			reply("250-localhost", "250 STARTTLS")
+		case cmd == "EHLO":
+			reply("250-localhost", "250 AUTH PLAIN LOGIN")
+		case cmd == "STARTTLS":
+			reply("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			r, w = bufio.NewReader(tlsConn), bufio.NewWriter(tlsConn)
+			s.tls = true
+		case strings.HasPrefix(line, "AUTH LOGIN"):
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+			user, _ := r.ReadString('\n')
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+			pass, _ := r.ReadString('\n')
+			s.commands = append(s.commands, strings.TrimSpace(user), strings.TrimSpace(pass))
+			reply("235 Authenticated")
+		case cmd == "AUTH":
+			reply("235 Authenticated")
+		case cmd == "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 Queued")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			done <- s
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+
+	done <- s
+}
+
+func testServer(t *testing.T, security string) (*SMTP, net.Listener, tls.Certificate) {
+	ts := httptest.NewTLSServer(nil)
+	cert := ts.TLS.Certificates[0]
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	ts.Close()
+
+	var l net.Listener
+	var err error
+	if security == SecurityTLS {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	s, err := New(Config{
+		Host:     "127.0.0.1",
+		Port:     p,
+		Security: security,
+		Auth:     map[string]string{SecurityTLS: AuthLogin, SecurityStartTLS: AuthPlain}[security],
+		Username: "bot",
+		Password: "s3cret",
+		From:     "Lowstock <lowstock@example.com>",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	s.tlsConfig.RootCAs = pool
+
+	return s, l, cert
+}
+
+func TestSendMail(t *testing.T) {
+	mailMsg := lowstock.Mail{Subject: "Sold out: Mug", Text: "Sold out: Mug\n", HTML: "<b>Sold out:</b> Mug"}
+
+	for _, security := range []string{SecurityStartTLS, SecurityTLS} {
+		t.Run(security, func(t *testing.T) {
+			s, l, cert := testServer(t, security)
+			defer l.Close()
+
+			done := make(chan session, 1)
+			go serveSMTP(t, l, cert, security == SecurityStartTLS, done)
+
+			if err := s.SendMail("books@example.com", mailMsg); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			var got session
+			select {
+			case got = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("SMTP session did not finish")
+			}
+
+			if !got.tls {
+				t.Error("Email was sent without TLS")
+			}
+
+			commands := strings.Join(got.commands, "\n")
+			for _, expected := range []string{"MAIL FROM:<lowstock@example.com>", "RCPT TO:<books@example.com>"} {
+				if !strings.Contains(commands, expected) {
+					t.Errorf("Missing %q in commands:\n%s", expected, commands)
+				}
+			}
+
+			auth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00bot\x00s3cret"))
+			if security == SecurityTLS {
+				auth = "AUTH LOGIN\n" + base64.StdEncoding.EncodeToString([]byte("bot")) + "\n" + base64.StdEncoding.EncodeToString([]byte("s3cret"))
+			}
+			if !strings.Contains(commands, auth) {
+				t.Errorf("Missing %q in commands:\n%s", auth, commands)
+			}
+
+			if !strings.Contains(got.data, "Subject: Sold out: Mug\r\n") {
+				t.Errorf("Missing subject in:\n%s", got.data)
+			}
+		})
+	}
+}
+
+func TestStartTLSRequired(t *testing.T) {
+	s, l, cert := testServer(t, SecurityStartTLS)
+	defer l.Close()
+
+	done := make(chan session, 1)
+	go serveSMTP(t, l, cert, false, done)
+
+	if err := s.SendMail("books@example.com", lowstock.Mail{Subject: "Hi"}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Got error: %v, expected STARTTLS to be required", err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	from := &mail.Address{Name: "Lowstock", Address: "lowstock@example.com"}
+	to := &mail.Address{Address: "books@example.com"}
+	m := lowstock.Mail{Subject: "Ausverkauft: Tasse", Text: "Ausverkauft: Tasse\n", HTML: "<b>Ausverkauft:</b> Tasse"}
+
+	data, err := message(from, to, m, time.Unix(1590000000, 0).UTC())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse email: %s", err)
+	}
+
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != m.Subject {
+		t.Errorf("Got subject: %q, expected: %q", subject, m.Subject)
+	}
+
+	if date := msg.Header.Get("Date"); date != "Wed, 20 May 2020 18:40:00 +0000" {
+		t.Errorf("Unexpected date: %q", date)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Unexpected content type: %q", msg.Header.Get("Content-Type"))
+	}
+
+	expected := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for _, e := range expected {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("Failed to read part: %s", err)
+		}
+
+		if ct := part.Header.Get("Content-Type"); ct != e.contentType {
+			t.Errorf("Got content type: %q, expected: %q", ct, e.contentType)
+		}
+
+		// The reader decodes quoted-printable parts.
+		body, _ := ioutil.ReadAll(part)
+		if got := strings.Replace(string(body), "\r\n", "\n", -1); got != e.body {
+			t.Errorf("Got body: %q, expected: %q", got, e.body)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -23,6 +24,9 @@ var (
 
 	feedListingsCounter    = metrics.NewCounter(`etsy_feeds_listings_total`)
 	multipageUpdateCounter = metrics.NewCounter(`etsy_feeds_multipage_updates`)
+	feedPagesCounter       = metrics.NewCounter(`etsy_feeds_pages_total`)
+	pageCapCounter         = metrics.NewCounter(`etsy_feeds_page_cap_reached_total`)
+	feedPagesHistogram     = metrics.NewHistogram(`etsy_feeds_pages_per_poll`)
 
 	apiSuccessCounter = metrics.NewCounter(`etsy_open_api_calls{status="success"}`)
 	apiFailureCounter = metrics.NewCounter(`etsy_open_api_calls{status="failure"}`)
@@ -36,6 +40,7 @@ type Etsy interface {
 
 type EtsyClient struct {
 	liveFeedsKey string
+	maxFeedPages int
 	etsy         Etsy
 }
 
@@ -43,9 +48,19 @@ func NewClient(e Etsy, key string) *EtsyClient {
 	return &EtsyClient{
 		etsy:         e,
 		liveFeedsKey: key,
+		maxFeedPages: defaultMaxFeedPages,
 	}
 }
 
+// SetMaxFeedPages limits the number of feed pages fetched per Updates call.
+func (e *EtsyClient) SetMaxFeedPages(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	e.maxFeedPages = n
+}
+
 func (e *EtsyClient) Login(ctx context.Context, userID int64) (string, lowstock.TokenDetails, error) {
 	loginURL, details, err := e.etsy.Login(ctx)
 	if err != nil {
@@ -184,13 +199,13 @@ func toLowstockUpdates(listings []listingInfo) []lowstock.Update {
 }
 
 var (
-	limitInt  = 100
-	limit     = strconv.Itoa(limitInt)
-	offset    = "0"
-	timeLimit = "10"
+	feedsURL = "https://api.etsy.com/v2/feeds/listings/latest"
 
-	// TODO: use value from DB.
-	lastUpdateTSZ = strconv.FormatInt(time.Now().Unix(), 10)
+	limitInt = 100
+	limit    = strconv.Itoa(limitInt)
+	offset   = "0"
+
+	defaultMaxFeedPages = 50
 )
 
 func (e *EtsyClient) ListingSKUs(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
@@ -229,51 +244,214 @@ func (e *EtsyClient) ListingSKUs(ctx context.Context, id int64, accessToken, acc
 	return listingsResp.Results[0].SKU, nil
 }
 
-func (e *EtsyClient) Updates(ctx context.Context) ([]lowstock.Update, error) {
-	timeOffset := lastUpdateTSZ
+var (
+	openAPIURL = "https://openapi.etsy.com/v2"
+)
 
-	params := url.Values{}
-	params.Set("api_key", e.liveFeedsKey)
-	params.Set("limit", limit)
-	params.Set("offset", offset)
-	params.Set("time_limit", timeLimit)
-	params.Set("time_offset", timeOffset)
+type shopInfo struct {
+	ID   int64  `json:"shop_id"`
+	Name string `json:"shop_name"`
+}
 
-	resp, err := http.DefaultClient.Get("https://api.etsy.com/v2/feeds/listings/latest?" + params.Encode())
+type shopsResponse struct {
+	Count   int        `json:"count"`
+	Results []shopInfo `json:"results"`
+	Type    string     `json:"type"`
+}
+
+func toLowstockListing(l listingInfo) lowstock.Listing {
+	return lowstock.Listing{
+		ID:       l.ListingID,
+		Title:    l.Title,
+		State:    l.State,
+		Quantity: l.Quantity,
+		SKUs:     l.SKU,
+	}
+}
+
+// openAPIGet calls Etsy Open API on behalf of the user and decodes the response into v.
+func openAPIGet(ctx context.Context, httpClient *http.Client, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		apiFailureCounter.Inc()
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiFailureCounter.Inc()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		return fmt.Errorf("bad response: %s, body: %s", resp.Status, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		apiFailureCounter.Inc()
+		return err
+	}
+
+	apiSuccessCounter.Inc()
+
+	return nil
+}
+
+// ShopListings returns active and inactive listings of the shop that belongs to the token owner.
+// Sold-out listings are not active, Etsy returns them among inactive ones.
+func (e *EtsyClient) ShopListings(ctx context.Context, accessToken, accessSecret string) ([]lowstock.Listing, error) {
+	httpClient := e.HTTPClient(accessToken, accessSecret)
+
+	var shops shopsResponse
+	if err := openAPIGet(ctx, httpClient, openAPIURL+"/users/__SELF__/shops", &shops); err != nil {
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+
+	if len(shops.Results) == 0 {
+		return nil, lowstock.ErrNotFound
+	}
+
+	var listings []lowstock.Listing
+
+	for _, state := range []string{"active", "inactive"} {
+		params := url.Values{}
+		params.Set("limit", limit)
+		params.Set("offset", offset)
+
+		// All pages are read, a partial list would show listings of a large shop as missing.
+		for next := 0; ; {
+			uri := fmt.Sprintf("%s/shops/%d/listings/%s?%s", openAPIURL, shops.Results[0].ID, state, params.Encode())
+
+			var lResp listingsResponse
+			if err := openAPIGet(ctx, httpClient, uri, &lResp); err != nil {
+				return nil, fmt.Errorf("failed to get %s listings: %w", state, err)
+			}
+
+			for _, l := range lResp.Results {
+				listings = append(listings, toLowstockListing(l))
+			}
+
+			if lResp.Pagination.NextOffset == 0 {
+				break
+			}
+
+			if lResp.Pagination.NextOffset <= next {
+				return nil, fmt.Errorf("failed to get %s listings: next offset %d does not move past %d", state, lResp.Pagination.NextOffset, next)
+			}
+			next = lResp.Pagination.NextOffset
+			params.Set("offset", strconv.Itoa(next))
+		}
+	}
+
+	return listings, nil
+}
+
+// feedTimeLimit converts time window to the feed time_limit value, it is set in minutes.
+func feedTimeLimit(d time.Duration) string {
+	minutes := int64(math.Ceil(d.Minutes()))
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	return strconv.FormatInt(minutes, 10)
+}
+
+func (e *EtsyClient) feedPage(ctx context.Context, params url.Values) (listingsResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedsURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return listingsResponse{}, fmt.Errorf("failed to create feeds request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		feedFailureCounter.Inc()
-		return nil, fmt.Errorf("failed to perform call to Etsy feeds: %w", err)
+		return listingsResponse{}, fmt.Errorf("failed to perform call to Etsy feeds: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		feedFailureCounter.Inc()
 
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+			return listingsResponse{}, fmt.Errorf("failed to read response body: %w", err)
 		}
 
-		return nil, fmt.Errorf("bad response: %s, body: %s", resp.Status, string(body))
+		return listingsResponse{}, fmt.Errorf("bad response: %s, body: %s", resp.Status, string(body))
 	}
 
 	var lResp = listingsResponse{}
 
 	if err := json.NewDecoder(resp.Body).Decode(&lResp); err != nil {
 		feedFailureCounter.Inc()
-		return nil, fmt.Errorf("failed to decode feeds response: %w", err)
+		return listingsResponse{}, fmt.Errorf("failed to decode feeds response: %w", err)
 	}
 
-	feedListingsCounter.Add(lResp.Count)
+	feedSuccessCounter.Inc()
+
+	return lResp, nil
+}
 
-	if lResp.Count > limitInt {
-		multipageUpdateCounter.Inc()
-	}
+// Updates returns listings updated within timeLimit starting at timeOffset.
+// Feed pages are followed until the window is exhausted.
+// Once the page cap is reached, fetched updates are returned with lowstock.ErrFeedTruncated.
+func (e *EtsyClient) Updates(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]lowstock.Update, error) {
+	params := url.Values{}
+	params.Set("api_key", e.liveFeedsKey)
+	params.Set("limit", limit)
+	params.Set("offset", offset)
+	params.Set("time_limit", feedTimeLimit(timeLimit))
+	params.Set("time_offset", strconv.FormatInt(timeOffset, 10))
 
-	updates := toLowstockUpdates(lResp.Results)
-	// TODO: update in DB
-	lastUpdateTSZ = strconv.FormatInt(time.Now().Unix(), 10)
+	var (
+		updates []lowstock.Update
+		pages   int
+	)
 
-	feedSuccessCounter.Inc()
+	for {
+		lResp, err := e.feedPage(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		pages++
+		feedPagesCounter.Inc()
+		feedListingsCounter.Add(len(lResp.Results))
+
+		updates = append(updates, toLowstockUpdates(lResp.Results)...)
+
+		next := lResp.Pagination
+		if next.NextOffset == 0 && next.NextPage == 0 {
+			break
+		}
+
+		if pages >= e.maxFeedPages {
+			pageCapCounter.Inc()
+			feedPagesHistogram.Update(float64(pages))
+
+			return updates, fmt.Errorf("%w: page cap (%d) reached, %d of %d listings fetched",
+				lowstock.ErrFeedTruncated, e.maxFeedPages, len(updates), lResp.Count)
+		}
+
+		if next.NextOffset != 0 {
+			params.Set("offset", strconv.Itoa(next.NextOffset))
+		} else {
+			params.Del("offset")
+			params.Set("page", strconv.Itoa(next.NextPage))
+		}
+	}
+
+	if pages > 1 {
+		multipageUpdateCounter.Inc()
+	}
+	feedPagesHistogram.Update(float64(pages))
 
 	return updates, nil
 }
@@ -1,11 +1,18 @@
 package etsy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/cooldarkdryplace/lowstock"
 
+	oauth "github.com/cooldarkdryplace/oauth1/etsy"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -71,3 +78,174 @@ func TestToUpdates(t *testing.T) {
 		t.Errorf("Updates do not match:\n%s", diff)
 	}
 }
+
+func TestFeedTimeLimit(t *testing.T) {
+	tests := []struct {
+		window   time.Duration
+		expected string
+	}{
+		{window: 0, expected: "1"},
+		{window: 20 * time.Second, expected: "1"},
+		{window: 10 * time.Minute, expected: "10"},
+		{window: 10*time.Minute + time.Second, expected: "11"},
+	}
+
+	for _, tt := range tests {
+		if actual := feedTimeLimit(tt.window); actual != tt.expected {
+			t.Errorf("Got time limit: %s for %s, expected: %s", actual, tt.window, tt.expected)
+		}
+	}
+}
+
+func feedServer(t *testing.T, total int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		off, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			t.Errorf("Bad offset: %s", err)
+		}
+
+		resp := listingsResponse{Count: total}
+		for i := off; i < total && i < off+limitInt; i++ {
+			resp.Results = append(resp.Results, listingInfo{ListingID: int64(i)})
+		}
+
+		if off+limitInt < total {
+			resp.Pagination.NextOffset = off + limitInt
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("Failed to encode response: %s", err)
+		}
+	}))
+}
+
+func TestUpdatesFollowsPagination(t *testing.T) {
+	srv := feedServer(t, 250)
+	defer srv.Close()
+
+	defer func(u string) { feedsURL = u }(feedsURL)
+	feedsURL = srv.URL
+
+	client := NewClient(nil, "test_key")
+
+	updates, err := client.Updates(context.Background(), time.Now().Unix(), time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(updates) != 250 {
+		t.Fatalf("Got %d updates, expected: 250", len(updates))
+	}
+
+	for i, upd := range updates {
+		if upd.ListingID != int64(i) {
+			t.Fatalf("Got listing ID: %d at position %d", upd.ListingID, i)
+		}
+	}
+}
+
+func TestSetMaxFeedPages(t *testing.T) {
+	client := NewClient(nil, "test_key")
+	if client.maxFeedPages != defaultMaxFeedPages {
+		t.Errorf("Got max feed pages: %d, expected: %d", client.maxFeedPages, defaultMaxFeedPages)
+	}
+
+	client.SetMaxFeedPages(0)
+	if client.maxFeedPages != 1 {
+		t.Errorf("Got max feed pages: %d, expected: 1", client.maxFeedPages)
+	}
+}
+
+func TestUpdatesStopsAtPageCap(t *testing.T) {
+	srv := feedServer(t, 1000)
+	defer srv.Close()
+
+	defer func(u string) { feedsURL = u }(feedsURL)
+	feedsURL = srv.URL
+
+	client := NewClient(nil, "test_key")
+	client.SetMaxFeedPages(2)
+
+	updates, err := client.Updates(context.Background(), time.Now().Unix(), time.Minute)
+	if !errors.Is(err, lowstock.ErrFeedTruncated) {
+		t.Fatalf("Got error: %v, expected: %s", err, lowstock.ErrFeedTruncated)
+	}
+
+	if len(updates) != 2*limitInt {
+		t.Errorf("Got %d updates, expected: %d", len(updates), 2*limitInt)
+	}
+}
+
+type etsyMock struct{}
+
+func (etsyMock) Login(ctx context.Context) (string, oauth.TokenDetails, error) {
+	return "", oauth.TokenDetails{}, nil
+}
+
+func (etsyMock) Callback(ctx context.Context, pin, token, secret string) (oauth.TokenDetails, error) {
+	return oauth.TokenDetails{}, nil
+}
+
+func (etsyMock) HTTPClient(token, secret string) *http.Client {
+	return http.DefaultClient
+}
+
+func TestShopListings(t *testing.T) {
+	activeCount := 30*limitInt + 50
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+
+		switch r.URL.Path {
+		case "/users/__SELF__/shops":
+			resp = shopsResponse{Count: 1, Results: []shopInfo{shopInfo{ID: 77, Name: "TestShop"}}}
+		case "/shops/77/listings/active":
+			off, err := strconv.Atoi(r.URL.Query().Get("offset"))
+			if err != nil {
+				t.Errorf("Bad offset: %s", err)
+			}
+
+			// More pages than a shop with a few thousand listings would have.
+			lResp := listingsResponse{Count: activeCount}
+			for i := off; i < activeCount && i < off+limitInt; i++ {
+				lResp.Results = append(lResp.Results, listingInfo{ListingID: int64(i), State: "active"})
+			}
+			if off+limitInt < activeCount {
+				lResp.Pagination.NextOffset = off + limitInt
+			}
+			resp = lResp
+		case "/shops/77/listings/inactive":
+			resp = listingsResponse{Count: 1, Results: []listingInfo{
+				listingInfo{ListingID: 500, State: "sold_out", Title: "Mug", SKU: []string{"MUG-1"}},
+			}}
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("Failed to encode response: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(u string) { openAPIURL = u }(openAPIURL)
+	openAPIURL = srv.URL
+
+	client := NewClient(etsyMock{}, "test_key")
+
+	listings, err := client.ShopListings(context.Background(), "token", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(listings) != activeCount+1 {
+		t.Fatalf("Got %d listings, expected: %d", len(listings), activeCount+1)
+	}
+
+	expected := lowstock.Listing{ID: 500, State: "sold_out", Title: "Mug", SKUs: []string{"MUG-1"}}
+	if diff := cmp.Diff(expected, listings[activeCount]); diff != "" {
+		t.Errorf("Listings do not match:\n%s", diff)
+	}
+}
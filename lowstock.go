@@ -15,6 +15,14 @@ import (
 
 const fallbackTimeout = 20 * time.Second
 
+// Updates of listings that share a lock are handled one at a time.
+const listingLocks = 64
+
+// Feed entries of the same listing change are ignored for this long.
+var dedupeTTL = 48 * time.Hour
+
+var duplicateUpdatesCounter = metrics.NewCounter(`etsy_updates_duplicates_total`)
+
 const (
 	active      = "active"
 	soldOut     = "sold_out"
@@ -27,8 +35,17 @@ const (
 )
 
 var (
-	ErrNotFound = errors.New("not found")
-	ErrEmptyPin = errors.New("empty pin")
+	ErrNotFound     = errors.New("not found")
+	ErrEmptyPin     = errors.New("empty pin")
+	ErrBadArguments = errors.New("bad command arguments")
+	ErrForbidden    = errors.New("command is not allowed")
+
+	// ErrFeedTruncated is returned with the updates read before the feed page cap was reached.
+	ErrFeedTruncated = errors.New("feed is truncated")
+
+	// ErrUndeliverable is returned by a Messenger when the message fails the same way on every attempt,
+	// e.g. the bot was blocked or the message is malformed. The outbox does not retry such messages.
+	ErrUndeliverable = errors.New("message cannot be delivered")
 )
 
 type TokenDetails struct {
@@ -37,12 +54,41 @@ type TokenDetails struct {
 	TokenSecret string
 }
 
+// User is a linked Etsy shop, settings of the shop are shared by all subscribed chats.
 type User struct {
 	EtsyUserID  int64
-	ChatUserID  int64
-	ChatID      int64
+	ShopName    string
 	Token       string
 	TokenSecret string
+
+	// Active listings with quantity at or below Threshold trigger a low stock alert.
+	// Zero disables low stock alerts, sold-out alerts are always sent.
+	Threshold int64
+
+	// Opt-in alerts on listing state transitions.
+	NotifyRestocked bool
+	NotifyExpired   bool
+	NotifyRemoved   bool
+
+	// Template for alerts, see AlertData for available fields. Empty uses built-in templates.
+	Template string
+
+	// Verified address alerts are emailed to, empty turns email alerts off.
+	Email string
+	// Chat the address was verified in, emails follow its language, quiet hours and snooze.
+	EmailChatID int64
+}
+
+// ListingState is the last known state of a listing that belongs to a registered user.
+type ListingState struct {
+	ListingID  int64
+	EtsyUserID int64
+	State      string
+	Quantity   int64
+	Title      string
+
+	// LowStock is set once a low stock alert is sent and reset when quantity rises above the threshold.
+	LowStock bool
 }
 
 type Etsy interface {
@@ -50,14 +96,62 @@ type Etsy interface {
 	Login(ctx context.Context, id int64) (string, TokenDetails, error)
 	ListingSKUs(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error)
 	UserID(accessToken, accessSecret string) (int64, error)
-	Updates(ctx context.Context) ([]Update, error)
+	Updates(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error)
+	ShopListings(ctx context.Context, accessToken, accessSecret string) ([]Listing, error)
 }
 
 type Storage interface {
 	SaveUser(ctx context.Context, user User) error
 	User(ctx context.Context, etsyUserID int64) (User, error)
+	DeleteUser(ctx context.Context, etsyUserID int64) error
+	Subscriptions(ctx context.Context, etsyUserID int64) ([]Subscription, error)
+	ChatSubscriptions(ctx context.Context, chatID int64) ([]Subscription, error)
+	AllSubscriptions(ctx context.Context) ([]Subscription, error)
+	SaveSubscription(ctx context.Context, sub Subscription) error
+	DeleteSubscription(ctx context.Context, sub Subscription) error
 	TokenDetails(ctx context.Context, id int64) (TokenDetails, error)
 	SaveTokenDetails(ctx context.Context, td TokenDetails) error
+	DeleteTokenDetails(ctx context.Context, id int64) error
+	FeedCursor(ctx context.Context) (int64, error)
+	SaveFeedCursor(ctx context.Context, tsz int64) error
+	SyncToken(ctx context.Context, messenger string) (string, error)
+	SaveSyncToken(ctx context.Context, messenger, token string) error
+	ListingState(ctx context.Context, listingID int64) (ListingState, error)
+	ListingStates(ctx context.Context, etsyUserID int64) ([]ListingState, error)
+	SaveListingState(ctx context.Context, state ListingState) error
+	Watches(ctx context.Context, etsyUserID int64) ([]Watch, error)
+	SaveWatch(ctx context.Context, watch Watch) error
+	DeleteWatch(ctx context.Context, watch Watch) error
+	Mutes(ctx context.Context, etsyUserID int64) ([]Mute, error)
+	SaveMute(ctx context.Context, mute Mute) error
+	DeleteMute(ctx context.Context, mute Mute) error
+	EmailVerification(ctx context.Context, etsyUserID int64) (EmailVerification, error)
+	SaveEmailVerification(ctx context.Context, v EmailVerification) error
+	DeleteEmailVerification(ctx context.Context, etsyUserID int64) error
+	Webhooks(ctx context.Context, etsyUserID int64) ([]Webhook, error)
+	AddWebhook(ctx context.Context, hook Webhook) (uint64, error)
+	DeleteWebhook(ctx context.Context, etsyUserID int64, id uint64) error
+	EnqueueWebhookDelivery(ctx context.Context, d WebhookDelivery) error
+	WebhookDeliveries(ctx context.Context) ([]WebhookDelivery, error)
+	SaveWebhookDelivery(ctx context.Context, d WebhookDelivery) error
+	DeleteWebhookDelivery(ctx context.Context, id uint64) error
+	LogWebhookAttempt(ctx context.Context, attempt WebhookAttempt) error
+	WebhookAttempts(ctx context.Context, etsyUserID int64, webhookID uint64) ([]WebhookAttempt, error)
+	SeenUpdate(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	ForgetUpdate(ctx context.Context, key string) error
+	CountUpdate(ctx context.Context, etsyUserID int64, at time.Time) error
+	UpdateCount(ctx context.Context, etsyUserID int64, since time.Time) (int64, error)
+	SaveEvent(ctx context.Context, event Event) error
+	Events(ctx context.Context, etsyUserID int64, since time.Time) ([]Event, error)
+	DeferAlert(ctx context.Context, chatID int64, msg Message) error
+	DeferredAlerts(ctx context.Context, chatID int64) ([]DeferredAlert, error)
+	DeleteDeferredAlerts(ctx context.Context, chatID int64, ids []uint64) error
+	EnqueueMessage(ctx context.Context, msg OutboxMessage) error
+	OutboxMessages(ctx context.Context) ([]OutboxMessage, error)
+	SaveOutboxMessage(ctx context.Context, msg OutboxMessage) error
+	DeleteOutboxMessage(ctx context.Context, id uint64) error
+	DeadLetter(ctx context.Context, msg OutboxMessage) error
+	PurgeExpired(ctx context.Context, now time.Time) error
 }
 
 type MessengerUpdate struct {
@@ -66,21 +160,64 @@ type MessengerUpdate struct {
 	UserID  int64
 	Command string
 	Text    string
+
+	// ChatType is "private", "group", "supergroup" or "channel", may be empty.
+	ChatType string
+	// LanguageCode is the language tag of the user's messenger client, may be empty.
+	LanguageCode string
+
+	// CallbackID is set when a button with Data is pressed, Text is the button Data then.
+	CallbackID string
+	// MessageID of the message with the pressed button.
+	MessageID int64
+}
+
+// Button opens the URL when pressed, buttons without URL send Data back to the bot.
+type Button struct {
+	Text string
+	URL  string
+	Data string
+}
+
+// Message is an HTML formatted text with optional rows of buttons.
+type Message struct {
+	Text    string
+	Buttons [][]Button
+	// Silent messages are delivered without a notification sound.
+	Silent bool
+	// Alert is the data of listing alerts, messengers with rich messages may render it next to Text.
+	Alert *AlertData `json:",omitempty"`
+	// Reply marks an answer to the command being handled, messengers with interactions send it as the response.
+	// Alerts, digests and other queued messages are not replies.
+	Reply bool `json:",omitempty"`
 }
 
 type Messenger interface {
 	SendLoginURL(text, url string, chatID int64) error
 	SendTextMessage(msg string, chatID int64) error
+	SendMessage(msg Message, chatID int64) error
+	EditMessage(msg Message, chatID, messageID int64) error
+	AnswerCallback(callbackID string) error
 	Updates(lastMsgID int64) ([]MessengerUpdate, error)
+	IsChatAdmin(chatID, userID int64) (bool, error)
 }
 
 type LowStock struct {
 	etsy      Etsy
 	messenger Messenger
 	storage   Storage
+	mailer    Mailer
 
 	mu           sync.Mutex
 	lastUpdateID int64
+
+	// Guard the listing state from concurrent update handlers, picked by listing ID.
+	listingMu [listingLocks]sync.Mutex
+
+	// Webhooks with deliveries in flight, each webhook is posted by a single goroutine at a time.
+	webhookMu   sync.Mutex
+	webhookBusy map[uint64]bool
+	webhookWG   sync.WaitGroup
 }
 
 func New(e Etsy, m Messenger, s Storage) *LowStock {
@@ -88,6 +225,8 @@ func New(e Etsy, m Messenger, s Storage) *LowStock {
 		etsy:      e,
 		messenger: m,
 		storage:   s,
+
+		webhookBusy: map[uint64]bool{},
 	}
 
 	return ls
@@ -104,10 +243,25 @@ type Update struct {
 	LastModifiedTSZ int64
 }
 
-func (ls *LowStock) Updates(ctx context.Context) ([]Update, error) {
-	updates, err := ls.etsy.Updates(ctx)
+// dedupeKey is the same for repeated feed entries of a single listing change.
+func (u Update) dedupeKey() string {
+	return fmt.Sprintf("%d/%s/%d", u.ListingID, u.State, u.LastModifiedTSZ)
+}
+
+// seenKey is dedupeKey of the shop, seen updates are deleted with the shop.
+func (u Update) seenKey() string {
+	return fmt.Sprintf("%d/%s", u.UserID, u.dedupeKey())
+}
+
+// Updates returns listing updates that happened within timeLimit starting at timeOffset.
+// Updates read so far are returned with ErrFeedTruncated.
+func (ls *LowStock) Updates(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error) {
+	updates, err := ls.etsy.Updates(ctx, timeOffset, timeLimit)
 	if err != nil {
 		log.Printf("Failed to get listing updates from Etsy: %s", err)
+		if errors.Is(err, ErrFeedTruncated) {
+			return updates, err
+		}
 		return nil, err
 	}
 
@@ -118,28 +272,148 @@ func (ls *LowStock) HandleEtsyUpdate(ctx context.Context, update Update) error {
 	name := fmt.Sprintf(`etsy_updates_total{state=%q}`, update.State)
 	metrics.GetOrCreateCounter(name).Inc()
 
+	switch update.State {
+	case soldOut, active, expired, removed:
+	default:
+		// noop
+		return nil
+	}
+
+	// Cache this data, I do not want a lot of requests here.
+	user, err := ls.storage.User(ctx, update.UserID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to get User record: %w", err)
+		}
+		return nil
+	}
+
+	seen, err := ls.storage.SeenUpdate(ctx, update.seenKey(), dedupeTTL)
+	if err != nil {
+		return fmt.Errorf("failed to check Update for duplicates: %w", err)
+	}
+
+	if seen {
+		duplicateUpdatesCounter.Inc()
+		return nil
+	}
+
+	if err := ls.handleListingUpdate(ctx, user, update); err != nil {
+		// The update is marked as seen already, it would be skipped when the feed brings it again.
+		if err := ls.storage.ForgetUpdate(ctx, update.seenKey()); err != nil {
+			log.Printf("Failed to forget Update %s: %s", update.seenKey(), err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// handleListingUpdate tracks the listing state and alerts on its changes.
+func (ls *LowStock) handleListingUpdate(ctx context.Context, user User, update Update) error {
+	if err := ls.storage.CountUpdate(ctx, update.UserID, time.Now()); err != nil {
+		return fmt.Errorf("failed to count Update: %w", err)
+	}
+
+	subs, err := ls.storage.Subscriptions(ctx, update.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get Subscriptions: %w", err)
+	}
+
+	// Paused chats get no alerts, listing states, events and webhooks are still kept up to date.
+	// Digest only chats learn about events from digests.
+	instant := instantSubscriptions(activeSubscriptions(subs))
+
+	if update.ShopName != "" && update.ShopName != user.ShopName {
+		user.ShopName = update.ShopName
+		if err := ls.storage.SaveUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to save User record: %w", err)
+		}
+	}
+
+	// Listing state is read and saved back, concurrent updates of the listing would both see the old state.
+	mu := &ls.listingMu[uint64(update.ListingID)%listingLocks]
+	mu.Lock()
+	defer mu.Unlock()
+
+	state, err := ls.storage.ListingState(ctx, update.ListingID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get Listing state: %w", err)
+	}
+
+	// Empty for listings seen for the first time. Sold-out alerts are always sent,
+	// expired and removed ones need a known state to change from.
+	prevState := state.State
+
+	state.ListingID = update.ListingID
+	state.EtsyUserID = update.UserID
+	state.State = update.State
+	state.Quantity = update.Quantity
+	if update.Title != "" {
+		state.Title = update.Title
+	}
+
 	switch update.State {
 	case soldOut:
-		// Cache this data, I do not want a lot of requests here.
-		user, err := ls.storage.User(ctx, update.UserID)
-		if err != nil {
-			if !errors.Is(err, ErrNotFound) {
-				return fmt.Errorf("failed to get User record: %w", err)
+		if prevState == soldOut {
+			break
+		}
+
+		if err := ls.recordEvent(ctx, update, alertSoldOut); err != nil {
+			return err
+		}
+
+		if err := ls.notify(ctx, user, instant, update, alertSoldOut); err != nil {
+			return err
+		}
+	case expired:
+		if prevState == "" || prevState == expired {
+			break
+		}
+
+		if err := ls.notify(ctx, user, optedIn(user.NotifyExpired, instant), update, alertExpired); err != nil {
+			return err
+		}
+	case removed:
+		if prevState == "" || prevState == removed {
+			break
+		}
+
+		if err := ls.notify(ctx, user, optedIn(user.NotifyRemoved, instant), update, alertRemoved); err != nil {
+			return err
+		}
+	case active:
+		if prevState == soldOut {
+			if err := ls.recordEvent(ctx, update, alertRestocked); err != nil {
+				return err
+			}
+
+			if err := ls.notify(ctx, user, optedIn(user.NotifyRestocked, instant), update, alertRestocked); err != nil {
+				return err
 			}
-			return nil
 		}
 
-		listingSKUs, err := ls.etsy.ListingSKUs(ctx, update.ListingID, user.Token, user.TokenSecret)
+		threshold, err := ls.threshold(ctx, user, update)
 		if err != nil {
-			return fmt.Errorf("failed to get Listing SKUs: %w", err)
+			return err
 		}
 
-		msg := fmt.Sprintf("Low stock for SKU: %v, shop: %s", listingSKUs, update.ShopName)
-		if err := ls.messenger.SendTextMessage(msg, user.ChatID); err != nil {
-			return fmt.Errorf("failed to send message via messenger: %w", err)
+		lowStock := threshold > 0 && update.Quantity <= threshold
+		if lowStock && !state.LowStock {
+			if err := ls.recordEvent(ctx, update, alertLowStock); err != nil {
+				return err
+			}
+
+			if err := ls.notify(ctx, user, instant, update, alertLowStock); err != nil {
+				return err
+			}
 		}
-	default:
-		// noop
+		state.LowStock = lowStock
+	}
+
+	if err := ls.storage.SaveListingState(ctx, state); err != nil {
+		return fmt.Errorf("failed to save Listing state: %w", err)
 	}
 
 	return nil
@@ -148,13 +422,18 @@ func (ls *LowStock) HandleEtsyUpdate(ctx context.Context, update Update) error {
 func (ls *LowStock) DoPin(ctx context.Context, msgUpdate MessengerUpdate) error {
 	pin := strings.TrimSpace(strings.TrimPrefix(msgUpdate.Text, "/pin"))
 	if pin == "" {
-		if err := ls.messenger.SendTextMessage(emptyPinMsg, msgUpdate.ChatID); err != nil {
+		msgs := messages(msgUpdate.LanguageCode)
+		if err := ls.messenger.SendTextMessage(msgs.emptyPin, msgUpdate.ChatID); err != nil {
 			return fmt.Errorf("failed to send empty pin notification: %w", err)
 		}
 
 		return ErrEmptyPin
 	}
 
+	if err := ls.authorizeLink(ctx, msgUpdate); err != nil {
+		return err
+	}
+
 	details, err := ls.storage.TokenDetails(ctx, msgUpdate.UserID)
 	if err != nil {
 		return err
@@ -170,19 +449,27 @@ func (ls *LowStock) DoPin(ctx context.Context, msgUpdate MessengerUpdate) error
 		return err
 	}
 
-	user := User{
-		EtsyUserID:  etsyUserID,
-		ChatID:      msgUpdate.ChatID,
-		ChatUserID:  msgUpdate.UserID,
-		Token:       details.Token,
-		TokenSecret: details.TokenSecret,
+	// Logging in again keeps user settings.
+	user, err := ls.storage.User(ctx, etsyUserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get User record: %w", err)
 	}
 
+	user.EtsyUserID = etsyUserID
+	user.Token = details.Token
+	user.TokenSecret = details.TokenSecret
+
 	if err := ls.storage.SaveUser(ctx, user); err != nil {
 		return fmt.Errorf("Failed to save user details: %w", err)
 	}
 
-	if err := ls.messenger.SendTextMessage(successMsg, msgUpdate.ChatID); err != nil {
+	sub, err := ls.subscribe(ctx, user, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale)
+	if err := ls.messenger.SendTextMessage(msgs.success, msgUpdate.ChatID); err != nil {
 		return fmt.Errorf("failed to send notification: %w", err)
 	}
 
@@ -195,7 +482,8 @@ func (ls *LowStock) DoStart(ctx context.Context, msgUpdate MessengerUpdate) erro
 		return err
 	}
 
-	if err := ls.messenger.SendLoginURL(startMsg, uri, msgUpdate.ChatID); err != nil {
+	msgs := messages(msgUpdate.LanguageCode)
+	if err := ls.messenger.SendLoginURL(msgs.start, uri, msgUpdate.ChatID); err != nil {
 		return err
 	}
 
@@ -207,8 +495,107 @@ func (ls *LowStock) DoStart(ctx context.Context, msgUpdate MessengerUpdate) erro
 }
 
 func (ls *LowStock) DoHelp(ctx context.Context, msgUpdate MessengerUpdate) error {
-	if err := ls.messenger.SendTextMessage(helpMsg, msgUpdate.ChatID); err != nil {
-		fmt.Errorf("failed to send help instructions: %w", err)
+	msgs := ls.chatMessages(ctx, msgUpdate)
+	if err := ls.messenger.SendTextMessage(msgs.help, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send help instructions: %w", err)
+	}
+
+	return nil
+}
+
+// commandArgs returns command arguments separated by whitespace.
+func commandArgs(msgUpdate MessengerUpdate) []string {
+	return strings.Fields(strings.TrimPrefix(msgUpdate.Text, msgUpdate.Command))
+}
+
+func (ls *LowStock) DoThreshold(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	args := commandArgs(msgUpdate)
+	if len(args) == 0 {
+		msg := fmt.Sprintf(msgs.threshold, user.Threshold)
+		if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send threshold: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	threshold, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || threshold < 0 || len(args) > 1 {
+		if err := ls.messenger.SendTextMessage(msgs.thresholdUsage, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send threshold usage: %w", err)
+		}
+
+		return ErrBadArguments
+	}
+
+	user.Threshold = threshold
+	if err := ls.storage.SaveUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to save user details: %w", err)
+	}
+
+	msg := fmt.Sprintf(msgs.threshold, user.Threshold)
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) DoNotify(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	args := commandArgs(msgUpdate)
+	if len(args) > 0 {
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			if err := ls.messenger.SendTextMessage(msgs.notifyUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send notify usage: %w", err)
+			}
+
+			return ErrBadArguments
+		}
+
+		enabled := args[1] == "on"
+		switch args[0] {
+		case "restocked":
+			user.NotifyRestocked = enabled
+		case "expired":
+			user.NotifyExpired = enabled
+		case "removed":
+			user.NotifyRemoved = enabled
+		default:
+			if err := ls.messenger.SendTextMessage(msgs.notifyUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send notify usage: %w", err)
+			}
+
+			return ErrBadArguments
+		}
+
+		if err := ls.storage.SaveUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user details: %w", err)
+		}
+	}
+
+	msg := fmt.Sprintf(msgs.notify, msgs.onOff(user.NotifyRestocked), msgs.onOff(user.NotifyExpired), msgs.onOff(user.NotifyRemoved))
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification settings: %w", err)
 	}
 
 	return nil
@@ -218,6 +605,10 @@ func (ls *LowStock) handleUpdate(ctx context.Context, msgUpdate MessengerUpdate)
 	command := msgUpdate.Command
 	ls.trackLastUpdateID(msgUpdate.ID)
 
+	if msgUpdate.CallbackID != "" {
+		defer ls.answerCallback(msgUpdate.CallbackID)
+	}
+
 	userIDStr := strconv.FormatInt(msgUpdate.UserID, 10)
 	name := fmt.Sprintf(`tg_commands_total{command=%q, user_id=%q}`, command, userIDStr)
 	metrics.GetOrCreateCounter(name).Inc()
@@ -229,12 +620,59 @@ func (ls *LowStock) handleUpdate(ctx context.Context, msgUpdate MessengerUpdate)
 		return ls.DoStart(ctx, msgUpdate)
 	case "/help":
 		return ls.DoHelp(ctx, msgUpdate)
+	case "/threshold":
+		return ls.DoThreshold(ctx, msgUpdate)
+	case "/watch":
+		return ls.DoWatch(ctx, msgUpdate)
+	case "/unwatch":
+		return ls.DoUnwatch(ctx, msgUpdate)
+	case "/watches":
+		return ls.DoWatches(ctx, msgUpdate)
+	case "/notify":
+		return ls.DoNotify(ctx, msgUpdate)
+	case "/template":
+		return ls.DoTemplate(ctx, msgUpdate)
+	case "/language":
+		return ls.DoLanguage(ctx, msgUpdate)
+	case "/stop":
+		return ls.DoStop(ctx, msgUpdate)
+	case "/resume":
+		return ls.DoResume(ctx, msgUpdate)
+	case "/logout":
+		return ls.DoLogout(ctx, msgUpdate)
+	case "/shops":
+		return ls.DoShops(ctx, msgUpdate)
+	case "/status":
+		return ls.DoStatus(ctx, msgUpdate)
+	case "/stock":
+		return ls.DoStock(ctx, msgUpdate)
+	case "/digest":
+		return ls.DoDigest(ctx, msgUpdate)
+	case "/quiet":
+		return ls.DoQuiet(ctx, msgUpdate)
+	case "/snooze":
+		return ls.DoSnooze(ctx, msgUpdate)
+	case "/mute":
+		return ls.DoMute(ctx, msgUpdate)
+	case "/unmute":
+		return ls.DoUnmute(ctx, msgUpdate)
+	case "/restocked":
+		return ls.DoRestocked(ctx, msgUpdate)
+	case "/email":
+		return ls.DoEmail(ctx, msgUpdate)
+	case "/webhook":
+		return ls.DoWebhook(ctx, msgUpdate)
 	default:
 		log.Printf("Unsupported command: %s", command)
 		return nil
 	}
+}
 
-	return nil
+// answerCallback stops the progress indicator on the pressed button.
+func (ls *LowStock) answerCallback(callbackID string) {
+	if err := ls.messenger.AnswerCallback(callbackID); err != nil {
+		log.Printf("Failed to answer callback: %s", err)
+	}
 }
 
 func (ls *LowStock) handleUpdates(ctx context.Context, msgUpdates []MessengerUpdate) {
@@ -253,6 +691,12 @@ func (ls *LowStock) trackLastUpdateID(ID int64) {
 	ls.mu.Unlock()
 }
 
+// HandleMessengerUpdate processes an update pushed by the messenger, e.g. to a webhook.
+// It is the alternative to ListenAndServe.
+func (ls *LowStock) HandleMessengerUpdate(ctx context.Context, msgUpdate MessengerUpdate) {
+	ls.handleUpdates(ctx, []MessengerUpdate{msgUpdate})
+}
+
 // ListenAndServe gets updates and processes them.
 func (ls *LowStock) ListenAndServe(ctx context.Context) {
 	for {
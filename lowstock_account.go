@@ -0,0 +1,102 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// setPaused turns alerts of the chat off or on for all shops of the chat.
+func (ls *LowStock) setPaused(ctx context.Context, msgUpdate MessengerUpdate, paused bool) (Subscription, error) {
+	_, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return Subscription{}, err
+	}
+
+	if err := ls.updateChatSubscriptions(ctx, msgUpdate.ChatID, func(s *Subscription) {
+		s.Paused = paused
+	}); err != nil {
+		return Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+func (ls *LowStock) DoStop(ctx context.Context, msgUpdate MessengerUpdate) error {
+	sub, err := ls.setPaused(ctx, msgUpdate, true)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	if err := ls.messenger.SendTextMessage(msgs.stop, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) DoResume(ctx context.Context, msgUpdate MessengerUpdate) error {
+	sub, err := ls.setPaused(ctx, msgUpdate, false)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	if err := ls.messenger.SendTextMessage(msgs.resume, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+// DoLogout unlinks the selected shop from the chat.
+// Everything stored about the shop is deleted once no chat is linked to it.
+// Etsy API v2 can not revoke OAuth tokens, the token is dropped
+// and the user is pointed to Etsy account settings to revoke app access.
+func (ls *LowStock) DoLogout(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	if err := ls.storage.DeleteSubscription(ctx, sub); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	// Temporary tokens are kept by the messenger user that requested login.
+	for _, id := range []int64{sub.ChatUserID, msgUpdate.UserID} {
+		if err := ls.storage.DeleteTokenDetails(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to delete oauth token details: %w", err)
+		}
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	subs, err := ls.storage.Subscriptions(ctx, user.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+
+	msg := msgs.logoutChat
+	if len(subs) == 0 {
+		if err := ls.storage.DeleteUser(ctx, user.EtsyUserID); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		msg = msgs.logout
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
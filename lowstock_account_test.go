@@ -0,0 +1,192 @@
+package lowstock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDoStopAndResume(t *testing.T) {
+	subs := map[int64]Subscription{
+		5432: Subscription{EtsyUserID: 5432, ChatID: 42, Selected: true},
+		5433: Subscription{EtsyUserID: 5433, ChatID: 42},
+	}
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{subs[5432], subs[5433]}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			subs[sub.EtsyUserID] = sub
+			return nil
+		},
+	}
+
+	var reply string
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			reply = msg
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	if err := ls.DoStop(context.Background(), MessengerUpdate{Command: "/stop", ChatID: 42}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !subs[5432].Paused || !subs[5433].Paused || reply != stopMsg {
+		t.Errorf("Alerts are not paused, subscriptions: %+v, reply: %s", subs, reply)
+	}
+
+	if err := ls.DoResume(context.Background(), MessengerUpdate{Command: "/resume", ChatID: 42}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if subs[5432].Paused || subs[5433].Paused || reply != resumeMsg {
+		t.Errorf("Alerts are not resumed, subscriptions: %+v, reply: %s", subs, reply)
+	}
+}
+
+func TestHandleEtsyUpdatePaused(t *testing.T) {
+	var saved ListingState
+	var events, deliveries int
+
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: etsyUserID, ChatID: 42, Paused: true}}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			return false, nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, State: active, Quantity: 1}, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			saved = state
+			return nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			events++
+			return nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return []Webhook{Webhook{ID: 1, EtsyUserID: etsyUserID}}, nil
+		},
+		EnqueueWebhookDeliveryFunc: func(ctx context.Context, d WebhookDelivery) error {
+			deliveries++
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			t.Error("Paused chats must get no alerts")
+			return nil
+		},
+		DeferAlertFunc: func(ctx context.Context, chatID int64, msg Message) error {
+			t.Error("Paused chats must get no alerts")
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			return nil, nil
+		},
+	}
+
+	ls := New(etsy, &MessengerMock{}, storage)
+
+	if err := ls.HandleEtsyUpdate(context.Background(), Update{State: soldOut, UserID: 5432, ListingID: 7}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if saved.State != soldOut || events != 1 || deliveries != 1 {
+		t.Errorf("Listing is not tracked while paused, state: %+v, events: %d, deliveries: %d", saved, events, deliveries)
+	}
+}
+
+func TestDoLogout(t *testing.T) {
+	tests := []struct {
+		name          string
+		otherChats    []Subscription
+		expectDeleted bool
+		expectedReply string
+	}{
+		{name: "last chat", expectDeleted: true, expectedReply: logoutMsg},
+		{name: "other chats", otherChats: []Subscription{Subscription{EtsyUserID: 5432, ChatID: 43}}, expectedReply: logoutChatMsg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				deletedUser   int64
+				deletedSub    Subscription
+				deletedTokens []int64
+				reply         string
+			)
+
+			storage := &StorageMock{
+				ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+					return []Subscription{Subscription{EtsyUserID: 5432, ChatUserID: 7, ChatID: chatID}}, nil
+				},
+				UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+					return User{EtsyUserID: etsyUserID}, nil
+				},
+				DeleteSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+					deletedSub = sub
+					return nil
+				},
+				SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+					return tt.otherChats, nil
+				},
+				DeleteUserFunc: func(ctx context.Context, etsyUserID int64) error {
+					deletedUser = etsyUserID
+					return nil
+				},
+				DeleteTokenDetailsFunc: func(ctx context.Context, id int64) error {
+					deletedTokens = append(deletedTokens, id)
+					return ErrNotFound
+				},
+			}
+
+			messenger := &MessengerMock{
+				SendTextMessageFunc: func(msg string, chatID int64) error {
+					reply = msg
+					return nil
+				},
+			}
+
+			ls := New(&EtsyMock{}, messenger, storage)
+
+			update := MessengerUpdate{Command: "/logout", ChatID: 42, UserID: 8}
+			if err := ls.DoLogout(context.Background(), update); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if deletedSub.EtsyUserID != 5432 || deletedSub.ChatID != 42 {
+				t.Errorf("Got deleted subscription: %+v", deletedSub)
+			}
+
+			if (deletedUser == 5432) != tt.expectDeleted {
+				t.Errorf("Got deleted user: %d, expected deletion: %t", deletedUser, tt.expectDeleted)
+			}
+
+			if len(deletedTokens) != 2 || deletedTokens[0] != 7 || deletedTokens[1] != 8 {
+				t.Errorf("Got deleted token details: %v, expected: [7 8]", deletedTokens)
+			}
+
+			if reply != tt.expectedReply {
+				t.Errorf("Unexpected reply: %s", reply)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package lowstock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	alertSoldOut   = "sold_out"
+	alertLowStock  = "low_stock"
+	alertRestocked = "restocked"
+	alertExpired   = "expired"
+	alertRemoved   = "removed"
+)
+
+const (
+	listingURLFormat = "https://www.etsy.com/listing/%d"
+	editURLFormat    = "https://www.etsy.com/your/shops/me/tools/listings/%d"
+)
+
+// AlertData is available to alert templates.
+//
+// Listing fields come from Update: .Title, .ShopName, .ListingID, .UserID (Etsy user ID of the shop owner),
+// .Quantity, .State, .CreationTSZ and .LastModifiedTSZ (Unix timestamps).
+// Templates may use "join" (strings.Join) and the built-in "html" function to escape values.
+type AlertData struct {
+	Update
+
+	// Kind is one of: sold_out, low_stock, restocked, expired, removed.
+	Kind       string
+	SKUs       []string
+	ListingURL string
+	EditURL    string
+	// Time of the listing change.
+	Time time.Time
+}
+
+var alertFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+func newAlertData(kind string, update Update, skus []string) AlertData {
+	return AlertData{
+		Update:     update,
+		Kind:       kind,
+		SKUs:       skus,
+		ListingURL: fmt.Sprintf(listingURLFormat, update.ListingID),
+		EditURL:    fmt.Sprintf(editURLFormat, update.ListingID),
+		Time:       time.Unix(update.LastModifiedTSZ, 0).UTC(),
+	}
+}
+
+func alertButtons(msgs *bundle, data AlertData) [][]Button {
+	if data.Kind == alertRemoved {
+		return nil
+	}
+
+	return [][]Button{
+		[]Button{
+			Button{Text: msgs.openListing, URL: data.ListingURL},
+			Button{Text: msgs.editListing, URL: data.EditURL},
+		},
+		actionButtons(msgs, data),
+	}
+}
+
+// renderAlert renders the alert with built-in templates of the bundle.
+func renderAlert(msgs *bundle, data AlertData) (Message, error) {
+	var buf bytes.Buffer
+	if err := msgs.alertsTmpl.ExecuteTemplate(&buf, data.Kind, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Text: buf.String(), Buttons: alertButtons(msgs, data)}, nil
+}
+
+// notify queues the event for webhooks of the user and alerts the chats, listing SKUs are fetched once for both.
+// Webhook failures are logged, chat alerts and the listing state do not depend on them.
+func (ls *LowStock) notify(ctx context.Context, user User, subs []Subscription, update Update, kind string) error {
+	hooks, err := ls.storage.Webhooks(ctx, user.EtsyUserID)
+	if err != nil {
+		log.Printf("Failed to get webhooks of user %d: %s", user.EtsyUserID, err)
+	}
+
+	if len(hooks) == 0 && len(subs) == 0 {
+		return nil
+	}
+
+	var listingSKUs []string
+
+	// Removed listings are gone from the API.
+	if kind != alertRemoved {
+		listingSKUs, err = ls.etsy.ListingSKUs(ctx, update.ListingID, user.Token, user.TokenSecret)
+		if err != nil {
+			return fmt.Errorf("failed to get Listing SKUs: %w", err)
+		}
+	}
+
+	if err := ls.queueWebhooks(ctx, hooks, update, kind, listingSKUs); err != nil {
+		log.Printf("Failed to queue %s webhooks of user %d: %s", kind, user.EtsyUserID, err)
+	}
+
+	return ls.alert(ctx, user, subs, update, kind, listingSKUs)
+}
+
+// optedIn returns the chats when the user opted in to the alert, webhooks get the event either way.
+func optedIn(optIn bool, subs []Subscription) []Subscription {
+	if !optIn {
+		return nil
+	}
+
+	return subs
+}
+
+// alert notifies subscribed chats about the listing update.
+// Alerts are queued in the outbox, when a chat fails the rest go on and the last error is returned.
+func (ls *LowStock) alert(ctx context.Context, user User, subs []Subscription, update Update, kind string, listingSKUs []string) error {
+	if len(subs) == 0 {
+		return nil
+	}
+
+	muted, err := ls.muted(ctx, user.EtsyUserID, update.ListingID, listingSKUs)
+	if err != nil {
+		return err
+	}
+
+	if muted {
+		mutedAlertsCounter.Inc()
+		return nil
+	}
+
+	data := newAlertData(kind, update, listingSKUs)
+	now := time.Now()
+
+	var lastErr error
+	for _, sub := range subs {
+		msg, err := renderUserAlert(user, sub, data)
+		if err != nil {
+			return fmt.Errorf("failed to render %s alert: %w", kind, err)
+		}
+		msg.Alert = &data
+
+		if deferAlerts(sub, now) {
+			if err := ls.storage.DeferAlert(ctx, sub.ChatID, msg); err != nil {
+				log.Printf("Failed to defer %s alert to chat %d: %s", kind, sub.ChatID, err)
+				lastErr = fmt.Errorf("failed to defer alert: %w", err)
+			}
+			continue
+		}
+		msg.Silent = silentAlerts(sub, now)
+
+		if err := ls.send(ctx, user.EtsyUserID, sub.ChatID, msg); err != nil {
+			log.Printf("Failed to queue %s alert to chat %d: %s", kind, sub.ChatID, err)
+			lastErr = err
+		}
+	}
+
+	// Chats do not depend on email.
+	if err := ls.emailAlert(ctx, user, subs, data, now); err != nil {
+		log.Printf("Failed to queue %s email of user %d: %s", kind, user.EtsyUserID, err)
+	}
+
+	return lastErr
+}
@@ -0,0 +1,68 @@
+package lowstock
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderSoldOutAlert(t *testing.T) {
+	update := Update{
+		State:           soldOut,
+		Title:           "Mug <red> & blue",
+		ShopName:        "Test shop",
+		ListingID:       42,
+		UserID:          5432,
+		LastModifiedTSZ: 1580000000,
+	}
+
+	expected := Message{
+		Text: "<b>Sold out:</b> Mug &lt;red&gt; &amp; blue\n" +
+			"Shop: Test shop\n" +
+			"SKU: <code>MUG-RED, MUG-BLUE</code>\n" +
+			"Sold out at 26 Jan 2020 00:53 UTC",
+		Buttons: [][]Button{
+			[]Button{
+				Button{Text: "Open listing", URL: "https://www.etsy.com/listing/42"},
+				Button{Text: "Edit in Shop Manager", URL: "https://www.etsy.com/your/shops/me/tools/listings/42"},
+			},
+			[]Button{
+				Button{Text: "Snooze this listing", Data: "/mute 42 24h #5432"},
+				Button{Text: "Mark restocked", Data: "/restocked 42 #5432"},
+			},
+		},
+	}
+
+	actual, err := renderAlert(&enBundle, newAlertData(alertSoldOut, update, []string{"MUG-RED", "MUG-BLUE"}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("Messages do not match:\n%s", diff)
+	}
+}
+
+func TestRenderAllAlertKinds(t *testing.T) {
+	kinds := []string{alertSoldOut, alertLowStock, alertRestocked, alertExpired, alertRemoved}
+
+	for code, msgs := range bundles {
+		for _, kind := range kinds {
+			msgs := msgs
+			t.Run(code+"/"+kind, func(t *testing.T) {
+				msg, err := renderAlert(msgs, newAlertData(kind, Update{ListingID: 42}, nil))
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				if msg.Text == "" {
+					t.Error("Empty alert text")
+				}
+
+				if kind == alertRemoved && msg.Buttons != nil {
+					t.Error("Removed listing alert must not have buttons")
+				}
+			})
+		}
+	}
+}
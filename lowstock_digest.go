@@ -0,0 +1,255 @@
+package lowstock
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// Events are kept for a week long digest and a day of slack.
+var eventsTTL = 8 * 24 * time.Hour
+
+// Event is a listing change recorded for digests.
+// Kind is one of: sold_out, restocked, low_stock.
+type Event struct {
+	EtsyUserID int64
+	ListingID  int64
+	Kind       string
+	Title      string
+	Quantity   int64
+	Time       time.Time
+}
+
+func (ls *LowStock) recordEvent(ctx context.Context, update Update, kind string) error {
+	event := Event{
+		EtsyUserID: update.UserID,
+		ListingID:  update.ListingID,
+		Kind:       kind,
+		Title:      update.Title,
+		Quantity:   update.Quantity,
+		Time:       time.Now(),
+	}
+
+	if err := ls.storage.SaveEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to save %s event: %w", kind, err)
+	}
+
+	return nil
+}
+
+// digestSettings are parsed from "/digest {daily|weekly} {HH:MM} [timezone] [only]" or "/digest off".
+type digestSettings struct {
+	digest   string
+	at       int
+	timezone string
+	only     bool
+}
+
+func (d digestSettings) apply(sub *Subscription) {
+	sub.Digest = d.digest
+	sub.DigestAt = d.at
+	sub.Timezone = d.timezone
+	sub.DigestOnly = d.only
+}
+
+// parseDigest reads digest settings, timezone of the chat is kept when omitted.
+func parseDigest(args []string, timezone string) (digestSettings, error) {
+	settings := digestSettings{timezone: timezone}
+
+	if len(args) == 1 && args[0] == "off" {
+		return settings, nil
+	}
+
+	if len(args) < 2 || len(args) > 4 {
+		return digestSettings{}, ErrBadArguments
+	}
+
+	switch args[0] {
+	case digestDaily, digestWeekly:
+		settings.digest = args[0]
+	default:
+		return digestSettings{}, ErrBadArguments
+	}
+
+	at, err := time.Parse("15:04", args[1])
+	if err != nil {
+		return digestSettings{}, ErrBadArguments
+	}
+	settings.at = at.Hour()*60 + at.Minute()
+
+	for _, arg := range args[2:] {
+		if arg == "only" {
+			settings.only = true
+			continue
+		}
+
+		if !validTimezone(arg) {
+			return digestSettings{}, ErrBadArguments
+		}
+		settings.timezone = arg
+	}
+
+	return settings, nil
+}
+
+// validTimezone accepts IANA timezone names, "Local" is the timezone of the server and is rejected.
+func validTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return err == nil && name != "Local"
+}
+
+func timezoneName(timezone string) string {
+	if timezone == "" {
+		return "UTC"
+	}
+
+	return timezone
+}
+
+// DoDigest shows or changes digest settings of the chat, they apply to all shops of the chat.
+func (ls *LowStock) DoDigest(ctx context.Context, msgUpdate MessengerUpdate) error {
+	_, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	if args := commandArgs(msgUpdate); len(args) > 0 {
+		settings, err := parseDigest(args, sub.Timezone)
+		if err != nil {
+			if err := ls.messenger.SendTextMessage(msgs.digestUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send digest usage: %w", err)
+			}
+
+			return err
+		}
+
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		// The first digest comes at the next scheduled time.
+		now := time.Now().Unix()
+
+		if err := ls.updateChatSubscriptions(ctx, msgUpdate.ChatID, func(s *Subscription) {
+			settings.apply(s)
+			s.LastDigest = now
+		}); err != nil {
+			return err
+		}
+		settings.apply(&sub)
+	}
+
+	msg := msgs.digestOff
+	if sub.Digest != "" {
+		period := msgs.digestDaily
+		if sub.Digest == digestWeekly {
+			period = msgs.digestWeekly
+		}
+
+		at := fmt.Sprintf("%02d:%02d", sub.DigestAt/60, sub.DigestAt%60)
+		msg = fmt.Sprintf(msgs.digest, period, at, html.EscapeString(timezoneName(sub.Timezone)), msgs.onOff(!sub.DigestOnly))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send digest settings: %w", err)
+	}
+
+	return nil
+}
+
+// latestEvents keeps the last event of each listing per kind, in order of occurrence.
+func latestEvents(events []Event, kind string) []Event {
+	index := map[int64]int{}
+
+	var latest []Event
+	for _, e := range events {
+		if e.Kind != kind {
+			continue
+		}
+
+		if i, ok := index[e.ListingID]; ok {
+			latest[i] = e
+			continue
+		}
+
+		index[e.ListingID] = len(latest)
+		latest = append(latest, e)
+	}
+
+	return latest
+}
+
+// renderDigest summarises events of the shop since the previous digest.
+// The low stock section lists all listings that are under the threshold now,
+// including those that went low before the previous digest.
+func (ls *LowStock) renderDigest(ctx context.Context, msgs *bundle, user User, since time.Time) (string, error) {
+	events, err := ls.storage.Events(ctx, user.EtsyUserID, since)
+	if err != nil {
+		return "", fmt.Errorf("failed to get events: %w", err)
+	}
+
+	states, err := ls.storage.ListingStates(ctx, user.EtsyUserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Listing states: %w", err)
+	}
+
+	var lowStock []Event
+	for _, state := range states {
+		if state.State != active || !state.LowStock {
+			continue
+		}
+
+		title := state.Title
+		if title == "" {
+			title = strconv.FormatInt(state.ListingID, 10)
+		}
+		lowStock = append(lowStock, Event{ListingID: state.ListingID, Title: title, Quantity: state.Quantity})
+	}
+
+	sections := []struct {
+		title    string
+		item     string
+		quantity bool
+		events   []Event
+	}{
+		{title: msgs.digestSoldOut, item: msgs.digestItem, events: latestEvents(events, alertSoldOut)},
+		{title: msgs.digestBack, item: msgs.digestBackItem, quantity: true, events: latestEvents(events, alertRestocked)},
+		{title: msgs.digestLowStock, item: msgs.stockLow, quantity: true, events: lowStock},
+	}
+
+	parts := []string{fmt.Sprintf(msgs.digestTitle, html.EscapeString(msgs.shopName(user)))}
+	for _, s := range sections {
+		if len(s.events) == 0 {
+			continue
+		}
+
+		lines := []string{s.title}
+		for _, e := range s.events {
+			url := fmt.Sprintf(listingURLFormat, e.ListingID)
+			if !s.quantity {
+				lines = append(lines, fmt.Sprintf(s.item, url, html.EscapeString(e.Title)))
+				continue
+			}
+
+			lines = append(lines, fmt.Sprintf(s.item, url, html.EscapeString(e.Title), e.Quantity))
+		}
+
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+
+	if len(parts) == 1 {
+		parts = append(parts, msgs.digestEmpty)
+	}
+
+	return strings.Join(parts, "\n\n"), nil
+}
@@ -0,0 +1,185 @@
+package lowstock
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDigest(t *testing.T) {
+	tests := []struct {
+		args        string
+		expected    digestSettings
+		expectedErr error
+	}{
+		{args: "off", expected: digestSettings{timezone: "Europe/Kyiv"}},
+		{args: "daily 08:00", expected: digestSettings{digest: digestDaily, at: 480, timezone: "Europe/Kyiv"}},
+		{args: "daily 08:00 Europe/Berlin", expected: digestSettings{digest: digestDaily, at: 480, timezone: "Europe/Berlin"}},
+		{args: "weekly 21:45 UTC only", expected: digestSettings{digest: digestWeekly, at: 1305, timezone: "UTC", only: true}},
+		{args: "hourly 08:00", expectedErr: ErrBadArguments},
+		{args: "daily 8am", expectedErr: ErrBadArguments},
+		{args: "daily 08:00 Mars/Olympus", expectedErr: ErrBadArguments},
+		{args: "daily 08:00 Local", expectedErr: ErrBadArguments},
+		{args: "daily", expectedErr: ErrBadArguments},
+	}
+
+	for _, tt := range tests {
+		actual, err := parseDigest(strings.Fields(tt.args), "Europe/Kyiv")
+		if err != tt.expectedErr {
+			t.Errorf("Got error: %v for %q, expected: %v", err, tt.args, tt.expectedErr)
+			continue
+		}
+
+		if diff := cmp.Diff(tt.expected, actual, cmp.AllowUnexported(digestSettings{})); diff != "" {
+			t.Errorf("Settings for %q do not match:\n%s", tt.args, diff)
+		}
+	}
+}
+
+func TestDoDigest(t *testing.T) {
+	var saved []Subscription
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{
+				Subscription{EtsyUserID: 1, ChatID: chatID, Selected: true},
+				Subscription{EtsyUserID: 2, ChatID: chatID},
+			}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			saved = append(saved, sub)
+			return nil
+		},
+	}
+
+	var reply string
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			reply = msg
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	msgUpdate := MessengerUpdate{ChatID: 42, Command: "/digest", Text: "/digest daily 08:30 Europe/Berlin only"}
+	if err := ls.DoDigest(context.Background(), msgUpdate); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(saved) != 2 {
+		t.Fatalf("Got %d saved subscriptions, expected: 2", len(saved))
+	}
+
+	for _, sub := range saved {
+		if sub.Digest != digestDaily || sub.DigestAt != 510 || sub.Timezone != "Europe/Berlin" || !sub.DigestOnly || sub.LastDigest == 0 {
+			t.Errorf("Unexpected subscription: %+v", sub)
+		}
+	}
+
+	expected := "Digest: <b>daily</b> at <b>08:30</b> (Europe/Berlin).\nInstant alerts: <b>off</b>"
+	if !strings.HasPrefix(reply, expected) {
+		t.Errorf("Got reply: %q, expected: %q", reply, expected)
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	storage := &StorageMock{
+		EventsFunc: func(ctx context.Context, etsyUserID int64, since time.Time) ([]Event, error) {
+			return []Event{
+				Event{ListingID: 1, Kind: alertSoldOut, Title: "Mug"},
+				Event{ListingID: 2, Kind: alertLowStock, Title: "Plate", Quantity: 3},
+				Event{ListingID: 3, Kind: alertLowStock, Title: "Bowl", Quantity: 1},
+				Event{ListingID: 1, Kind: alertRestocked, Title: "Mug", Quantity: 5},
+				Event{ListingID: 4, Kind: alertSoldOut, Title: "Cup & Saucer"},
+				Event{ListingID: 4, Kind: alertSoldOut, Title: "Cup & Saucer"},
+			}, nil
+		},
+		ListingStatesFunc: func(ctx context.Context, etsyUserID int64) ([]ListingState, error) {
+			return []ListingState{
+				ListingState{ListingID: 1, State: active, Quantity: 5, Title: "Mug"},
+				ListingState{ListingID: 2, State: active, Quantity: 2, Title: "Plate", LowStock: true},
+				// Bowl is restocked above the threshold since.
+				ListingState{ListingID: 3, State: active, Quantity: 20, Title: "Bowl"},
+				ListingState{ListingID: 4, State: soldOut, Title: "Cup & Saucer", LowStock: true},
+				// Jug went low before the previous digest and is still low.
+				ListingState{ListingID: 5, State: active, Quantity: 1, Title: "Jug", LowStock: true},
+			}, nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+
+	actual, err := ls.renderDigest(context.Background(), &enBundle, User{EtsyUserID: 5432, ShopName: "Test Shop"}, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := `<b>Digest of Test Shop</b>
+
+Sold out:
+• <a href="https://www.etsy.com/listing/1">Mug</a>
+• <a href="https://www.etsy.com/listing/4">Cup &amp; Saucer</a>
+
+Back in stock:
+• <a href="https://www.etsy.com/listing/1">Mug</a> — <b>5</b> in stock
+
+Under threshold:
+• <a href="https://www.etsy.com/listing/2">Plate</a> — <b>2</b> left
+• <a href="https://www.etsy.com/listing/5">Jug</a> — <b>1</b> left`
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("Digests do not match:\n%s", diff)
+	}
+}
+
+func TestHandleEtsyUpdateDigestOnly(t *testing.T) {
+	var events []Event
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: etsyUserID, ChatID: 42, Digest: digestDaily, DigestOnly: true}}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			return false, nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			events = append(events, event)
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, State: active, Quantity: 1}, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			t.Error("Digest only chats must not get instant alerts")
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+
+	update := Update{State: soldOut, ListingID: 7, UserID: 5432, Title: "Mug"}
+	if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(events) != 1 || events[0].Kind != alertSoldOut || events[0].ListingID != 7 || events[0].Title != "Mug" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
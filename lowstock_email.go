@@ -0,0 +1,302 @@
+package lowstock
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math/big"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// Confirmation codes are valid this long.
+	emailCodeTTL = time.Hour
+	// A confirmation code is dropped after this many wrong guesses.
+	maxEmailCodeAttempts = 5
+)
+
+var (
+	emailSentCounter   = metrics.NewCounter(`emails_total{status="sent"}`)
+	emailFailedCounter = metrics.NewCounter(`emails_total{status="failed"}`)
+)
+
+// Mail is an email with text and HTML bodies of the same content.
+type Mail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers emails, see the email package.
+type Mailer interface {
+	SendMail(to string, mail Mail) error
+}
+
+// EmailVerification is an email address waiting for the confirmation code that was sent to it.
+type EmailVerification struct {
+	EtsyUserID int64
+	Address    string
+	Code       string
+	Attempts   int
+	Expires    int64
+}
+
+// SetMailer turns on email alerts and the /email command.
+func (ls *LowStock) SetMailer(m Mailer) {
+	ls.mailer = m
+}
+
+var (
+	htmlLink = regexp.MustCompile(`<a href="([^"]*)">(.*?)</a>`)
+	htmlTag  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// toMail renders a message as an email, the first line of the text is the subject.
+// Links of buttons are added to the bodies, buttons with commands are left out.
+func toMail(msg Message) Mail {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(htmlLink.ReplaceAllString(msg.Text, "$2 ($1)"), ""))
+	body := strings.Replace(msg.Text, "\n", "<br>\n", -1)
+
+	for _, row := range msg.Buttons {
+		for _, b := range row {
+			if b.URL == "" {
+				continue
+			}
+
+			text += fmt.Sprintf("\n%s: %s", b.Text, b.URL)
+			body += fmt.Sprintf("<br>\n<a href=\"%s\">%s</a>", html.EscapeString(b.URL), html.EscapeString(b.Text))
+		}
+	}
+
+	return Mail{
+		Subject: strings.TrimSpace(strings.SplitN(text, "\n", 2)[0]),
+		Text:    text + "\n",
+		HTML:    "<!DOCTYPE html>\n<html><body>\n" + body + "\n</body></html>\n",
+	}
+}
+
+// emailAlert queues the alert to the verified email address of the user.
+// The email follows language, template, quiet hours and snooze of the chat the address was verified in,
+// it is not sent while that chat is paused or gets digests only.
+func (ls *LowStock) emailAlert(ctx context.Context, user User, subs []Subscription, data AlertData, now time.Time) error {
+	if ls.mailer == nil || user.Email == "" {
+		return nil
+	}
+
+	sub, ok := emailSubscription(user, subs)
+	if !ok {
+		return nil
+	}
+
+	msg, err := renderUserAlert(user, sub, data)
+	if err != nil {
+		return fmt.Errorf("failed to render %s email: %w", data.Kind, err)
+	}
+
+	if err := ls.storage.EnqueueMessage(ctx, OutboxMessage{
+		ChatID:      sub.ChatID,
+		Message:     msg,
+		EtsyUserID:  user.EtsyUserID,
+		Email:       user.Email,
+		NextAttempt: deferredUntil(sub, now),
+		Created:     now,
+	}); err != nil {
+		return fmt.Errorf("failed to enqueue email: %w", err)
+	}
+
+	return nil
+}
+
+// emailSubscription finds the chat the address was verified in.
+// Addresses verified before chats were recorded follow the first chat.
+func emailSubscription(user User, subs []Subscription) (Subscription, bool) {
+	if user.EmailChatID == 0 {
+		return subs[0], true
+	}
+
+	for _, sub := range subs {
+		if sub.ChatID == user.EmailChatID {
+			return sub, true
+		}
+	}
+
+	return Subscription{}, false
+}
+
+func emailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// DoEmail shows, registers, verifies or removes the email address alerts are sent to.
+func (ls *LowStock) DoEmail(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, args, err := ls.shopUser(ctx, msgUpdate, commandArgs(msgUpdate))
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	if ls.mailer == nil {
+		if err := ls.messenger.SendTextMessage(msgs.emailDisabled, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		return nil
+	}
+
+	if len(args) == 0 {
+		msg := msgs.emailUnset
+		if user.Email != "" {
+			msg = fmt.Sprintf(msgs.email, html.EscapeString(user.Email))
+		}
+
+		if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send email address: %w", err)
+		}
+
+		return nil
+	}
+
+	if len(args) != 1 && (len(args) != 2 || args[0] != "verify") {
+		return ls.sendEmailUsage(msgs, msgUpdate.ChatID)
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "off":
+		return ls.removeEmail(ctx, msgs, user, msgUpdate.ChatID)
+	case "verify":
+		return ls.verifyEmail(ctx, msgs, user, args[1], msgUpdate.ChatID)
+	default:
+		return ls.registerEmail(ctx, msgs, user, args[0], msgUpdate.ChatID)
+	}
+}
+
+func (ls *LowStock) sendEmailUsage(msgs *bundle, chatID int64) error {
+	if err := ls.messenger.SendTextMessage(msgs.emailUsage, chatID); err != nil {
+		return fmt.Errorf("failed to send email usage: %w", err)
+	}
+
+	return ErrBadArguments
+}
+
+// registerEmail sends a confirmation code to the address, it is used once the code is submitted.
+func (ls *LowStock) registerEmail(ctx context.Context, msgs *bundle, user User, address string, chatID int64) error {
+	addr, err := mail.ParseAddress(address)
+	if err != nil || addr.Address != address {
+		return ls.sendEmailUsage(msgs, chatID)
+	}
+
+	code, err := emailCode()
+	if err != nil {
+		return fmt.Errorf("failed to generate confirmation code: %w", err)
+	}
+
+	v := EmailVerification{
+		EtsyUserID: user.EtsyUserID,
+		Address:    address,
+		Code:       code,
+		Expires:    time.Now().Add(emailCodeTTL).Unix(),
+	}
+
+	if err := ls.storage.SaveEmailVerification(ctx, v); err != nil {
+		return fmt.Errorf("failed to save email verification: %w", err)
+	}
+
+	msg := fmt.Sprintf(msgs.emailCodeSent, html.EscapeString(address))
+	if err := ls.mailer.SendMail(address, toMail(Message{Text: fmt.Sprintf(msgs.emailCode, code)})); err != nil {
+		emailFailedCounter.Inc()
+		log.Printf("Failed to email confirmation code of user %d: %s", user.EtsyUserID, err)
+		msg = fmt.Sprintf(msgs.emailFailed, html.EscapeString(address))
+	} else {
+		emailSentCounter.Inc()
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) verifyEmail(ctx context.Context, msgs *bundle, user User, code string, chatID int64) error {
+	v, err := ls.storage.EmailVerification(ctx, user.EtsyUserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get email verification: %w", err)
+	}
+
+	found := err == nil
+	expired := v.Expires <= time.Now().Unix()
+
+	if !found || expired || subtle.ConstantTimeCompare([]byte(v.Code), []byte(code)) != 1 {
+		if found {
+			if v.Attempts++; expired || v.Attempts >= maxEmailCodeAttempts {
+				err = ls.storage.DeleteEmailVerification(ctx, user.EtsyUserID)
+			} else {
+				err = ls.storage.SaveEmailVerification(ctx, v)
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to save email verification: %w", err)
+			}
+		}
+
+		if err := ls.messenger.SendTextMessage(msgs.emailBadCode, chatID); err != nil {
+			return fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		return ErrBadArguments
+	}
+
+	user.Email = v.Address
+	user.EmailChatID = chatID
+	if err := ls.storage.SaveUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to save User record: %w", err)
+	}
+
+	if err := ls.storage.DeleteEmailVerification(ctx, user.EtsyUserID); err != nil {
+		return fmt.Errorf("failed to delete email verification: %w", err)
+	}
+
+	msg := fmt.Sprintf(msgs.emailVerified, html.EscapeString(user.Email))
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) removeEmail(ctx context.Context, msgs *bundle, user User, chatID int64) error {
+	user.Email = ""
+	user.EmailChatID = 0
+	if err := ls.storage.SaveUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to save User record: %w", err)
+	}
+
+	if err := ls.storage.DeleteEmailVerification(ctx, user.EtsyUserID); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to delete email verification: %w", err)
+	}
+
+	if err := ls.messenger.SendTextMessage(msgs.emailOff, chatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package lowstock
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestToMail(t *testing.T) {
+	msg := Message{
+		Text: "<b>Sold out:</b> Mug &amp; cup\nShop: <a href=\"https://www.etsy.com/shop/MugShop\">MugShop</a>",
+		Buttons: [][]Button{
+			[]Button{Button{Text: "Open listing", URL: "https://www.etsy.com/listing/42"}},
+			[]Button{Button{Text: "Mark restocked", Data: "/restocked 42 #7"}},
+		},
+	}
+
+	expected := Mail{
+		Subject: "Sold out: Mug & cup",
+		Text:    "Sold out: Mug & cup\nShop: MugShop (https://www.etsy.com/shop/MugShop)\nOpen listing: https://www.etsy.com/listing/42\n",
+		HTML: "<!DOCTYPE html>\n<html><body>\n" +
+			"<b>Sold out:</b> Mug &amp; cup<br>\nShop: <a href=\"https://www.etsy.com/shop/MugShop\">MugShop</a>" +
+			"<br>\n<a href=\"https://www.etsy.com/listing/42\">Open listing</a>\n</body></html>\n",
+	}
+
+	if diff := cmp.Diff(expected, toMail(msg)); diff != "" {
+		t.Errorf("Mail does not match:\n%s", diff)
+	}
+}
+
+func TestDoEmail(t *testing.T) {
+	user := User{EtsyUserID: 5432}
+	var verification *EmailVerification
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID, Selected: true}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return user, nil
+		},
+		SaveUserFunc: func(ctx context.Context, u User) error {
+			user = u
+			return nil
+		},
+		EmailVerificationFunc: func(ctx context.Context, etsyUserID int64) (EmailVerification, error) {
+			if verification == nil {
+				return EmailVerification{}, ErrNotFound
+			}
+
+			return *verification, nil
+		},
+		SaveEmailVerificationFunc: func(ctx context.Context, v EmailVerification) error {
+			verification = &v
+			return nil
+		},
+		DeleteEmailVerificationFunc: func(ctx context.Context, etsyUserID int64) error {
+			if verification == nil {
+				return ErrNotFound
+			}
+
+			verification = nil
+			return nil
+		},
+	}
+
+	var sent []string
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			sent = append(sent, msg)
+			return nil
+		},
+	}
+
+	var mails []Mail
+	mailer := &MailerMock{
+		SendMailFunc: func(to string, mail Mail) error {
+			if to != "books@example.com" {
+				t.Errorf("Unexpected recipient: %q", to)
+			}
+
+			mails = append(mails, mail)
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+	ls.SetMailer(mailer)
+	ctx := context.Background()
+
+	do := func(text string) error {
+		return ls.DoEmail(ctx, MessengerUpdate{ChatID: 42, Command: "/email", Text: text})
+	}
+
+	if err := do("/email books@example.com"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := do("/email books@example.com"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if verification == nil || len(mails) != 2 {
+		t.Fatalf("Expected a confirmation code to be sent, got verification: %+v, mails: %+v", verification, mails)
+	}
+
+	code := verification.Code
+	if expected := "Lowstock confirmation code: " + code; mails[1].Subject != expected {
+		t.Errorf("Got subject: %q, expected: %q", mails[1].Subject, expected)
+	}
+
+	if err := do("/email verify 0000000"); err != ErrBadArguments {
+		t.Errorf("Got error: %v, expected: %v", err, ErrBadArguments)
+	}
+
+	if user.Email != "" || verification.Attempts != 1 {
+		t.Errorf("Wrong code is accepted, user: %+v, verification: %+v", user, verification)
+	}
+
+	if err := do("/email verify " + code); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if user.Email != "books@example.com" || user.EmailChatID != 42 || verification != nil {
+		t.Errorf("Address is not verified, user: %+v, verification: %+v", user, verification)
+	}
+
+	if err := do("/email"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.Contains(sent[len(sent)-1], "books@example.com") {
+		t.Errorf("Unexpected message: %q", sent[len(sent)-1])
+	}
+
+	if err := do("/email off"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if user.Email != "" || user.EmailChatID != 0 {
+		t.Errorf("Email is not removed: %+v", user)
+	}
+}
+
+func TestVerifyEmailAttempts(t *testing.T) {
+	verification := &EmailVerification{EtsyUserID: 5432, Address: "books@example.com", Code: "123456", Expires: time.Now().Add(time.Hour).Unix()}
+
+	storage := &StorageMock{
+		EmailVerificationFunc: func(ctx context.Context, etsyUserID int64) (EmailVerification, error) {
+			if verification == nil {
+				return EmailVerification{}, ErrNotFound
+			}
+
+			return *verification, nil
+		},
+		SaveEmailVerificationFunc: func(ctx context.Context, v EmailVerification) error {
+			verification = &v
+			return nil
+		},
+		DeleteEmailVerificationFunc: func(ctx context.Context, etsyUserID int64) error {
+			verification = nil
+			return nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	for i := 0; i < maxEmailCodeAttempts; i++ {
+		if err := ls.verifyEmail(context.Background(), &enBundle, User{EtsyUserID: 5432}, "000000", 42); err != ErrBadArguments {
+			t.Fatalf("Got error: %v, expected: %v", err, ErrBadArguments)
+		}
+	}
+
+	if verification != nil {
+		t.Errorf("Code is kept after %d wrong attempts", maxEmailCodeAttempts)
+	}
+}
+
+func TestEmailAlert(t *testing.T) {
+	now := time.Date(2020, 5, 20, 23, 0, 0, 0, time.UTC)
+
+	var queued []OutboxMessage
+	storage := &StorageMock{
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			queued = append(queued, msg)
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+	ctx := context.Background()
+
+	data := newAlertData(alertSoldOut, Update{Title: "Mug", ShopName: "MugShop", ListingID: 42}, nil)
+	subs := []Subscription{
+		Subscription{ChatID: 10},
+		Subscription{ChatID: 20, Locale: "de", Quiet: quietDefer, QuietFrom: 22 * 60, QuietTo: 7 * 60},
+	}
+	user := User{EtsyUserID: 5432, Email: "books@example.com", EmailChatID: 20}
+
+	// Without a mailer, without an address or without the chat of the address nothing is queued.
+	for _, u := range []User{user, User{EtsyUserID: 5432}, User{EtsyUserID: 5432, Email: "books@example.com", EmailChatID: 30}} {
+		if err := ls.emailAlert(ctx, u, subs, data, now); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		ls.SetMailer(&MailerMock{})
+	}
+
+	if len(queued) != 0 {
+		t.Fatalf("Unexpected emails: %+v", queued)
+	}
+
+	if err := ls.emailAlert(ctx, user, subs, data, now); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Addresses verified before chats were recorded follow the first chat.
+	if err := ls.emailAlert(ctx, User{EtsyUserID: 5432, Email: "books@example.com"}, subs, data, now); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(queued) != 2 {
+		t.Fatalf("Unexpected emails: %+v", queued)
+	}
+
+	// Email is held back until quiet hours of the chat end.
+	email := queued[0]
+	if email.Email != "books@example.com" || email.ChatID != 20 || email.EtsyUserID != 5432 ||
+		!email.NextAttempt.Equal(time.Date(2020, 5, 21, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected email: %+v", email)
+	}
+
+	if subject := toMail(email.Message).Subject; subject != "Ausverkauft: Mug" {
+		t.Errorf("Got subject: %q, expected: %q", subject, "Ausverkauft: Mug")
+	}
+
+	if queued[1].ChatID != 10 || !queued[1].NextAttempt.Equal(now) {
+		t.Errorf("Unexpected email: %+v", queued[1])
+	}
+}
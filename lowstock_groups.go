@@ -0,0 +1,62 @@
+package lowstock
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	chatGroup      = "group"
+	chatSupergroup = "supergroup"
+)
+
+func isGroup(msgUpdate MessengerUpdate) bool {
+	return msgUpdate.ChatType == chatGroup || msgUpdate.ChatType == chatSupergroup
+}
+
+// authorize allows sensitive commands in groups only to the member who linked the shop and to group admins.
+// The chat is told when the command is not allowed.
+func (ls *LowStock) authorize(ctx context.Context, msgUpdate MessengerUpdate, sub Subscription) error {
+	if !isGroup(msgUpdate) {
+		return nil
+	}
+
+	if sub.ChatUserID != 0 && sub.ChatUserID == msgUpdate.UserID {
+		return nil
+	}
+
+	admin, err := ls.messenger.IsChatAdmin(msgUpdate.ChatID, msgUpdate.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check chat admin: %w", err)
+	}
+
+	if admin {
+		return nil
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	if err := ls.messenger.SendTextMessage(msgs.adminOnly, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return ErrForbidden
+}
+
+// authorizeLink checks that the member may link a shop to the chat.
+func (ls *LowStock) authorizeLink(ctx context.Context, msgUpdate MessengerUpdate) error {
+	if !isGroup(msgUpdate) {
+		return nil
+	}
+
+	subs, err := ls.storage.ChatSubscriptions(ctx, msgUpdate.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat subscriptions: %w", err)
+	}
+
+	sub := Subscription{}
+	if len(subs) > 0 {
+		sub = selectedSubscription(subs)
+	}
+
+	return ls.authorize(ctx, msgUpdate, sub)
+}
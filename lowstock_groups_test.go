@@ -0,0 +1,141 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGroupCommandsRequireAdminOrLinker(t *testing.T) {
+	tests := []struct {
+		name     string
+		chatType string
+		userID   int64
+		admin    bool
+		expected error
+	}{
+		{name: "private chat", chatType: "private", userID: 2},
+		{name: "linker", chatType: chatGroup, userID: 1},
+		{name: "admin", chatType: chatSupergroup, userID: 2, admin: true},
+		{name: "member", chatType: chatGroup, userID: 2, expected: ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := false
+
+			storage := &StorageMock{
+				ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+					return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID, ChatUserID: 1}}, nil
+				},
+				UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+					return User{EtsyUserID: etsyUserID}, nil
+				},
+				SaveUserFunc: func(ctx context.Context, user User) error {
+					saved = true
+					return nil
+				},
+			}
+
+			var reply string
+			messenger := &MessengerMock{
+				IsChatAdminFunc: func(chatID, userID int64) (bool, error) {
+					return tt.admin, nil
+				},
+				SendTextMessageFunc: func(msg string, chatID int64) error {
+					reply = msg
+					return nil
+				},
+			}
+
+			ls := New(&EtsyMock{}, messenger, storage)
+
+			update := MessengerUpdate{Command: "/threshold", Text: "/threshold 3", ChatID: -100, UserID: tt.userID, ChatType: tt.chatType}
+			if err := ls.DoThreshold(context.Background(), update); !errors.Is(err, tt.expected) {
+				t.Fatalf("Got error: %v, expected: %v", err, tt.expected)
+			}
+
+			if saved != (tt.expected == nil) {
+				t.Errorf("Got threshold saved: %t, expected: %t", saved, tt.expected == nil)
+			}
+
+			if tt.expected != nil && reply != adminOnlyMsg {
+				t.Errorf("Unexpected reply: %s", reply)
+			}
+		})
+	}
+}
+
+func TestGroupPinRequiresAdmin(t *testing.T) {
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return nil, nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		IsChatAdminFunc: func(chatID, userID int64) (bool, error) {
+			return false, nil
+		},
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	update := MessengerUpdate{Command: "/pin", Text: "/pin 42", ChatID: -100, UserID: 2, ChatType: chatGroup}
+	if err := ls.DoPin(context.Background(), update); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrForbidden)
+	}
+}
+
+func TestGroupSettingsRequireAdminOrLinker(t *testing.T) {
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID, ChatUserID: 1}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		IsChatAdminFunc: func(chatID, userID int64) (bool, error) {
+			return false, nil
+		},
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	tests := []struct {
+		text string
+		do   func(context.Context, MessengerUpdate) error
+	}{
+		{text: "/watch 42 3", do: ls.DoWatch},
+		{text: "/unwatch 42", do: ls.DoUnwatch},
+		{text: "/template set {{.Title}}", do: ls.DoTemplate},
+		{text: "/template reset", do: ls.DoTemplate},
+		{text: "/notify expired on", do: ls.DoNotify},
+		{text: "/stop", do: ls.DoStop},
+		{text: "/resume", do: ls.DoResume},
+		{text: "/digest daily 08:00 only", do: ls.DoDigest},
+		{text: "/quiet 22:00 07:00", do: ls.DoQuiet},
+		{text: "/snooze 2h", do: ls.DoSnooze},
+		{text: "/snooze off", do: ls.DoSnooze},
+		{text: "/language de", do: ls.DoLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			update := MessengerUpdate{Command: strings.Fields(tt.text)[0], Text: tt.text, ChatID: -100, UserID: 2, ChatType: chatGroup}
+			if err := tt.do(context.Background(), update); !errors.Is(err, ErrForbidden) {
+				t.Errorf("Got error: %v, expected: %v", err, ErrForbidden)
+			}
+		})
+	}
+}
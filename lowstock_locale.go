@@ -0,0 +1,376 @@
+package lowstock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const defaultLocale = "en"
+
+// bundle holds user facing texts of a single locale.
+type bundle struct {
+	// Language name in the language itself.
+	name string
+
+	help           string
+	start          string
+	success        string
+	emptyPin       string
+	notLinked      string
+	threshold      string
+	thresholdUsage string
+
+	watch         string
+	unwatch       string
+	watchNotFound string
+	watchUsage    string
+	watches       string
+	noWatches     string
+	listingName   string
+	skuName       string
+
+	notify      string
+	notifyUsage string
+	on          string
+	off         string
+
+	template        string
+	templateDefault string
+	templateSaved   string
+	templateReset   string
+	templateError   string
+	templateUsage   string
+
+	language      string
+	languageUsage string
+
+	stop       string
+	resume     string
+	logout     string
+	logoutChat string
+
+	adminOnly string
+
+	shops       string
+	shopsUsage  string
+	unnamedShop string
+
+	status      string
+	never       string
+	tokenOK     string
+	tokenBroken string
+
+	stock        string
+	stockEmpty   string
+	stockUsage   string
+	stockSoldOut string
+	stockLow     string
+
+	digest         string
+	digestOff      string
+	digestUsage    string
+	digestDaily    string
+	digestWeekly   string
+	digestTitle    string
+	digestSoldOut  string
+	digestBack     string
+	digestLowStock string
+	digestItem     string
+	digestBackItem string
+	digestEmpty    string
+
+	quiet       string
+	quietOff    string
+	quietUsage  string
+	quietDefer  string
+	quietSilent string
+	snooze      string
+	snoozeOff   string
+	snoozeUsage string
+	deferred    string
+
+	mute            string
+	muteUntil       string
+	unmute          string
+	muteNotFound    string
+	muteUsage       string
+	mutes           string
+	noMutes         string
+	muteItem        string
+	muteItemUntil   string
+	restocked       string
+	restockedUsage  string
+	listingNotFound string
+
+	email         string
+	emailUnset    string
+	emailUsage    string
+	emailCode     string
+	emailCodeSent string
+	emailVerified string
+	emailBadCode  string
+	emailFailed   string
+	emailOff      string
+	emailDisabled string
+
+	webhooks        string
+	noWebhooks      string
+	webhookItem     string
+	webhookNever    string
+	webhookLog      string
+	webhookLogItem  string
+	webhookLogEmpty string
+	webhookAdded    string
+	webhookRemoved  string
+	webhookNotFound string
+	webhookTest     string
+	webhookLimit    string
+	webhookPrivate  string
+	webhookUsage    string
+
+	openListing   string
+	editListing   string
+	snoozeListing string
+	muteSKU       string
+	markRestocked string
+
+	// Built-in alert templates, one define per alert kind.
+	alerts     string
+	alertsTmpl *template.Template
+}
+
+var enBundle = bundle{
+	name:            "English",
+	help:            helpMsg,
+	start:           startMsg,
+	success:         successMsg,
+	emptyPin:        emptyPinMsg,
+	notLinked:       notLinkedMsg,
+	threshold:       thresholdMsg,
+	thresholdUsage:  thresholdUsageMsg,
+	watch:           watchMsg,
+	unwatch:         unwatchMsg,
+	watchNotFound:   watchNotFoundMsg,
+	watchUsage:      watchUsageMsg,
+	watches:         watchesMsg,
+	noWatches:       noWatchesMsg,
+	listingName:     listingName,
+	skuName:         skuName,
+	notify:          notifyMsg,
+	notifyUsage:     notifyUsageMsg,
+	on:              onText,
+	off:             offText,
+	template:        templateMsg,
+	templateDefault: templateDefaultMsg,
+	templateSaved:   templateSavedMsg,
+	templateReset:   templateResetMsg,
+	templateError:   templateErrorMsg,
+	templateUsage:   templateUsageMsg,
+	language:        languageMsg,
+	languageUsage:   languageUsageMsg,
+	stop:            stopMsg,
+	resume:          resumeMsg,
+	logout:          logoutMsg,
+	logoutChat:      logoutChatMsg,
+	adminOnly:       adminOnlyMsg,
+	shops:           shopsMsg,
+	shopsUsage:      shopsUsageMsg,
+	unnamedShop:     unnamedShopText,
+	status:          statusMsg,
+	never:           neverText,
+	tokenOK:         tokenOKText,
+	tokenBroken:     tokenBrokenText,
+	stock:           stockMsg,
+	stockEmpty:      stockEmptyMsg,
+	stockUsage:      stockUsageMsg,
+	stockSoldOut:    stockSoldOutText,
+	stockLow:        stockLowText,
+	digest:          digestMsg,
+	digestOff:       digestOffMsg,
+	digestUsage:     digestUsageMsg,
+	digestDaily:     digestDailyText,
+	digestWeekly:    digestWeeklyText,
+	digestTitle:     digestTitleMsg,
+	digestSoldOut:   digestSoldOutText,
+	digestBack:      digestBackText,
+	digestLowStock:  digestLowStockText,
+	digestItem:      digestItemText,
+	digestBackItem:  digestBackItemText,
+	digestEmpty:     digestEmptyMsg,
+	quiet:           quietMsg,
+	quietOff:        quietOffMsg,
+	quietUsage:      quietUsageMsg,
+	quietDefer:      quietDeferText,
+	quietSilent:     quietSilentText,
+	snooze:          snoozeMsg,
+	snoozeOff:       snoozeOffMsg,
+	snoozeUsage:     snoozeUsageMsg,
+	deferred:        deferredMsg,
+	mute:            muteMsg,
+	muteUntil:       muteUntilMsg,
+	unmute:          unmuteMsg,
+	muteNotFound:    muteNotFoundMsg,
+	muteUsage:       muteUsageMsg,
+	mutes:           mutesMsg,
+	noMutes:         noMutesMsg,
+	muteItem:        muteItemText,
+	muteItemUntil:   muteItemUntilText,
+	restocked:       restockedMsg,
+	restockedUsage:  restockedUsageMsg,
+	listingNotFound: listingNotFoundMsg,
+	email:           emailMsg,
+	emailUnset:      emailUnsetMsg,
+	emailUsage:      emailUsageMsg,
+	emailCode:       emailCodeMsg,
+	emailCodeSent:   emailCodeSentMsg,
+	emailVerified:   emailVerifiedMsg,
+	emailBadCode:    emailBadCodeMsg,
+	emailFailed:     emailFailedMsg,
+	emailOff:        emailOffMsg,
+	emailDisabled:   emailDisabledMsg,
+	webhooks:        webhooksMsg,
+	noWebhooks:      noWebhooksMsg,
+	webhookItem:     webhookItemText,
+	webhookNever:    webhookNeverText,
+	webhookLog:      webhookLogMsg,
+	webhookLogItem:  webhookLogItemText,
+	webhookLogEmpty: webhookLogEmptyMsg,
+	webhookAdded:    webhookAddedMsg,
+	webhookRemoved:  webhookRemovedMsg,
+	webhookNotFound: webhookNotFoundMsg,
+	webhookTest:     webhookTestMsg,
+	webhookLimit:    webhookLimitMsg,
+	webhookPrivate:  webhookPrivateMsg,
+	webhookUsage:    webhookUsageMsg,
+	openListing:     openListingText,
+	editListing:     editListingText,
+	snoozeListing:   snoozeListingText,
+	muteSKU:         muteSKUText,
+	markRestocked:   markRestockedText,
+	alerts:          alertsTmpl,
+}
+
+// Message catalog, keyed by ISO 639-1 language code.
+var bundles = map[string]*bundle{
+	"en": &enBundle,
+	"de": &deBundle,
+	"uk": &ukBundle,
+}
+
+func init() {
+	for code, b := range bundles {
+		b.alertsTmpl = template.Must(template.New(code).Funcs(alertFuncs).Parse(b.alerts))
+	}
+}
+
+// locale returns the supported locale of a language tag, "de-AT" is "de".
+func locale(code string) (string, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+
+	_, ok := bundles[code]
+	return code, ok
+}
+
+// messages returns the bundle of the first supported locale, English is the fallback.
+func messages(codes ...string) *bundle {
+	for _, code := range codes {
+		if l, ok := locale(code); ok {
+			return bundles[l]
+		}
+	}
+
+	return bundles[defaultLocale]
+}
+
+func (b *bundle) onOff(v bool) string {
+	if v {
+		return b.on
+	}
+
+	return b.off
+}
+
+func (b *bundle) watchName(w Watch) string {
+	if w.SKU != "" {
+		return fmt.Sprintf(b.skuName, w.SKU)
+	}
+
+	return fmt.Sprintf(b.listingName, w.ListingID)
+}
+
+// availableLocales lists supported locales, e.g. "de (Deutsch)".
+func availableLocales() string {
+	codes := make([]string, 0, len(bundles))
+	for code := range bundles {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	list := make([]string, 0, len(codes))
+	for _, code := range codes {
+		list = append(list, fmt.Sprintf("<code>%s</code> (%s)", code, bundles[code].name))
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// chatMessages returns the bundle for the chat, the locale of a linked shop goes first.
+func (ls *LowStock) chatMessages(ctx context.Context, msgUpdate MessengerUpdate) *bundle {
+	subs, err := ls.storage.ChatSubscriptions(ctx, msgUpdate.ChatID)
+	if err != nil {
+		log.Printf("Failed to get chat subscriptions, using Telegram language: %s", err)
+	}
+
+	if len(subs) > 0 {
+		return messages(subs[0].Locale, msgUpdate.LanguageCode)
+	}
+
+	return messages(msgUpdate.LanguageCode)
+}
+
+func (ls *LowStock) DoLanguage(ctx context.Context, msgUpdate MessengerUpdate) error {
+	_, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	args := commandArgs(msgUpdate)
+	if len(args) > 0 {
+		code, ok := locale(args[0])
+		if !ok || len(args) > 1 {
+			msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+			msg := fmt.Sprintf(msgs.languageUsage, availableLocales())
+			if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send language usage: %w", err)
+			}
+
+			return ErrBadArguments
+		}
+
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		if err := ls.updateChatSubscriptions(ctx, msgUpdate.ChatID, func(s *Subscription) {
+			s.Locale = code
+		}); err != nil {
+			return err
+		}
+		sub.Locale = code
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	msg := fmt.Sprintf(msgs.language, msgs.name, availableLocales())
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send language: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessages(t *testing.T) {
+	testCases := []struct {
+		codes    []string
+		expected *bundle
+	}{
+		{codes: nil, expected: &enBundle},
+		{codes: []string{"de"}, expected: &deBundle},
+		{codes: []string{"de-AT"}, expected: &deBundle},
+		{codes: []string{"UK"}, expected: &ukBundle},
+		{codes: []string{"fr", "uk"}, expected: &ukBundle},
+		{codes: []string{"", "de"}, expected: &deBundle},
+		{codes: []string{"uk", "de"}, expected: &ukBundle},
+		{codes: []string{"pt-BR"}, expected: &enBundle},
+	}
+
+	for _, tc := range testCases {
+		if actual := messages(tc.codes...); actual != tc.expected {
+			t.Errorf("Got %s bundle for %q, expected: %s", actual.name, tc.codes, tc.expected.name)
+		}
+	}
+}
+
+// Every bundle has all texts with the same format verbs as the English one.
+func TestBundlesComplete(t *testing.T) {
+	en := reflect.ValueOf(enBundle)
+
+	for code, b := range bundles {
+		v := reflect.ValueOf(*b)
+
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).Kind() != reflect.String {
+				continue
+			}
+
+			name := v.Type().Field(i).Name
+			text, enText := v.Field(i).String(), en.Field(i).String()
+
+			if text == "" {
+				t.Errorf("Bundle %s: %s is empty", code, name)
+			}
+
+			for _, verb := range []string{"%d", "%s"} {
+				if strings.Count(text, verb) != strings.Count(enText, verb) {
+					t.Errorf("Bundle %s: %s has different number of %s verbs", code, name, verb)
+				}
+			}
+		}
+	}
+}
+
+func TestDoLanguage(t *testing.T) {
+	var (
+		subs = []Subscription{
+			Subscription{EtsyUserID: 5432, ChatID: 42, Selected: true},
+			Subscription{EtsyUserID: 5433, ChatID: 42},
+		}
+		saved = map[int64]Subscription{}
+		reply string
+	)
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return subs, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			saved[sub.EtsyUserID] = sub
+			return nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			reply = msg
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	update := MessengerUpdate{Command: "/language", Text: "/language uk", ChatID: 42, LanguageCode: "en"}
+	if err := ls.DoLanguage(context.Background(), update); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, sub := range subs {
+		if l := saved[sub.EtsyUserID].Locale; l != "uk" {
+			t.Errorf("Got locale: %q of shop %d, expected: %q", l, sub.EtsyUserID, "uk")
+		}
+	}
+
+	if !strings.Contains(reply, ukBundle.name) {
+		t.Errorf("Reply is not in Ukrainian: %s", reply)
+	}
+
+	update.Text = "/language fr"
+	if err := ls.DoLanguage(context.Background(), update); !errors.Is(err, ErrBadArguments) {
+		t.Errorf("Got error: %v, expected: %s", err, ErrBadArguments)
+	}
+}
+
+func TestRenderUserAlertLocale(t *testing.T) {
+	data := newAlertData(alertSoldOut, Update{Title: "Tasse", ListingID: 42}, nil)
+
+	msg, err := renderUserAlert(User{}, Subscription{Locale: "de"}, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(msg.Text, "<b>Ausverkauft:</b> Tasse") {
+		t.Errorf("Unexpected alert text: %s", msg.Text)
+	}
+
+	if msg.Buttons[0][0].Text != deBundle.openListing {
+		t.Errorf("Got button: %q, expected: %q", msg.Buttons[0][0].Text, deBundle.openListing)
+	}
+}
@@ -0,0 +1,349 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// Listings are muted this long by the snooze button of alerts.
+	listingSnooze = "24h"
+
+	// Telegram drops buttons with longer callback data.
+	maxButtonData = 64
+)
+
+var mutedAlertsCounter = metrics.NewCounter(`alerts_muted_total`)
+
+// Mute silences alerts of a listing or SKU until Until, for good when Until is zero.
+// Exactly one of ListingID and SKU is set.
+type Mute struct {
+	EtsyUserID int64
+	ListingID  int64
+	SKU        string
+	Until      int64
+}
+
+func (m Mute) active(now time.Time) bool {
+	return m.Until == 0 || m.Until > now.Unix()
+}
+
+func (m Mute) watch() Watch {
+	return Watch{EtsyUserID: m.EtsyUserID, ListingID: m.ListingID, SKU: m.SKU}
+}
+
+func muteTarget(etsyUserID int64, arg string) Mute {
+	w := watchTarget(etsyUserID, arg)
+	return Mute{EtsyUserID: w.EtsyUserID, ListingID: w.ListingID, SKU: w.SKU}
+}
+
+// mutedListing reports whether alerts of the listing are muted.
+// SKU mutes apply once every SKU of the listing is muted.
+func mutedListing(mutes []Mute, listingID int64, listingSKUs []string, now time.Time) bool {
+	skus := map[string]bool{}
+	for _, m := range mutes {
+		if !m.active(now) {
+			continue
+		}
+
+		if m.SKU == "" && m.ListingID == listingID {
+			return true
+		}
+		skus[m.SKU] = m.SKU != ""
+	}
+
+	for _, sku := range listingSKUs {
+		if !skus[sku] {
+			return false
+		}
+	}
+
+	return len(listingSKUs) > 0
+}
+
+func (ls *LowStock) muted(ctx context.Context, etsyUserID, listingID int64, listingSKUs []string) (bool, error) {
+	mutes, err := ls.storage.Mutes(ctx, etsyUserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get mutes: %w", err)
+	}
+
+	return mutedListing(mutes, listingID, listingSKUs, time.Now()), nil
+}
+
+// shopArg is added to commands of alert buttons, so they apply to the shop of the alert.
+func shopArg(etsyUserID int64) string {
+	return "#" + strconv.FormatInt(etsyUserID, 10)
+}
+
+// actionButtons snooze and mute the listing of the alert and mark it restocked.
+func actionButtons(msgs *bundle, data AlertData) []Button {
+	shop := shopArg(data.UserID)
+
+	buttons := []Button{
+		Button{Text: msgs.snoozeListing, Data: fmt.Sprintf("/mute %d %s %s", data.ListingID, listingSnooze, shop)},
+	}
+
+	// Listings with several SKUs would need a button per SKU.
+	if len(data.SKUs) == 1 {
+		if cmd := fmt.Sprintf("/mute %s%s %s", skuPrefix, data.SKUs[0], shop); len(cmd) <= maxButtonData && !strings.ContainsAny(data.SKUs[0], " \t\n") {
+			buttons = append(buttons, Button{Text: msgs.muteSKU, Data: cmd})
+		}
+	}
+
+	if data.Kind == alertSoldOut || data.Kind == alertLowStock {
+		buttons = append(buttons, Button{Text: msgs.markRestocked, Data: fmt.Sprintf("/restocked %d %s", data.ListingID, shop)})
+	}
+
+	return buttons
+}
+
+// shopUser is chatUser for commands that may name the shop with shopArg as the last argument.
+// The shop argument is removed from args.
+func (ls *LowStock) shopUser(ctx context.Context, msgUpdate MessengerUpdate, args []string) (User, Subscription, []string, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[len(args)-1], "#") {
+		user, sub, err := ls.chatUser(ctx, msgUpdate)
+		return user, sub, args, err
+	}
+
+	etsyUserID, err := strconv.ParseInt(strings.TrimPrefix(args[len(args)-1], "#"), 10, 64)
+	if err != nil {
+		return User{}, Subscription{}, nil, ErrBadArguments
+	}
+	args = args[:len(args)-1]
+
+	subs, err := ls.storage.ChatSubscriptions(ctx, msgUpdate.ChatID)
+	if err != nil {
+		return User{}, Subscription{}, nil, fmt.Errorf("failed to get chat subscriptions: %w", err)
+	}
+
+	for _, sub := range subs {
+		if sub.EtsyUserID != etsyUserID {
+			continue
+		}
+
+		user, err := ls.storage.User(ctx, sub.EtsyUserID)
+		if err != nil {
+			return User{}, Subscription{}, nil, fmt.Errorf("failed to get User record: %w", err)
+		}
+
+		return user, sub, args, nil
+	}
+
+	msgs := messages(msgUpdate.LanguageCode)
+	if err := ls.messenger.SendTextMessage(msgs.notLinked, msgUpdate.ChatID); err != nil {
+		return User{}, Subscription{}, nil, fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return User{}, Subscription{}, nil, ErrNotFound
+}
+
+func (ls *LowStock) sendMuteUsage(msgs *bundle, chatID int64) error {
+	if err := ls.messenger.SendTextMessage(msgs.muteUsage, chatID); err != nil {
+		return fmt.Errorf("failed to send mute usage: %w", err)
+	}
+
+	return ErrBadArguments
+}
+
+// DoMute lists mutes of the shop or mutes a listing or SKU, for a while when a duration is given.
+func (ls *LowStock) DoMute(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, args, err := ls.shopUser(ctx, msgUpdate, commandArgs(msgUpdate))
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	if len(args) == 0 {
+		return ls.sendMutes(ctx, msgs, user, loc, msgUpdate.ChatID)
+	}
+
+	if len(args) > 2 {
+		return ls.sendMuteUsage(msgs, msgUpdate.ChatID)
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	mute := muteTarget(user.EtsyUserID, args[0])
+	if len(args) == 2 {
+		d, err := parseSnooze(args[1])
+		if err != nil {
+			return ls.sendMuteUsage(msgs, msgUpdate.ChatID)
+		}
+		mute.Until = time.Now().Add(d).Unix()
+	}
+
+	if err := ls.storage.SaveMute(ctx, mute); err != nil {
+		return fmt.Errorf("failed to save mute: %w", err)
+	}
+
+	name := html.EscapeString(msgs.watchName(mute.watch()))
+
+	msg := fmt.Sprintf(msgs.mute, name)
+	if mute.Until != 0 {
+		msg = fmt.Sprintf(msgs.muteUntil, name, time.Unix(mute.Until, 0).In(loc).Format(statusTimeFormat))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) sendMutes(ctx context.Context, msgs *bundle, user User, loc *time.Location, chatID int64) error {
+	mutes, err := ls.storage.Mutes(ctx, user.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get mutes: %w", err)
+	}
+
+	now := time.Now()
+
+	lines := []string{}
+	for _, m := range mutes {
+		if !m.active(now) {
+			continue
+		}
+
+		name := html.EscapeString(msgs.watchName(m.watch()))
+		if m.Until == 0 {
+			lines = append(lines, fmt.Sprintf(msgs.muteItem, name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(msgs.muteItemUntil, name, time.Unix(m.Until, 0).In(loc).Format(statusTimeFormat)))
+	}
+
+	msg := msgs.noMutes
+	if len(lines) > 0 {
+		msg = fmt.Sprintf(msgs.mutes, strings.Join(lines, "\n"))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send mutes: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) DoUnmute(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, args, err := ls.shopUser(ctx, msgUpdate, commandArgs(msgUpdate))
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	if len(args) != 1 {
+		return ls.sendMuteUsage(msgs, msgUpdate.ChatID)
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	mute := muteTarget(user.EtsyUserID, args[0])
+	name := html.EscapeString(msgs.watchName(mute.watch()))
+
+	msg := fmt.Sprintf(msgs.unmute, name)
+	if err := ls.storage.DeleteMute(ctx, mute); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to delete mute: %w", err)
+		}
+		msg = fmt.Sprintf(msgs.muteNotFound, name)
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+// resetLowStock clears the low stock flag of the listing of the user, found is false for listings of other users.
+// The listing is locked like in handleListingUpdate, so a concurrent update is not overwritten.
+func (ls *LowStock) resetLowStock(ctx context.Context, etsyUserID, listingID int64) (bool, error) {
+	mu := &ls.listingMu[uint64(listingID)%listingLocks]
+	mu.Lock()
+	defer mu.Unlock()
+
+	state, err := ls.storage.ListingState(ctx, listingID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get Listing state: %w", err)
+	}
+
+	if state.EtsyUserID != etsyUserID {
+		return false, nil
+	}
+
+	state.LowStock = false
+	if err := ls.storage.SaveListingState(ctx, state); err != nil {
+		return false, fmt.Errorf("failed to save Listing state: %w", err)
+	}
+
+	return true, nil
+}
+
+// DoRestocked forgets that the listing is low on stock, the next drop under the threshold alerts again.
+func (ls *LowStock) DoRestocked(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, args, err := ls.shopUser(ctx, msgUpdate, commandArgs(msgUpdate))
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	var listingID int64
+	if len(args) == 1 {
+		listingID, err = strconv.ParseInt(args[0], 10, 64)
+	}
+
+	if len(args) != 1 || err != nil || listingID <= 0 {
+		if err := ls.messenger.SendTextMessage(msgs.restockedUsage, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send restocked usage: %w", err)
+		}
+
+		return ErrBadArguments
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	found, err := ls.resetLowStock(ctx, user.EtsyUserID, listingID)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		msg := fmt.Sprintf(msgs.listingNotFound, listingID)
+		if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		return ErrNotFound
+	}
+
+	msg := fmt.Sprintf(msgs.restocked, html.EscapeString(msgs.watchName(Watch{ListingID: listingID})))
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package lowstock
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMutedListing(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		mutes    []Mute
+		skus     []string
+		expected bool
+	}{
+		{
+			name:     "listing",
+			mutes:    []Mute{Mute{ListingID: 42}},
+			expected: true,
+		},
+		{
+			name:  "other listing",
+			mutes: []Mute{Mute{ListingID: 7}},
+			skus:  []string{"MUG-RED"},
+		},
+		{
+			name:  "expired",
+			mutes: []Mute{Mute{ListingID: 42, Until: now.Add(-time.Minute).Unix()}},
+		},
+		{
+			name:     "snoozed",
+			mutes:    []Mute{Mute{ListingID: 42, Until: now.Add(time.Hour).Unix()}},
+			expected: true,
+		},
+		{
+			name:     "every SKU",
+			mutes:    []Mute{Mute{SKU: "MUG-RED"}, Mute{SKU: "MUG-BLUE"}},
+			skus:     []string{"MUG-RED", "MUG-BLUE"},
+			expected: true,
+		},
+		{
+			name:  "some SKUs",
+			mutes: []Mute{Mute{SKU: "MUG-RED"}},
+			skus:  []string{"MUG-RED", "MUG-BLUE"},
+		},
+	}
+
+	for _, tt := range tests {
+		if actual := mutedListing(tt.mutes, 42, tt.skus, now); actual != tt.expected {
+			t.Errorf("Got muted: %t for %s, expected: %t", actual, tt.name, tt.expected)
+		}
+	}
+}
+
+func TestActionButtons(t *testing.T) {
+	data := newAlertData(alertRestocked, Update{ListingID: 42, UserID: 5432}, []string{"MUG-RED"})
+
+	expected := []Button{
+		Button{Text: "Snooze this listing", Data: "/mute 42 24h #5432"},
+		Button{Text: "Mute SKU", Data: "/mute sku:MUG-RED #5432"},
+	}
+
+	if diff := cmp.Diff(expected, actionButtons(&enBundle, data)); diff != "" {
+		t.Errorf("Buttons do not match:\n%s", diff)
+	}
+
+	// Callback data is limited to 64 bytes.
+	data.SKUs = []string{strings.Repeat("X", 60)}
+	if buttons := actionButtons(&enBundle, data); len(buttons) != 1 {
+		t.Errorf("Got %d buttons for a long SKU, expected: 1", len(buttons))
+	}
+}
+
+func TestDoMuteFromButton(t *testing.T) {
+	var saved []Mute
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{
+				Subscription{EtsyUserID: 1, ChatID: chatID, Selected: true},
+				Subscription{EtsyUserID: 5432, ChatID: chatID},
+			}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SaveMuteFunc: func(ctx context.Context, mute Mute) error {
+			saved = append(saved, mute)
+			return nil
+		},
+	}
+
+	var sent []string
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			sent = append(sent, msg)
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	msgUpdate := MessengerUpdate{ChatID: 42, Command: "/mute", Text: "/mute 771 24h #5432", CallbackID: "cb"}
+	if err := ls.DoMute(context.Background(), msgUpdate); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(saved) != 1 || saved[0].EtsyUserID != 5432 || saved[0].ListingID != 771 {
+		t.Fatalf("Unexpected mutes: %+v", saved)
+	}
+
+	if until := time.Unix(saved[0].Until, 0); until.Before(time.Now().Add(23*time.Hour)) || until.After(time.Now().Add(25*time.Hour)) {
+		t.Errorf("Got mute until: %s, expected in 24 hours", until)
+	}
+
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], "Alerts of listing 771 are muted until") {
+		t.Errorf("Unexpected messages: %q", sent)
+	}
+
+	// Shops not linked to the chat are refused.
+	msgUpdate.Text = "/mute 771 #999"
+	if err := ls.DoMute(context.Background(), msgUpdate); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestDoRestocked(t *testing.T) {
+	states := map[int64]ListingState{
+		42: ListingState{ListingID: 42, EtsyUserID: 5432, State: active, Quantity: 1, LowStock: true},
+		7:  ListingState{ListingID: 7, EtsyUserID: 1, State: active, Quantity: 1, LowStock: true},
+	}
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			state, ok := states[listingID]
+			if !ok {
+				return ListingState{}, ErrNotFound
+			}
+
+			return state, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			states[state.ListingID] = state
+			return nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	msgUpdate := MessengerUpdate{ChatID: 42, Command: "/restocked", Text: "/restocked 42"}
+	if err := ls.DoRestocked(context.Background(), msgUpdate); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if states[42].LowStock {
+		t.Error("Listing is still low on stock")
+	}
+
+	// Listings of other shops are left alone.
+	msgUpdate.Text = "/restocked 7"
+	if err := ls.DoRestocked(context.Background(), msgUpdate); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if !states[7].LowStock {
+		t.Error("Listing of another shop is changed")
+	}
+}
+
+func TestDoRestockedLocksListing(t *testing.T) {
+	saved := make(chan ListingState, 1)
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, EtsyUserID: 5432, State: active, LowStock: true}, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			saved <- state
+			return nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	// An update of the listing is being handled.
+	mu := &ls.listingMu[42%listingLocks]
+	mu.Lock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ls.DoRestocked(context.Background(), MessengerUpdate{ChatID: 42, Command: "/restocked", Text: "/restocked 42"})
+	}()
+
+	select {
+	case state := <-saved:
+		t.Fatalf("Listing state is saved while the listing is locked: %+v", state)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mu.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if state := <-saved; state.LowStock {
+		t.Errorf("Low stock is not reset: %+v", state)
+	}
+}
+
+func TestAlertMuted(t *testing.T) {
+	storage := &StorageMock{
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return []Mute{Mute{EtsyUserID: etsyUserID, SKU: "MUG-RED"}}, nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			t.Error("Muted alerts must not be sent")
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+
+	subs := []Subscription{Subscription{ChatID: 42}}
+	if err := ls.alert(context.Background(), User{EtsyUserID: 5432}, subs, Update{ListingID: 1}, alertSoldOut, []string{"MUG-RED"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
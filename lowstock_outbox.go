@@ -0,0 +1,253 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	outboxPeriod = time.Second
+
+	// Messages are dead-lettered after this many failed attempts.
+	maxSendAttempts = 10
+	// Delay after the first failed attempt, doubled after every next one.
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = time.Hour
+
+	// Dead letters are kept this long for inspection.
+	deadLetterTTL = 30 * 24 * time.Hour
+)
+
+// Queue state of the last outbox pass, exposed as gauges.
+var (
+	outboxDepth  int64
+	outboxOldest int64
+)
+
+var (
+	outboxSentCounter  = metrics.NewCounter(`outbox_messages_total{status="sent"}`)
+	outboxRetryCounter = metrics.NewCounter(`outbox_messages_total{status="retry"}`)
+	outboxDeadCounter  = metrics.NewCounter(`outbox_messages_total{status="dead"}`)
+
+	_ = metrics.NewGauge(`outbox_depth`, func() float64 {
+		return float64(atomic.LoadInt64(&outboxDepth))
+	})
+	_ = metrics.NewGauge(`outbox_oldest_age_seconds`, func() float64 {
+		oldest := atomic.LoadInt64(&outboxOldest)
+		if oldest == 0 {
+			return 0
+		}
+
+		return time.Since(time.Unix(0, oldest)).Seconds()
+	})
+)
+
+// RetryAfterError is returned by a Messenger that was asked to slow down.
+type RetryAfterError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %s", e.RetryAfter, e.Err)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Throttler is implemented by messengers that limit how fast they send to a chat.
+type Throttler interface {
+	// SendDelay is how long a message to the chat would wait for rate limits now.
+	SendDelay(chatID int64) time.Duration
+}
+
+// OutboxMessage is a message waiting for delivery.
+type OutboxMessage struct {
+	// ID is assigned by storage, messages are delivered in ID order.
+	ID      uint64
+	ChatID  int64
+	Message Message
+	// EtsyUserID of the shop the message is about, messages are deleted with the shop.
+	EtsyUserID int64
+	// Email is the address the message is mailed to instead of the chat.
+	Email string
+
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Created     time.Time
+}
+
+type Outbox struct {
+	ls     *LowStock
+	ticker *time.Ticker
+}
+
+func NewOutbox(l *LowStock) *Outbox {
+	return &Outbox{
+		ls:     l,
+		ticker: time.NewTicker(outboxPeriod),
+	}
+}
+
+// send queues the message about the shop, the outbox delivers it.
+func (ls *LowStock) send(ctx context.Context, etsyUserID, chatID int64, msg Message) error {
+	if err := ls.storage.EnqueueMessage(ctx, OutboxMessage{
+		ChatID:     chatID,
+		Message:    msg,
+		EtsyUserID: etsyUserID,
+		Created:    time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to enqueue message: %w", err)
+	}
+
+	return nil
+}
+
+// retryDelay grows exponentially with attempts up to maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+
+	return delay
+}
+
+// deliver sends the message to its chat or mails it to its address.
+func (ls *LowStock) deliver(m OutboxMessage) error {
+	if m.Email == "" {
+		return ls.messenger.SendMessage(m.Message, m.ChatID)
+	}
+
+	if ls.mailer == nil {
+		return errors.New("email is off")
+	}
+
+	if err := ls.mailer.SendMail(m.Email, toMail(m.Message)); err != nil {
+		emailFailedCounter.Inc()
+		return err
+	}
+
+	emailSentCounter.Inc()
+	return nil
+}
+
+// throttled reports whether the messenger would hold the message to the chat back for rate limits.
+func (ls *LowStock) throttled(m OutboxMessage) bool {
+	t, ok := ls.messenger.(Throttler)
+	if !ok || m.Email != "" {
+		return false
+	}
+
+	return t.SendDelay(m.ChatID) > 0
+}
+
+// lane groups messages that are delivered in order, emails do not wait for the chat and the other way around.
+func (m OutboxMessage) lane() string {
+	if m.Email != "" {
+		return "mailto:" + m.Email
+	}
+
+	return strconv.FormatInt(m.ChatID, 10)
+}
+
+// sendOutbox delivers queued messages that are due.
+// A chat or an address is skipped for the rest of the pass after a failure, so its messages stay in order.
+func (ls *LowStock) sendOutbox(ctx context.Context, now time.Time) {
+	queue, err := ls.storage.OutboxMessages(ctx)
+	if err != nil {
+		log.Printf("Failed to get outbox messages: %s", err)
+		return
+	}
+
+	var oldest int64
+	if len(queue) > 0 {
+		oldest = queue[0].Created.UnixNano()
+	}
+	atomic.StoreInt64(&outboxDepth, int64(len(queue)))
+	atomic.StoreInt64(&outboxOldest, oldest)
+
+	blocked := map[string]bool{}
+
+	for _, m := range queue {
+		if blocked[m.lane()] {
+			continue
+		}
+
+		if m.NextAttempt.After(now) {
+			blocked[m.lane()] = true
+			continue
+		}
+
+		// One sender serves all chats, it does not wait for a throttled chat.
+		if ls.throttled(m) {
+			blocked[m.lane()] = true
+			continue
+		}
+
+		err := ls.deliver(m)
+		if err == nil {
+			outboxSentCounter.Inc()
+			if err := ls.storage.DeleteOutboxMessage(ctx, m.ID); err != nil {
+				log.Printf("Failed to delete sent outbox message %d: %s", m.ID, err)
+			}
+			continue
+		}
+		blocked[m.lane()] = true
+
+		m.Attempts++
+		m.LastError = err.Error()
+
+		if m.Attempts >= maxSendAttempts || errors.Is(err, ErrUndeliverable) {
+			outboxDeadCounter.Inc()
+			log.Printf("Giving up on message %d to chat %d after %d attempts: %s", m.ID, m.ChatID, m.Attempts, err)
+			if err := ls.storage.DeadLetter(ctx, m); err != nil {
+				log.Printf("Failed to dead-letter outbox message %d: %s", m.ID, err)
+			}
+			continue
+		}
+
+		delay := retryDelay(m.Attempts)
+
+		var retryErr *RetryAfterError
+		if errors.As(err, &retryErr) && retryErr.RetryAfter > delay {
+			delay = retryErr.RetryAfter
+		}
+
+		outboxRetryCounter.Inc()
+		log.Printf("Failed to send message %d to chat %d, retrying in %s: %s", m.ID, m.ChatID, delay, err)
+
+		m.NextAttempt = now.Add(delay)
+		if err := ls.storage.SaveOutboxMessage(ctx, m); err != nil {
+			log.Printf("Failed to save outbox message %d: %s", m.ID, err)
+		}
+	}
+}
+
+func (o *Outbox) Run(ctx context.Context) {
+	log.Println("Starting outbox sender...")
+	defer o.ticker.Stop()
+
+	for {
+		select {
+		case now := <-o.ticker.C:
+			o.ls.sendOutbox(ctx, now)
+		case <-ctx.Done():
+			log.Println("Stopping outbox sender...")
+			return
+		}
+	}
+}
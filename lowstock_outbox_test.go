@@ -0,0 +1,231 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  5 * time.Second,
+		2:  10 * time.Second,
+		4:  40 * time.Second,
+		20: time.Hour,
+	}
+
+	for attempts, expected := range tests {
+		if actual := retryDelay(attempts); actual != expected {
+			t.Errorf("Got delay: %s after %d attempts, expected: %s", actual, attempts, expected)
+		}
+	}
+}
+
+func TestSendOutbox(t *testing.T) {
+	now := time.Now()
+
+	queue := []OutboxMessage{
+		OutboxMessage{ID: 1, ChatID: 10, Message: Message{Text: "first"}},
+		OutboxMessage{ID: 2, ChatID: 20, Message: Message{Text: "flood"}},
+		OutboxMessage{ID: 3, ChatID: 20, Message: Message{Text: "waits for flood"}},
+		OutboxMessage{ID: 4, ChatID: 30, Message: Message{Text: "later"}, NextAttempt: now.Add(time.Minute)},
+		OutboxMessage{ID: 5, ChatID: 40, Message: Message{Text: "broken"}, Attempts: maxSendAttempts - 1},
+		OutboxMessage{ID: 6, ChatID: 50, Message: Message{Text: "down"}, Attempts: 2},
+		OutboxMessage{ID: 7, ChatID: 60, Message: Message{Text: "blocked"}},
+	}
+
+	var (
+		deleted []uint64
+		saved   []OutboxMessage
+		dead    []OutboxMessage
+	)
+
+	storage := &StorageMock{
+		OutboxMessagesFunc: func(ctx context.Context) ([]OutboxMessage, error) {
+			return queue, nil
+		},
+		DeleteOutboxMessageFunc: func(ctx context.Context, id uint64) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+		SaveOutboxMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			saved = append(saved, msg)
+			return nil
+		},
+		DeadLetterFunc: func(ctx context.Context, msg OutboxMessage) error {
+			dead = append(dead, msg)
+			return nil
+		},
+	}
+
+	var sent []string
+	messenger := &MessengerMock{
+		SendMessageFunc: func(msg Message, chatID int64) error {
+			sent = append(sent, msg.Text)
+
+			switch chatID {
+			case 20:
+				return &RetryAfterError{RetryAfter: 5 * time.Minute, Err: errors.New("too many requests")}
+			case 40, 50:
+				return errors.New("bad gateway")
+			case 60:
+				return fmt.Errorf("%w: bot was blocked by the user", ErrUndeliverable)
+			}
+
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+	ls.sendOutbox(context.Background(), now)
+
+	if diff := cmp.Diff([]string{"first", "flood", "broken", "down", "blocked"}, sent); diff != "" {
+		t.Errorf("Sent messages do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]uint64{1}, deleted); diff != "" {
+		t.Errorf("Deleted messages do not match:\n%s", diff)
+	}
+
+	expectedSaved := []OutboxMessage{
+		OutboxMessage{ID: 2, ChatID: 20, Message: Message{Text: "flood"}, Attempts: 1, NextAttempt: now.Add(5 * time.Minute), LastError: "retry after 5m0s: too many requests"},
+		OutboxMessage{ID: 6, ChatID: 50, Message: Message{Text: "down"}, Attempts: 3, NextAttempt: now.Add(20 * time.Second), LastError: "bad gateway"},
+	}
+
+	if diff := cmp.Diff(expectedSaved, saved); diff != "" {
+		t.Errorf("Saved messages do not match:\n%s", diff)
+	}
+
+	// Undeliverable messages are not retried.
+	if len(dead) != 2 || dead[0].ID != 5 || dead[0].Attempts != maxSendAttempts || dead[1].ID != 7 || dead[1].Attempts != 1 {
+		t.Errorf("Unexpected dead letters: %+v", dead)
+	}
+}
+
+func TestSendOutboxEmail(t *testing.T) {
+	now := time.Now()
+
+	queue := []OutboxMessage{
+		OutboxMessage{ID: 1, ChatID: 10, Email: "books@example.com", Message: Message{Text: "quiet"}, NextAttempt: now.Add(time.Hour)},
+		OutboxMessage{ID: 2, ChatID: 10, Message: Message{Text: "chat"}},
+		OutboxMessage{ID: 3, ChatID: 20, Email: "down@example.com", Message: Message{Text: "down"}},
+		OutboxMessage{ID: 4, ChatID: 20, Message: Message{Text: "chat after email"}},
+		OutboxMessage{ID: 5, ChatID: 30, Email: "shop@example.com", Message: Message{Text: "mail"}},
+	}
+
+	var (
+		deleted []uint64
+		saved   []uint64
+	)
+
+	storage := &StorageMock{
+		OutboxMessagesFunc: func(ctx context.Context) ([]OutboxMessage, error) {
+			return queue, nil
+		},
+		DeleteOutboxMessageFunc: func(ctx context.Context, id uint64) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+		SaveOutboxMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			saved = append(saved, msg.ID)
+			return nil
+		},
+	}
+
+	var sent []string
+	messenger := &MessengerMock{
+		SendMessageFunc: func(msg Message, chatID int64) error {
+			sent = append(sent, msg.Text)
+			return nil
+		},
+	}
+
+	var mailed []string
+	mailer := &MailerMock{
+		SendMailFunc: func(to string, mail Mail) error {
+			if to == "down@example.com" {
+				return errors.New("connection refused")
+			}
+
+			mailed = append(mailed, to+": "+mail.Subject)
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+	ls.SetMailer(mailer)
+	ls.sendOutbox(context.Background(), now)
+
+	// Emails held back or failing do not block chats.
+	if diff := cmp.Diff([]string{"chat", "chat after email"}, sent); diff != "" {
+		t.Errorf("Sent messages do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"shop@example.com: mail"}, mailed); diff != "" {
+		t.Errorf("Mailed messages do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]uint64{2, 4, 5}, deleted); diff != "" {
+		t.Errorf("Deleted messages do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]uint64{3}, saved); diff != "" {
+		t.Errorf("Saved messages do not match:\n%s", diff)
+	}
+}
+
+// throttledMessenger holds chats back like the rate limiter of a messenger.
+type throttledMessenger struct {
+	*MessengerMock
+	delays map[int64]time.Duration
+}
+
+func (m throttledMessenger) SendDelay(chatID int64) time.Duration {
+	return m.delays[chatID]
+}
+
+func TestSendOutboxThrottled(t *testing.T) {
+	queue := []OutboxMessage{
+		OutboxMessage{ID: 1, ChatID: 10, Message: Message{Text: "busy"}},
+		OutboxMessage{ID: 2, ChatID: 20, Message: Message{Text: "idle"}},
+		OutboxMessage{ID: 3, ChatID: 10, Message: Message{Text: "busy again"}},
+	}
+
+	var deleted []uint64
+	storage := &StorageMock{
+		OutboxMessagesFunc: func(ctx context.Context) ([]OutboxMessage, error) {
+			return queue, nil
+		},
+		DeleteOutboxMessageFunc: func(ctx context.Context, id uint64) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+
+	var sent []string
+	messenger := throttledMessenger{
+		MessengerMock: &MessengerMock{
+			SendMessageFunc: func(msg Message, chatID int64) error {
+				sent = append(sent, msg.Text)
+				return nil
+			},
+		},
+		delays: map[int64]time.Duration{10: 3 * time.Second},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+	ls.sendOutbox(context.Background(), time.Now())
+
+	// The throttled chat waits for the next pass without an attempt, other chats go on.
+	if diff := cmp.Diff([]string{"idle"}, sent); diff != "" {
+		t.Errorf("Sent messages do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]uint64{2}, deleted); diff != "" {
+		t.Errorf("Deleted messages do not match:\n%s", diff)
+	}
+}
@@ -0,0 +1,425 @@
+package lowstock
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	quietDefer  = "defer"
+	quietSilent = "silent"
+)
+
+var (
+	// Longest snooze, alerts are not held back for longer.
+	maxSnooze = 7 * 24 * time.Hour
+
+	// Longest message Telegram accepts, longer batches of deferred alerts are split.
+	maxMessageLength = 4096
+)
+
+var (
+	deferredSuccessCounter = metrics.NewCounter(`deferred_alerts_total{status="success"}`)
+	deferredFailureCounter = metrics.NewCounter(`deferred_alerts_total{status="failure"}`)
+)
+
+func localMinute(sub Subscription, now time.Time) int {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		log.Printf("Bad timezone %q of chat %d, using UTC: %s", sub.Timezone, sub.ChatID, err)
+		loc = time.UTC
+	}
+
+	local := now.In(loc)
+	return local.Hour()*60 + local.Minute()
+}
+
+// inQuietHours reports whether now is within quiet hours of the chat, the window may span midnight.
+func inQuietHours(sub Subscription, now time.Time) bool {
+	if sub.Quiet == "" || sub.QuietFrom == sub.QuietTo {
+		return false
+	}
+
+	m := localMinute(sub, now)
+	if sub.QuietFrom < sub.QuietTo {
+		return m >= sub.QuietFrom && m < sub.QuietTo
+	}
+
+	return m >= sub.QuietFrom || m < sub.QuietTo
+}
+
+// deferAlerts reports whether alerts are held back until snooze or quiet hours end.
+func deferAlerts(sub Subscription, now time.Time) bool {
+	if sub.SnoozedUntil > now.Unix() {
+		return true
+	}
+
+	return sub.Quiet == quietDefer && inQuietHours(sub, now)
+}
+
+// deferredUntil is the first minute alerts of the chat are not held back, now when they are not.
+func deferredUntil(sub Subscription, now time.Time) time.Time {
+	t := now
+	// Quiet hours end within a day, the bound guards against a broken timezone.
+	for i := 0; i < 2*24*60 && deferAlerts(sub, t); i++ {
+		if snoozed := time.Unix(sub.SnoozedUntil, 0); snoozed.After(t) {
+			t = snoozed
+			continue
+		}
+
+		t = t.Add(time.Minute).Truncate(time.Minute)
+	}
+
+	return t
+}
+
+// silentAlerts reports whether alerts are delivered without a notification sound.
+func silentAlerts(sub Subscription, now time.Time) bool {
+	return sub.Quiet == quietSilent && inQuietHours(sub, now)
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, ErrBadArguments
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// quietSettings are parsed from "/quiet {HH:MM} {HH:MM} [timezone] [silent]" or "/quiet off".
+type quietSettings struct {
+	quiet    string
+	from     int
+	to       int
+	timezone string
+}
+
+func (q quietSettings) apply(sub *Subscription) {
+	sub.Quiet = q.quiet
+	sub.QuietFrom = q.from
+	sub.QuietTo = q.to
+	sub.Timezone = q.timezone
+}
+
+// parseQuiet reads quiet hours, timezone of the chat is kept when omitted.
+func parseQuiet(args []string, timezone string) (quietSettings, error) {
+	settings := quietSettings{timezone: timezone}
+
+	if len(args) == 1 && args[0] == "off" {
+		return settings, nil
+	}
+
+	if len(args) < 2 || len(args) > 4 {
+		return quietSettings{}, ErrBadArguments
+	}
+
+	var err error
+	if settings.from, err = parseClock(args[0]); err != nil {
+		return quietSettings{}, err
+	}
+	if settings.to, err = parseClock(args[1]); err != nil {
+		return quietSettings{}, err
+	}
+	if settings.from == settings.to {
+		return quietSettings{}, ErrBadArguments
+	}
+
+	settings.quiet = quietDefer
+	for _, arg := range args[2:] {
+		if arg == quietSilent {
+			settings.quiet = quietSilent
+			continue
+		}
+
+		if !validTimezone(arg) {
+			return quietSettings{}, ErrBadArguments
+		}
+		settings.timezone = arg
+	}
+
+	return settings, nil
+}
+
+// parseSnooze reads durations like "30m", "2h" and "1d".
+func parseSnooze(arg string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+
+	if strings.HasSuffix(arg, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(arg, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(arg)
+	}
+
+	if err != nil || d <= 0 || d > maxSnooze {
+		return 0, ErrBadArguments
+	}
+
+	return d, nil
+}
+
+// DoQuiet shows or changes quiet hours of the chat, they apply to all shops of the chat.
+func (ls *LowStock) DoQuiet(ctx context.Context, msgUpdate MessengerUpdate) error {
+	_, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	if args := commandArgs(msgUpdate); len(args) > 0 {
+		settings, err := parseQuiet(args, sub.Timezone)
+		if err != nil {
+			if err := ls.messenger.SendTextMessage(msgs.quietUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send quiet hours usage: %w", err)
+			}
+
+			return err
+		}
+
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		if err := ls.updateChatSubscriptions(ctx, msgUpdate.ChatID, settings.apply); err != nil {
+			return err
+		}
+		settings.apply(&sub)
+	}
+
+	msg := msgs.quietOff
+	if sub.Quiet != "" {
+		mode := msgs.quietDefer
+		if sub.Quiet == quietSilent {
+			mode = msgs.quietSilent
+		}
+
+		tz := html.EscapeString(timezoneName(sub.Timezone))
+		msg = fmt.Sprintf(msgs.quiet, formatClock(sub.QuietFrom), formatClock(sub.QuietTo), tz, mode)
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send quiet hours: %w", err)
+	}
+
+	return nil
+}
+
+// DoSnooze holds alerts of the chat back for a while, "/snooze off" ends the snooze.
+func (ls *LowStock) DoSnooze(ctx context.Context, msgUpdate MessengerUpdate) error {
+	_, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	args := commandArgs(msgUpdate)
+	if len(args) != 1 {
+		if err := ls.messenger.SendTextMessage(msgs.snoozeUsage, msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send snooze usage: %w", err)
+		}
+
+		return ErrBadArguments
+	}
+
+	var until int64
+	if args[0] != "off" {
+		d, err := parseSnooze(args[0])
+		if err != nil {
+			if err := ls.messenger.SendTextMessage(msgs.snoozeUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send snooze usage: %w", err)
+			}
+
+			return err
+		}
+		until = time.Now().Add(d).Unix()
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	if err := ls.updateChatSubscriptions(ctx, msgUpdate.ChatID, func(s *Subscription) {
+		s.SnoozedUntil = until
+	}); err != nil {
+		return err
+	}
+
+	msg := msgs.snoozeOff
+	if until != 0 {
+		loc, err := time.LoadLocation(sub.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		msg = fmt.Sprintf(msgs.snooze, time.Unix(until, 0).In(loc).Format(statusTimeFormat))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send snooze: %w", err)
+	}
+
+	return nil
+}
+
+// DeferredAlert is an alert held back by quiet hours or snooze.
+type DeferredAlert struct {
+	// ID is assigned by storage, alerts of a chat go in ID order.
+	ID      uint64
+	Message Message
+}
+
+// alertBatch is a message of deferred alerts, the alerts are deleted once it is queued.
+type alertBatch struct {
+	msg Message
+	ids []uint64
+}
+
+// cutAlert shortens the text to at most max characters.
+// Cutting HTML could leave a tag or an entity open, too long alerts lose their formatting instead:
+// the plain text is cut, at the end of a line where possible, and escaped again.
+func cutAlert(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	plain := html.UnescapeString(htmlTag.ReplaceAllString(text, ""))
+	if escaped := html.EscapeString(plain); utf8.RuneCountInString(escaped) <= max {
+		return escaped
+	}
+
+	var b strings.Builder
+	length := 1 // "…"
+	lastLine := -1
+	for _, r := range plain {
+		escaped := html.EscapeString(string(r))
+		if length+utf8.RuneCountInString(escaped) > max {
+			break
+		}
+
+		if r == '\n' {
+			lastLine = b.Len()
+		}
+
+		b.WriteString(escaped)
+		length += utf8.RuneCountInString(escaped)
+	}
+
+	if lastLine >= 0 {
+		return b.String()[:lastLine] + "\n…"
+	}
+
+	return b.String() + "…"
+}
+
+// batchAlerts joins deferred alerts into as few messages as fit into maxMessageLength.
+// Buttons of single alerts are dropped, alerts too long to fit next to the header are cut.
+func batchAlerts(header string, alerts []DeferredAlert) []alertBatch {
+	var (
+		batches []alertBatch
+		batch   alertBatch
+		texts   = []string{header}
+		length  = utf8.RuneCountInString(header)
+		max     = maxMessageLength - length - 2
+	)
+
+	for _, alert := range alerts {
+		text := cutAlert(alert.Message.Text, max)
+
+		n := utf8.RuneCountInString(text) + 2
+		if length+n > maxMessageLength && len(batch.ids) > 0 {
+			batch.msg = Message{Text: strings.Join(texts, "\n\n")}
+			batches = append(batches, batch)
+			batch, texts, length = alertBatch{}, nil, 0
+		}
+
+		texts = append(texts, text)
+		batch.ids = append(batch.ids, alert.ID)
+		length += n
+	}
+
+	if len(batch.ids) > 0 {
+		batch.msg = Message{Text: strings.Join(texts, "\n\n")}
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// sendDeferredAlerts delivers alerts held back in chats where snooze and quiet hours are over.
+// Alerts are deleted once queued to the outbox, those that fail to queue are tried again on the next run.
+func (ls *LowStock) sendDeferredAlerts(ctx context.Context, now time.Time) {
+	subs, err := ls.storage.AllSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Failed to get subscriptions for deferred alerts: %s", err)
+		return
+	}
+
+	// Quiet hours and snooze are the same for all shops of a chat.
+	done := map[int64]bool{}
+
+	for _, sub := range subs {
+		if done[sub.ChatID] || sub.Paused || deferAlerts(sub, now) {
+			continue
+		}
+		done[sub.ChatID] = true
+
+		alerts, err := ls.storage.DeferredAlerts(ctx, sub.ChatID)
+		if err != nil {
+			log.Printf("Failed to get deferred alerts of chat %d: %s", sub.ChatID, err)
+			continue
+		}
+
+		if len(alerts) == 0 {
+			continue
+		}
+
+		// Alerts are batched per shop, so batches are deleted with the shop.
+		var shops []int64
+		byShop := map[int64][]DeferredAlert{}
+		for _, alert := range alerts {
+			var shop int64
+			if alert.Message.Alert != nil {
+				shop = alert.Message.Alert.UserID
+			}
+
+			if _, ok := byShop[shop]; !ok {
+				shops = append(shops, shop)
+			}
+			byShop[shop] = append(byShop[shop], alert)
+		}
+
+		msgs := messages(sub.Locale)
+		for _, shop := range shops {
+			for _, batch := range batchAlerts(fmt.Sprintf(msgs.deferred, len(byShop[shop])), byShop[shop]) {
+				if err := ls.send(ctx, shop, sub.ChatID, batch.msg); err != nil {
+					deferredFailureCounter.Inc()
+					log.Printf("Failed to queue deferred alerts to chat %d: %s", sub.ChatID, err)
+					continue
+				}
+				deferredSuccessCounter.Inc()
+
+				if err := ls.storage.DeleteDeferredAlerts(ctx, sub.ChatID, batch.ids); err != nil {
+					log.Printf("Failed to delete deferred alerts of chat %d: %s", sub.ChatID, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInQuietHours(t *testing.T) {
+	night := Subscription{Quiet: quietDefer, QuietFrom: 22 * 60, QuietTo: 7 * 60, Timezone: "Europe/Berlin"}
+	lunch := Subscription{Quiet: quietSilent, QuietFrom: 12 * 60, QuietTo: 13 * 60}
+
+	tests := []struct {
+		name     string
+		sub      Subscription
+		now      time.Time
+		expected bool
+	}{
+		{name: "before midnight", sub: night, now: time.Date(2020, 5, 20, 21, 30, 0, 0, time.UTC), expected: true},
+		{name: "after midnight", sub: night, now: time.Date(2020, 5, 20, 4, 59, 0, 0, time.UTC), expected: true},
+		{name: "window end", sub: night, now: time.Date(2020, 5, 20, 5, 0, 0, 0, time.UTC), expected: false},
+		{name: "day", sub: night, now: time.Date(2020, 5, 20, 12, 0, 0, 0, time.UTC), expected: false},
+		{name: "within day window", sub: lunch, now: time.Date(2020, 5, 20, 12, 30, 0, 0, time.UTC), expected: true},
+		{name: "after day window", sub: lunch, now: time.Date(2020, 5, 20, 13, 0, 0, 0, time.UTC), expected: false},
+		{name: "off", sub: Subscription{QuietFrom: 0, QuietTo: 24 * 60}, now: time.Now(), expected: false},
+	}
+
+	for _, tt := range tests {
+		if actual := inQuietHours(tt.sub, tt.now); actual != tt.expected {
+			t.Errorf("%s: got quiet: %t, expected: %t", tt.name, actual, tt.expected)
+		}
+	}
+}
+
+func TestDeferredUntil(t *testing.T) {
+	now := time.Date(2020, 5, 20, 21, 30, 20, 0, time.UTC)
+	night := Subscription{Quiet: quietDefer, QuietFrom: 22 * 60, QuietTo: 7 * 60, Timezone: "Europe/Berlin"}
+	snoozed := Subscription{SnoozedUntil: now.Add(90 * time.Minute).Unix()}
+	both := Subscription{Quiet: quietDefer, QuietFrom: 22 * 60, QuietTo: 7 * 60, SnoozedUntil: snoozed.SnoozedUntil}
+
+	tests := []struct {
+		name     string
+		sub      Subscription
+		expected time.Time
+	}{
+		{name: "not deferred", sub: Subscription{}, expected: now},
+		{name: "silent", sub: Subscription{Quiet: quietSilent, QuietFrom: 22 * 60, QuietTo: 7 * 60, Timezone: "Europe/Berlin"}, expected: now},
+		{name: "quiet hours", sub: night, expected: time.Date(2020, 5, 21, 5, 0, 0, 0, time.UTC)},
+		{name: "snooze", sub: snoozed, expected: now.Add(90 * time.Minute)},
+		{name: "snooze into quiet hours", sub: both, expected: time.Date(2020, 5, 21, 7, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if actual := deferredUntil(tt.sub, now); !actual.Equal(tt.expected) {
+			t.Errorf("%s: got: %s, expected: %s", tt.name, actual, tt.expected)
+		}
+	}
+}
+
+func TestParseQuiet(t *testing.T) {
+	tests := []struct {
+		args        string
+		expected    quietSettings
+		expectedErr error
+	}{
+		{args: "off", expected: quietSettings{timezone: "Europe/Kyiv"}},
+		{args: "22:00 07:00", expected: quietSettings{quiet: quietDefer, from: 1320, to: 420, timezone: "Europe/Kyiv"}},
+		{args: "22:00 07:00 Europe/Berlin silent", expected: quietSettings{quiet: quietSilent, from: 1320, to: 420, timezone: "Europe/Berlin"}},
+		{args: "22:00 22:00", expectedErr: ErrBadArguments},
+		{args: "22:00 7am", expectedErr: ErrBadArguments},
+		{args: "22:00", expectedErr: ErrBadArguments},
+	}
+
+	for _, tt := range tests {
+		actual, err := parseQuiet(strings.Fields(tt.args), "Europe/Kyiv")
+		if err != tt.expectedErr {
+			t.Errorf("Got error: %v for %q, expected: %v", err, tt.args, tt.expectedErr)
+			continue
+		}
+
+		if diff := cmp.Diff(tt.expected, actual, cmp.AllowUnexported(quietSettings{})); diff != "" {
+			t.Errorf("Settings for %q do not match:\n%s", tt.args, diff)
+		}
+	}
+}
+
+func TestParseSnooze(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30m":  30 * time.Minute,
+		"2h":   2 * time.Hour,
+		"1d":   24 * time.Hour,
+		"8d":   0,
+		"-1h":  0,
+		"soon": 0,
+	}
+
+	for arg, expected := range tests {
+		actual, err := parseSnooze(arg)
+		if expected == 0 && err != ErrBadArguments {
+			t.Errorf("Got error: %v for %q, expected: %v", err, arg, ErrBadArguments)
+		}
+
+		if actual != expected {
+			t.Errorf("Got snooze: %s for %q, expected: %s", actual, arg, expected)
+		}
+	}
+}
+
+func TestAlertDuringQuietHours(t *testing.T) {
+	now := time.Now().UTC()
+	from := (now.Hour()*60 + now.Minute() + 24*60 - 60) % (24 * 60)
+	to := (from + 120) % (24 * 60)
+
+	subs := []Subscription{
+		Subscription{ChatID: 10, Quiet: quietDefer, QuietFrom: from, QuietTo: to},
+		Subscription{ChatID: 20, Quiet: quietSilent, QuietFrom: from, QuietTo: to},
+		Subscription{ChatID: 30, SnoozedUntil: now.Add(time.Hour).Unix()},
+		Subscription{ChatID: 40},
+	}
+
+	var deferred []int64
+	silent := map[int64]bool{}
+
+	storage := &StorageMock{
+		DeferAlertFunc: func(ctx context.Context, chatID int64, msg Message) error {
+			deferred = append(deferred, chatID)
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			silent[msg.ChatID] = msg.Message.Silent
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+
+	if err := ls.alert(context.Background(), User{}, subs, Update{ListingID: 1, Title: "Mug"}, alertSoldOut, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff([]int64{10, 30}, deferred); diff != "" {
+		t.Errorf("Deferred chats do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff(map[int64]bool{20: true, 40: false}, silent); diff != "" {
+		t.Errorf("Sent alerts do not match:\n%s", diff)
+	}
+}
+
+func TestBatchAlerts(t *testing.T) {
+	defer func(n int) { maxMessageLength = n }(maxMessageLength)
+	maxMessageLength = 30
+
+	alerts := []DeferredAlert{
+		DeferredAlert{ID: 1, Message: Message{Text: "first alert"}},
+		DeferredAlert{ID: 2, Message: Message{Text: "second alert"}},
+		DeferredAlert{ID: 3, Message: Message{Text: "third alert"}},
+		// Too long to fit next to the header.
+		DeferredAlert{ID: 4, Message: Message{Text: "Sold out\nvery long title here"}},
+	}
+
+	expected := []alertBatch{
+		alertBatch{msg: Message{Text: "Held: 3\n\nfirst alert"}, ids: []uint64{1}},
+		alertBatch{msg: Message{Text: "second alert\n\nthird alert"}, ids: []uint64{2, 3}},
+		alertBatch{msg: Message{Text: "Sold out\n…"}, ids: []uint64{4}},
+	}
+
+	if diff := cmp.Diff(expected, batchAlerts("Held: 3", alerts), cmp.AllowUnexported(alertBatch{})); diff != "" {
+		t.Errorf("Batches do not match:\n%s", diff)
+	}
+}
+
+func TestCutAlert(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "short", expected: "short"},
+		{text: "<b>Sold out:</b> Mug &amp; cup\nQuantity: 0", expected: "Sold out: Mug &amp; cup\n…"},
+		{text: "Ünïcödé title without breaks", expected: "Ünïcödé title without br…"},
+		{text: `<a href="https://www.etsy.com/listing/42">Mug</a> is sold out`, expected: "Mug is sold out"},
+		{text: "<b>Sold out:</b> &lt;&lt;&lt;&lt;&lt;&gt;", expected: "Sold out: &lt;&lt;&lt;…"},
+	}
+
+	for _, tt := range tests {
+		if actual := cutAlert(tt.text, 25); actual != tt.expected {
+			t.Errorf("Got: %q, expected: %q", actual, tt.expected)
+		}
+	}
+}
+
+func TestSendDeferredAlerts(t *testing.T) {
+	now := time.Now()
+
+	var (
+		sent     []string
+		deleted  []uint64
+		queueErr error
+	)
+	storage := &StorageMock{
+		AllSubscriptionsFunc: func(ctx context.Context) ([]Subscription, error) {
+			return []Subscription{
+				Subscription{EtsyUserID: 1, ChatID: 10},
+				Subscription{EtsyUserID: 2, ChatID: 10},
+				Subscription{EtsyUserID: 1, ChatID: 20, SnoozedUntil: now.Add(time.Hour).Unix()},
+			}, nil
+		},
+		DeferredAlertsFunc: func(ctx context.Context, chatID int64) ([]DeferredAlert, error) {
+			if chatID != 10 {
+				t.Errorf("Deferred alerts of chat %d must wait", chatID)
+			}
+
+			return []DeferredAlert{
+				DeferredAlert{ID: 1, Message: Message{Text: "Sold out: Mug"}},
+				DeferredAlert{ID: 2, Message: Message{Text: "Sold out: Cup"}},
+			}, nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			if queueErr != nil {
+				return queueErr
+			}
+
+			sent = append(sent, msg.Message.Text)
+			return nil
+		},
+		DeleteDeferredAlertsFunc: func(ctx context.Context, chatID int64, ids []uint64) error {
+			deleted = append(deleted, ids...)
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+	ls.sendDeferredAlerts(context.Background(), now)
+
+	expected := []string{"<b>Alerts held back: 2</b>\n\nSold out: Mug\n\nSold out: Cup"}
+	if diff := cmp.Diff(expected, sent); diff != "" {
+		t.Errorf("Sent messages do not match:\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]uint64{1, 2}, deleted); diff != "" {
+		t.Errorf("Deleted alerts do not match:\n%s", diff)
+	}
+
+	// Alerts that fail to queue are kept for the next run.
+	sent, deleted, queueErr = nil, nil, errors.New("disk is full")
+	ls.sendDeferredAlerts(context.Background(), now)
+
+	if len(deleted) != 0 {
+		t.Errorf("Got deleted alerts: %v, expected none", deleted)
+	}
+}
@@ -0,0 +1,153 @@
+package lowstock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var schedulePeriod = time.Minute
+
+var (
+	digestSuccessCounter = metrics.NewCounter(`digests_total{status="success"}`)
+	digestFailureCounter = metrics.NewCounter(`digests_total{status="failure"}`)
+)
+
+// Scheduler sends digests at the local time configured in chats
+// and alerts deferred by quiet hours and snooze once they end.
+type Scheduler struct {
+	ls     *LowStock
+	ticker *time.Ticker
+}
+
+func NewScheduler(l *LowStock) *Scheduler {
+	return &Scheduler{
+		ls:     l,
+		ticker: time.NewTicker(schedulePeriod),
+	}
+}
+
+// digestPeriod is the time between two digests.
+func digestPeriod(digest string) time.Duration {
+	if digest == digestWeekly {
+		return 7 * 24 * time.Hour
+	}
+
+	return 24 * time.Hour
+}
+
+// scheduledDigest returns the latest digest time of the subscription at or before now.
+// Weekly digests are sent on Mondays.
+func scheduledDigest(sub Subscription, now time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load timezone: %w", err)
+	}
+
+	local := now.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), sub.DigestAt/60, sub.DigestAt%60, 0, 0, loc)
+
+	days := 1
+	if sub.Digest == digestWeekly {
+		days = 7
+		at = at.AddDate(0, 0, -((int(at.Weekday()) + 6) % 7))
+	}
+
+	if at.After(local) {
+		at = at.AddDate(0, 0, -days)
+	}
+
+	return at, nil
+}
+
+// sendDigests sends digests that are due, a failed digest stays due and is retried on the next run.
+func (ls *LowStock) sendDigests(ctx context.Context, now time.Time) {
+	subs, err := ls.storage.AllSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Failed to get subscriptions for digests: %s", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.Digest == "" || sub.Paused {
+			continue
+		}
+
+		at, err := scheduledDigest(sub, now)
+		if err != nil {
+			log.Printf("Failed to schedule digest for chat %d: %s", sub.ChatID, err)
+			continue
+		}
+
+		if sub.LastDigest >= at.Unix() {
+			continue
+		}
+
+		if err := ls.sendDigest(ctx, sub, at); err != nil {
+			digestFailureCounter.Inc()
+			log.Printf("Failed to send digest to chat %d: %s", sub.ChatID, err)
+			continue
+		}
+		digestSuccessCounter.Inc()
+
+		if err := ls.markDigestSent(ctx, sub, now); err != nil {
+			log.Printf("Failed to save digest time of chat %d: %s", sub.ChatID, err)
+		}
+	}
+}
+
+func (ls *LowStock) sendDigest(ctx context.Context, sub Subscription, at time.Time) error {
+	user, err := ls.storage.User(ctx, sub.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get User record: %w", err)
+	}
+
+	// Events missed while the bot was down are limited to a single period.
+	since := time.Unix(sub.LastDigest, 0)
+	if earliest := at.Add(-digestPeriod(sub.Digest)); since.Before(earliest) {
+		since = earliest
+	}
+
+	text, err := ls.renderDigest(ctx, messages(sub.Locale), user, since)
+	if err != nil {
+		return err
+	}
+
+	return ls.send(ctx, sub.EtsyUserID, sub.ChatID, Message{Text: text})
+}
+
+// markDigestSent reads the subscription again, so chat settings changed meanwhile are kept.
+func (ls *LowStock) markDigestSent(ctx context.Context, sub Subscription, now time.Time) error {
+	subs, err := ls.storage.Subscriptions(ctx, sub.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+
+	for _, s := range subs {
+		if s.ChatID == sub.ChatID {
+			s.LastDigest = now.Unix()
+			return ls.storage.SaveSubscription(ctx, s)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Println("Starting digest scheduler...")
+	defer s.ticker.Stop()
+
+	for {
+		select {
+		case now := <-s.ticker.C:
+			s.ls.sendDigests(ctx, now)
+			s.ls.sendDeferredAlerts(ctx, now)
+		case <-ctx.Done():
+			log.Println("Stopping scheduler...")
+			return
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduledDigest(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %s", err)
+	}
+
+	// Wednesday.
+	now := time.Date(2020, 5, 20, 9, 0, 0, 0, berlin)
+
+	tests := []struct {
+		name     string
+		sub      Subscription
+		expected time.Time
+	}{
+		{
+			name:     "daily today",
+			sub:      Subscription{Digest: digestDaily, DigestAt: 8 * 60, Timezone: "Europe/Berlin"},
+			expected: time.Date(2020, 5, 20, 8, 0, 0, 0, berlin),
+		},
+		{
+			name:     "daily yesterday",
+			sub:      Subscription{Digest: digestDaily, DigestAt: 10 * 60, Timezone: "Europe/Berlin"},
+			expected: time.Date(2020, 5, 19, 10, 0, 0, 0, berlin),
+		},
+		{
+			name:     "daily UTC",
+			sub:      Subscription{Digest: digestDaily, DigestAt: 6 * 60},
+			expected: time.Date(2020, 5, 20, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly this Monday",
+			sub:      Subscription{Digest: digestWeekly, DigestAt: 8 * 60, Timezone: "Europe/Berlin"},
+			expected: time.Date(2020, 5, 18, 8, 0, 0, 0, berlin),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := scheduledDigest(tt.sub, now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !actual.Equal(tt.expected) {
+				t.Errorf("Got digest time: %s, expected: %s", actual, tt.expected)
+			}
+		})
+	}
+
+	monday := time.Date(2020, 5, 18, 7, 0, 0, 0, berlin)
+	actual, err := scheduledDigest(Subscription{Digest: digestWeekly, DigestAt: 8 * 60, Timezone: "Europe/Berlin"}, monday)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if expected := time.Date(2020, 5, 11, 8, 0, 0, 0, berlin); !actual.Equal(expected) {
+		t.Errorf("Got digest time: %s, expected: %s", actual, expected)
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	now := time.Date(2020, 5, 20, 9, 0, 0, 0, time.UTC)
+	due := now.Add(-48 * time.Hour).Unix()
+
+	subs := []Subscription{
+		Subscription{EtsyUserID: 1, ChatID: 10, Digest: digestDaily, DigestAt: 8 * 60, LastDigest: due},
+		Subscription{EtsyUserID: 1, ChatID: 20, Digest: digestDaily, DigestAt: 8 * 60, LastDigest: now.Add(-30 * time.Minute).Unix()},
+		Subscription{EtsyUserID: 1, ChatID: 30, Digest: digestDaily, DigestAt: 8 * 60, LastDigest: due, Paused: true},
+		Subscription{EtsyUserID: 1, ChatID: 40},
+	}
+
+	var (
+		since time.Time
+		saved []Subscription
+		sent  []int64
+	)
+	storage := &StorageMock{
+		AllSubscriptionsFunc: func(ctx context.Context) ([]Subscription, error) {
+			return subs, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return subs, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			saved = append(saved, sub)
+			return nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		EventsFunc: func(ctx context.Context, etsyUserID int64, s time.Time) ([]Event, error) {
+			since = s
+			return nil, nil
+		},
+		ListingStatesFunc: func(ctx context.Context, etsyUserID int64) ([]ListingState, error) {
+			return nil, nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			sent = append(sent, msg.ChatID)
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+	ls.sendDigests(context.Background(), now)
+
+	if len(sent) != 1 || sent[0] != 10 {
+		t.Fatalf("Got digests sent to: %v, expected: [10]", sent)
+	}
+
+	// Missed digests are not replayed, a single period is summarised.
+	if expected := now.Add(-25 * time.Hour); !since.Equal(expected) {
+		t.Errorf("Got events since: %s, expected: %s", since, expected)
+	}
+
+	if len(saved) != 1 || saved[0].ChatID != 10 || saved[0].LastDigest != now.Unix() {
+		t.Errorf("Unexpected saved subscriptions: %+v", saved)
+	}
+}
+
+func TestSendDigestsFailed(t *testing.T) {
+	now := time.Date(2020, 5, 20, 9, 0, 0, 0, time.UTC)
+	subs := []Subscription{
+		Subscription{EtsyUserID: 1, ChatID: 10, Digest: digestDaily, DigestAt: 8 * 60, LastDigest: now.Add(-48 * time.Hour).Unix()},
+	}
+
+	storage := &StorageMock{
+		AllSubscriptionsFunc: func(ctx context.Context) ([]Subscription, error) {
+			return subs, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			t.Error("Failed digest must stay due")
+			return nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		EventsFunc: func(ctx context.Context, etsyUserID int64, s time.Time) ([]Event, error) {
+			return nil, nil
+		},
+		ListingStatesFunc: func(ctx context.Context, etsyUserID int64) ([]ListingState, error) {
+			return nil, nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			return errors.New("disk is full")
+		},
+	}
+
+	ls := New(&EtsyMock{}, &MessengerMock{}, storage)
+	ls.sendDigests(context.Background(), now)
+}
@@ -0,0 +1,247 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Subscription delivers alerts of a shop to a chat.
+// A shop can be linked to many chats and a chat can follow many shops.
+type Subscription struct {
+	EtsyUserID int64
+	ChatID     int64
+	// Messenger user that linked the shop to the chat.
+	ChatUserID int64
+
+	// Locale of bot messages and built-in alerts, e.g. "de".
+	Locale string
+	// Paused chats get no alerts until they resume.
+	Paused bool
+	// Chat commands apply to the selected shop of the chat.
+	Selected bool
+
+	// Digest is "daily" or "weekly", empty turns digests off.
+	Digest string
+	// DigestAt is the local time of the digest in minutes after midnight.
+	DigestAt int
+	// Timezone of the chat, IANA name like "Europe/Berlin". Empty is UTC.
+	Timezone string
+	// DigestOnly chats get digests instead of instant alerts.
+	DigestOnly bool
+	// LastDigest is the Unix time the last digest was sent at.
+	LastDigest int64
+
+	// Quiet is "defer" or "silent", empty turns quiet hours off.
+	// Deferred alerts are sent as one message when quiet hours end.
+	Quiet string
+	// Local time quiet hours start and end at, in minutes after midnight.
+	QuietFrom int
+	QuietTo   int
+	// SnoozedUntil is the Unix time alerts are deferred until.
+	SnoozedUntil int64
+}
+
+func activeSubscriptions(subs []Subscription) []Subscription {
+	active := make([]Subscription, 0, len(subs))
+	for _, sub := range subs {
+		if !sub.Paused {
+			active = append(active, sub)
+		}
+	}
+
+	return active
+}
+
+// instantSubscriptions drops subscriptions that get digests only.
+func instantSubscriptions(subs []Subscription) []Subscription {
+	instant := make([]Subscription, 0, len(subs))
+	for _, sub := range subs {
+		if !sub.DigestOnly {
+			instant = append(instant, sub)
+		}
+	}
+
+	return instant
+}
+
+// selectedSubscription returns the selected subscription, the first one if none is selected.
+func selectedSubscription(subs []Subscription) Subscription {
+	for _, sub := range subs {
+		if sub.Selected {
+			return sub
+		}
+	}
+
+	return subs[0]
+}
+
+// chatUser returns the shop selected in the chat, the chat is told to log in if there is none.
+func (ls *LowStock) chatUser(ctx context.Context, msgUpdate MessengerUpdate) (User, Subscription, error) {
+	subs, err := ls.storage.ChatSubscriptions(ctx, msgUpdate.ChatID)
+	if err != nil {
+		return User{}, Subscription{}, fmt.Errorf("failed to get chat subscriptions: %w", err)
+	}
+
+	if len(subs) == 0 {
+		msgs := messages(msgUpdate.LanguageCode)
+		if err := ls.messenger.SendTextMessage(msgs.notLinked, msgUpdate.ChatID); err != nil {
+			return User{}, Subscription{}, fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		return User{}, Subscription{}, ErrNotFound
+	}
+
+	sub := selectedSubscription(subs)
+
+	user, err := ls.storage.User(ctx, sub.EtsyUserID)
+	if err != nil {
+		return User{}, Subscription{}, fmt.Errorf("failed to get User record: %w", err)
+	}
+
+	return user, sub, nil
+}
+
+// subscribe links the shop to the chat and selects it there.
+// Linking a shop again keeps chat settings.
+func (ls *LowStock) subscribe(ctx context.Context, user User, msgUpdate MessengerUpdate) (Subscription, error) {
+	subs, err := ls.storage.ChatSubscriptions(ctx, msgUpdate.ChatID)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to get chat subscriptions: %w", err)
+	}
+
+	sub := Subscription{EtsyUserID: user.EtsyUserID, ChatID: msgUpdate.ChatID}
+	if l, ok := locale(msgUpdate.LanguageCode); ok {
+		sub.Locale = l
+	}
+
+	for _, s := range subs {
+		if s.EtsyUserID == user.EtsyUserID {
+			sub = s
+			continue
+		}
+
+		// Chat language is the same for all shops.
+		if s.Locale != "" {
+			sub.Locale = s.Locale
+		}
+
+		// So are digest settings of the chat.
+		if s.Digest != "" && sub.Digest == "" {
+			sub.Digest, sub.DigestAt, sub.DigestOnly = s.Digest, s.DigestAt, s.DigestOnly
+			sub.LastDigest = s.LastDigest
+		}
+		if s.Timezone != "" && sub.Timezone == "" {
+			sub.Timezone = s.Timezone
+		}
+		if s.Quiet != "" && sub.Quiet == "" {
+			sub.Quiet, sub.QuietFrom, sub.QuietTo = s.Quiet, s.QuietFrom, s.QuietTo
+		}
+		if s.SnoozedUntil > sub.SnoozedUntil {
+			sub.SnoozedUntil = s.SnoozedUntil
+		}
+
+		if s.Selected {
+			s.Selected = false
+			if err := ls.storage.SaveSubscription(ctx, s); err != nil {
+				return Subscription{}, fmt.Errorf("failed to save subscription: %w", err)
+			}
+		}
+	}
+
+	sub.ChatUserID = msgUpdate.UserID
+	sub.Selected = true
+
+	if err := ls.storage.SaveSubscription(ctx, sub); err != nil {
+		return Subscription{}, fmt.Errorf("failed to save subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// updateChatSubscriptions applies the change to every subscription of the chat.
+func (ls *LowStock) updateChatSubscriptions(ctx context.Context, chatID int64, update func(sub *Subscription)) error {
+	subs, err := ls.storage.ChatSubscriptions(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat subscriptions: %w", err)
+	}
+
+	for _, sub := range subs {
+		update(&sub)
+		if err := ls.storage.SaveSubscription(ctx, sub); err != nil {
+			return fmt.Errorf("failed to save subscription: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *bundle) shopName(user User) string {
+	if user.ShopName == "" {
+		return fmt.Sprintf(b.unnamedShop, user.EtsyUserID)
+	}
+
+	return user.ShopName
+}
+
+// DoShops lists shops linked to the chat, "/shops {n}" selects the shop commands apply to.
+func (ls *LowStock) DoShops(ctx context.Context, msgUpdate MessengerUpdate) error {
+	_, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	subs, err := ls.storage.ChatSubscriptions(ctx, msgUpdate.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat subscriptions: %w", err)
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	args := commandArgs(msgUpdate)
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(subs) || len(args) > 1 {
+			if err := ls.messenger.SendTextMessage(msgs.shopsUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send shops usage: %w", err)
+			}
+
+			return ErrBadArguments
+		}
+
+		selected := subs[n-1].EtsyUserID
+		for i := range subs {
+			subs[i].Selected = subs[i].EtsyUserID == selected
+			if err := ls.storage.SaveSubscription(ctx, subs[i]); err != nil {
+				return fmt.Errorf("failed to save subscription: %w", err)
+			}
+		}
+	}
+
+	selected := selectedSubscription(subs).EtsyUserID
+
+	lines := make([]string, 0, len(subs))
+	for i, s := range subs {
+		user, err := ls.storage.User(ctx, s.EtsyUserID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to get User record: %w", err)
+		}
+		user.EtsyUserID = s.EtsyUserID
+
+		line := fmt.Sprintf("%d. %s", i+1, html.EscapeString(msgs.shopName(user)))
+		if s.EtsyUserID == selected {
+			line = "<b>" + line + "</b>"
+		}
+		lines = append(lines, line)
+	}
+
+	msg := fmt.Sprintf(msgs.shops, strings.Join(lines, "\n"))
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send shops: %w", err)
+	}
+
+	return nil
+}
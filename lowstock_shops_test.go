@@ -0,0 +1,137 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleEtsyUpdateFansOut(t *testing.T) {
+	alerts := map[int64]string{}
+
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{
+				Subscription{EtsyUserID: etsyUserID, ChatID: 10},
+				Subscription{EtsyUserID: etsyUserID, ChatID: 20, Locale: "de"},
+				Subscription{EtsyUserID: etsyUserID, ChatID: 30},
+			}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			return false, nil
+		},
+		ForgetUpdateFunc: func(ctx context.Context, key string) error {
+			return nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, State: active, Quantity: 1}, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			alerts[msg.ChatID] = msg.Message.Text
+			if msg.ChatID == 10 {
+				return errors.New("database is closed")
+			}
+
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			return nil, nil
+		},
+	}
+
+	ls := New(etsy, &MessengerMock{}, storage)
+
+	err := ls.HandleEtsyUpdate(context.Background(), Update{State: soldOut, ListingID: 42, UserID: 5432})
+	if err == nil {
+		t.Error("Expected queueing error")
+	}
+
+	if len(alerts) != 3 {
+		t.Fatalf("Got alerts to %d chats, expected: 3", len(alerts))
+	}
+
+	if !strings.HasPrefix(alerts[20], "<b>Ausverkauft:</b>") {
+		t.Errorf("Got alert: %q, expected it in German", alerts[20])
+	}
+}
+
+func TestDoShops(t *testing.T) {
+	subs := []Subscription{
+		Subscription{EtsyUserID: 1, ChatID: 42, Selected: true},
+		Subscription{EtsyUserID: 2, ChatID: 42},
+	}
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return append([]Subscription(nil), subs...), nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			if etsyUserID == 1 {
+				return User{EtsyUserID: 1, ShopName: "MugShop"}, nil
+			}
+
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			subs[sub.EtsyUserID-1] = sub
+			return nil
+		},
+	}
+
+	var reply string
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			reply = msg
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	update := MessengerUpdate{Command: "/shops", Text: "/shops 2", ChatID: 42}
+	if err := ls.DoShops(context.Background(), update); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []Subscription{
+		Subscription{EtsyUserID: 1, ChatID: 42},
+		Subscription{EtsyUserID: 2, ChatID: 42, Selected: true},
+	}
+	if diff := cmp.Diff(expected, subs); diff != "" {
+		t.Errorf("Subscriptions are different:\n%s", diff)
+	}
+
+	if !strings.Contains(reply, "1. MugShop\n<b>2. Etsy user 2</b>") {
+		t.Errorf("Unexpected reply: %s", reply)
+	}
+
+	update.Text = "/shops 3"
+	if err := ls.DoShops(context.Background(), update); !errors.Is(err, ErrBadArguments) {
+		t.Errorf("Got error: %v, expected: %s", err, ErrBadArguments)
+	}
+}
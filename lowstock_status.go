@@ -0,0 +1,95 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"time"
+)
+
+// Updates of a shop are counted over this period.
+var statsPeriod = 24 * time.Hour
+
+const statusTimeFormat = "2 Jan 2006 15:04 MST"
+
+// lastPoll returns the last time the listings feed was read successfully, zero if never.
+// The feed is read up to now and the cursor is saved after that, so the cursor is the time of the read.
+func (ls *LowStock) lastPoll(ctx context.Context) (time.Time, error) {
+	cursor, err := ls.storage.FeedCursor(ctx)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get feed cursor: %w", err)
+	}
+
+	return time.Unix(cursor, 0), nil
+}
+
+// tokenWorks probes the OAuth token, it is valid when Etsy returns the same user.
+func (ls *LowStock) tokenWorks(user User) bool {
+	id, err := ls.etsy.UserID(user.Token, user.TokenSecret)
+	if err != nil {
+		log.Printf("OAuth token of user %d does not work: %s", user.EtsyUserID, err)
+		return false
+	}
+
+	return id == user.EtsyUserID
+}
+
+func (ls *LowStock) DoStatus(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	count, err := ls.storage.UpdateCount(ctx, user.EtsyUserID, time.Now().Add(-statsPeriod))
+	if err != nil {
+		return fmt.Errorf("failed to get update count: %w", err)
+	}
+
+	watches, err := ls.storage.Watches(ctx, user.EtsyUserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get watches: %w", err)
+	}
+
+	polled, err := ls.lastPoll(ctx)
+	if err != nil {
+		return err
+	}
+
+	lastPoll := msgs.never
+	if !polled.IsZero() {
+		lastPoll = polled.UTC().Format(statusTimeFormat)
+	}
+
+	token := msgs.tokenBroken
+	if ls.tokenWorks(user) {
+		token = msgs.tokenOK
+	}
+
+	alerts := msgs.on
+	if sub.Paused {
+		alerts = msgs.off
+	}
+
+	msg := fmt.Sprintf(msgs.status,
+		html.EscapeString(msgs.shopName(user)),
+		lastPoll,
+		count,
+		user.Threshold,
+		len(watches),
+		alerts,
+		token,
+	)
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send status: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokenErr      error
+		lastPoll      time.Time
+		expectedParts []string
+	}{
+		{
+			name:          "token works",
+			lastPoll:      time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC),
+			expectedParts: []string{"Test Shop", "17 May 2020 10:30 UTC", "<b>Updates in the last 24 hours:</b> 7", "<b>Low stock threshold:</b> 3", "<b>Listing and SKU thresholds:</b> 2", tokenOKText},
+		},
+		{
+			name:          "token revoked",
+			tokenErr:      errors.New("oauth_problem=token_revoked"),
+			expectedParts: []string{"<b>Last feed poll:</b> " + neverText, tokenBrokenText},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &StorageMock{
+				ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+					return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+				},
+				UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+					return User{EtsyUserID: etsyUserID, ShopName: "Test Shop", Threshold: 3}, nil
+				},
+				UpdateCountFunc: func(ctx context.Context, etsyUserID int64, since time.Time) (int64, error) {
+					return 7, nil
+				},
+				WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+					return []Watch{Watch{ListingID: 1}, Watch{SKU: "MUG"}}, nil
+				},
+				FeedCursorFunc: func(ctx context.Context) (int64, error) {
+					if tt.lastPoll.IsZero() {
+						return 0, ErrNotFound
+					}
+					return tt.lastPoll.Unix(), nil
+				},
+			}
+
+			etsy := &EtsyMock{
+				UserIDFunc: func(accessToken, accessSecret string) (int64, error) {
+					return 5432, tt.tokenErr
+				},
+			}
+
+			var reply string
+			messenger := &MessengerMock{
+				SendTextMessageFunc: func(text string, chatID int64) error {
+					reply = text
+					return nil
+				},
+			}
+
+			ls := New(etsy, messenger, storage)
+
+			if err := ls.DoStatus(context.Background(), MessengerUpdate{ChatID: 42, Text: "/status"}); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			for _, part := range tt.expectedParts {
+				if !strings.Contains(reply, part) {
+					t.Errorf("Status %q does not contain %q", reply, part)
+				}
+			}
+		})
+	}
+}
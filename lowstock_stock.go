@@ -0,0 +1,162 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Number of listings on a single /stock page.
+var stockPageSize = 10
+
+// Listing of a linked shop as returned by Etsy Open API.
+type Listing struct {
+	ID       int64
+	Title    string
+	State    string
+	Quantity int64
+	SKUs     []string
+}
+
+// lowListings returns sold-out listings of the shop and active listings at or below their threshold.
+// Sold-out listings go first, then listings with the lowest quantity.
+func (ls *LowStock) lowListings(ctx context.Context, user User) ([]Listing, error) {
+	listings, err := ls.etsy.ShopListings(ctx, user.Token, user.TokenSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shop listings: %w", err)
+	}
+
+	watches, err := ls.storage.Watches(ctx, user.EtsyUserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to get watches: %w", err)
+	}
+
+	var low []Listing
+	for _, l := range listings {
+		switch l.State {
+		case soldOut:
+			low = append(low, l)
+		case active:
+			if t := listingThreshold(user, watches, l.ID, l.SKUs); t > 0 && l.Quantity <= t {
+				low = append(low, l)
+			}
+		}
+	}
+
+	sort.SliceStable(low, func(i, j int) bool {
+		si, sj := low[i].State == soldOut, low[j].State == soldOut
+		if si != sj {
+			return si
+		}
+
+		if low[i].Quantity != low[j].Quantity {
+			return low[i].Quantity < low[j].Quantity
+		}
+
+		return low[i].Title < low[j].Title
+	})
+
+	return low, nil
+}
+
+// stockPage renders a page of listings with buttons to the previous and the next page.
+// Pages are numbered from 1, out of range pages are clamped.
+func stockPage(msgs *bundle, shopName string, listings []Listing, page int) Message {
+	pages := (len(listings) + stockPageSize - 1) / stockPageSize
+	if page > pages {
+		page = pages
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	lines := []string{fmt.Sprintf(msgs.stock, html.EscapeString(shopName), page, pages)}
+
+	start := (page - 1) * stockPageSize
+	end := start + stockPageSize
+	if end > len(listings) {
+		end = len(listings)
+	}
+
+	for _, l := range listings[start:end] {
+		url := fmt.Sprintf(listingURLFormat, l.ID)
+		title := html.EscapeString(l.Title)
+
+		if l.State == soldOut {
+			lines = append(lines, fmt.Sprintf(msgs.stockSoldOut, url, title))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf(msgs.stockLow, url, title, l.Quantity))
+	}
+
+	var row []Button
+	if page > 1 {
+		row = append(row, Button{Text: fmt.Sprintf("« %d", page-1), Data: fmt.Sprintf("/stock %d", page-1)})
+	}
+	if page < pages {
+		row = append(row, Button{Text: fmt.Sprintf("%d »", page+1), Data: fmt.Sprintf("/stock %d", page+1)})
+	}
+
+	msg := Message{Text: strings.Join(lines, "\n")}
+	if len(row) > 0 {
+		msg.Buttons = [][]Button{row}
+	}
+
+	return msg
+}
+
+// DoStock lists low and sold-out listings of the selected shop, "/stock {page}" opens a page.
+// Pressed page buttons edit the list in place.
+func (ls *LowStock) DoStock(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	page := 1
+	if args := commandArgs(msgUpdate); len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || len(args) > 1 {
+			if err := ls.messenger.SendTextMessage(msgs.stockUsage, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send stock usage: %w", err)
+			}
+
+			return ErrBadArguments
+		}
+		page = n
+	}
+
+	low, err := ls.lowListings(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	shopName := msgs.shopName(user)
+
+	msg := Message{Text: fmt.Sprintf(msgs.stockEmpty, html.EscapeString(shopName))}
+	if len(low) > 0 {
+		msg = stockPage(msgs, shopName, low, page)
+	}
+
+	if msgUpdate.CallbackID != "" && msgUpdate.MessageID != 0 {
+		if err := ls.messenger.EditMessage(msg, msgUpdate.ChatID, msgUpdate.MessageID); err != nil {
+			return fmt.Errorf("failed to edit stock list: %w", err)
+		}
+
+		return nil
+	}
+
+	msg.Reply = true
+	if err := ls.messenger.SendMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send stock list: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package lowstock
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLowListings(t *testing.T) {
+	storage := &StorageMock{
+		WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+			return []Watch{
+				Watch{EtsyUserID: etsyUserID, ListingID: 3, Threshold: 0},
+				Watch{EtsyUserID: etsyUserID, SKU: "MUG-RED", Threshold: 10},
+			}, nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ShopListingsFunc: func(ctx context.Context, accessToken, accessSecret string) ([]Listing, error) {
+			return []Listing{
+				Listing{ID: 1, Title: "Plate", State: active, Quantity: 2},
+				Listing{ID: 2, Title: "Bowl", State: active, Quantity: 50},
+				Listing{ID: 3, Title: "Vase", State: active, Quantity: 1},
+				Listing{ID: 4, Title: "Mug", State: active, Quantity: 8, SKUs: []string{"MUG-RED"}},
+				Listing{ID: 5, Title: "Cup", State: soldOut},
+				Listing{ID: 6, Title: "Jug", State: edit},
+			}, nil
+		},
+	}
+
+	ls := New(etsy, &MessengerMock{}, storage)
+
+	low, err := ls.lowListings(context.Background(), User{EtsyUserID: 5432, Threshold: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var ids []int64
+	for _, l := range low {
+		ids = append(ids, l.ID)
+	}
+
+	if diff := cmp.Diff([]int64{5, 1, 4}, ids); diff != "" {
+		t.Errorf("Listings do not match:\n%s", diff)
+	}
+}
+
+func TestStockPage(t *testing.T) {
+	var listings []Listing
+	for i := 1; i <= 25; i++ {
+		listings = append(listings, Listing{ID: int64(i), Title: "Mug", State: active, Quantity: 1})
+	}
+
+	tests := []struct {
+		page            int
+		expectedHeader  string
+		expectedButtons [][]Button
+	}{
+		{
+			page:            1,
+			expectedHeader:  "page 1 of 3",
+			expectedButtons: [][]Button{[]Button{Button{Text: "2 »", Data: "/stock 2"}}},
+		},
+		{
+			page:           2,
+			expectedHeader: "page 2 of 3",
+			expectedButtons: [][]Button{[]Button{
+				Button{Text: "« 1", Data: "/stock 1"},
+				Button{Text: "3 »", Data: "/stock 3"},
+			}},
+		},
+		{
+			page:            9,
+			expectedHeader:  "page 3 of 3",
+			expectedButtons: [][]Button{[]Button{Button{Text: "« 2", Data: "/stock 2"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		msg := stockPage(&enBundle, "Test Shop", listings, tt.page)
+
+		if !strings.Contains(msg.Text, tt.expectedHeader) {
+			t.Errorf("Page %d text %q does not contain %q", tt.page, msg.Text, tt.expectedHeader)
+		}
+
+		if diff := cmp.Diff(tt.expectedButtons, msg.Buttons); diff != "" {
+			t.Errorf("Page %d buttons do not match:\n%s", tt.page, diff)
+		}
+	}
+}
+
+func TestDoStockEditsOnCallback(t *testing.T) {
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID, ShopName: "Test Shop"}, nil
+		},
+		WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+			return nil, nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ShopListingsFunc: func(ctx context.Context, accessToken, accessSecret string) ([]Listing, error) {
+			return []Listing{Listing{ID: 5, Title: "Cup & Saucer", State: soldOut}}, nil
+		},
+	}
+
+	var (
+		edited   string
+		answered string
+	)
+	messenger := &MessengerMock{
+		EditMessageFunc: func(msg Message, chatID, messageID int64) error {
+			if messageID != 99 {
+				t.Errorf("Got message ID: %d, expected: 99", messageID)
+			}
+			edited = msg.Text
+			return nil
+		},
+		AnswerCallbackFunc: func(callbackID string) error {
+			answered = callbackID
+			return nil
+		},
+	}
+
+	ls := New(etsy, messenger, storage)
+
+	msgUpdate := MessengerUpdate{ChatID: 42, Command: "/stock", Text: "/stock 1", CallbackID: "cb-1", MessageID: 99}
+	if err := ls.handleUpdate(context.Background(), msgUpdate); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.Contains(edited, "Cup &amp; Saucer</a> — sold out") {
+		t.Errorf("Unexpected stock list: %q", edited)
+	}
+
+	if answered != "cb-1" {
+		t.Errorf("Got answered callback: %q, expected: %q", answered, "cb-1")
+	}
+}
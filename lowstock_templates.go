@@ -0,0 +1,182 @@
+package lowstock
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const maxTemplateLength = 2000
+
+var templateErrorsCounter = metrics.NewCounter(`alert_template_errors_total`)
+
+// Tags Telegram accepts in HTML formatted messages.
+var allowedTags = map[string]bool{
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+	"s": true, "strike": true, "del": true, "a": true, "code": true, "pre": true,
+}
+
+// validateHTML makes sure the text can be sent as an HTML formatted message.
+func validateHTML(text string) error {
+	d := xml.NewDecoder(strings.NewReader("<root>" + text + "</root>"))
+	d.Strict = true
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("bad HTML: %w", err)
+		}
+
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local != "root" && !allowedTags[el.Name.Local] {
+			return fmt.Errorf("unsupported tag: <%s>", el.Name.Local)
+		}
+	}
+}
+
+// executeUserTemplate renders the user template, it fails on empty, malformed or too long output.
+func executeUserTemplate(text string, data AlertData) (string, error) {
+	tmpl, err := template.New("user").Funcs(alertFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	out := strings.TrimSpace(buf.String())
+	if out == "" {
+		return "", errors.New("template renders empty text")
+	}
+
+	if utf8.RuneCountInString(out) > maxMessageLength {
+		return "", fmt.Errorf("template renders text longer than %d characters", maxMessageLength)
+	}
+
+	if err := validateHTML(out); err != nil {
+		return "", err
+	}
+
+	return out, nil
+}
+
+// validateUserTemplate renders the template for every alert kind using sample data.
+func validateUserTemplate(text string) error {
+	if len(text) > maxTemplateLength {
+		return fmt.Errorf("template is longer than %d characters", maxTemplateLength)
+	}
+
+	sample := Update{
+		State:           active,
+		Title:           "Sample listing",
+		ShopName:        "SampleShop",
+		ListingID:       1,
+		UserID:          1,
+		Quantity:        2,
+		CreationTSZ:     1580000000,
+		LastModifiedTSZ: 1580000000,
+	}
+
+	for _, kind := range []string{alertSoldOut, alertLowStock, alertRestocked, alertExpired, alertRemoved} {
+		if _, err := executeUserTemplate(text, newAlertData(kind, sample, []string{"SKU-1", "SKU-2"})); err != nil {
+			return fmt.Errorf("%s alert: %w", kind, err)
+		}
+	}
+
+	return nil
+}
+
+// renderUserAlert renders the alert with the user template.
+// Built-in template is used when there is no user template or it fails.
+func renderUserAlert(user User, sub Subscription, data AlertData) (Message, error) {
+	msgs := messages(sub.Locale)
+
+	if user.Template != "" {
+		text, err := executeUserTemplate(user.Template, data)
+		if err == nil {
+			return Message{Text: text, Buttons: alertButtons(msgs, data)}, nil
+		}
+
+		templateErrorsCounter.Inc()
+		log.Printf("Failed to render template of user %d, using default: %s", user.EtsyUserID, err)
+	}
+
+	return renderAlert(msgs, data)
+}
+
+func (ls *LowStock) DoTemplate(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	// Template text keeps its line breaks, arguments are not split.
+	rest := strings.TrimSpace(strings.TrimPrefix(msgUpdate.Text, msgUpdate.Command))
+
+	action := ""
+	if fields := strings.Fields(rest); len(fields) > 0 {
+		action = fields[0]
+	}
+
+	if action == "set" || action == "reset" {
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	var msg string
+	switch action {
+	case "":
+		msg = msgs.templateDefault
+		if user.Template != "" {
+			msg = fmt.Sprintf(msgs.template, html.EscapeString(user.Template))
+		}
+	case "reset":
+		user.Template = ""
+		if err := ls.storage.SaveUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user details: %w", err)
+		}
+		msg = msgs.templateReset
+	case "set":
+		text := strings.TrimSpace(strings.TrimPrefix(rest, "set"))
+		if text == "" {
+			msg = msgs.templateUsage
+			break
+		}
+
+		if err := validateUserTemplate(text); err != nil {
+			msg = fmt.Sprintf(msgs.templateError, html.EscapeString(err.Error()))
+			break
+		}
+
+		user.Template = text
+		if err := ls.storage.SaveUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user details: %w", err)
+		}
+		msg = msgs.templateSaved
+	default:
+		msg = msgs.templateUsage
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send template reply: %w", err)
+	}
+
+	return nil
+}
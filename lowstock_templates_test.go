@@ -0,0 +1,129 @@
+package lowstock
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidateUserTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		valid bool
+	}{
+		{name: "fields", text: `<b>{{.Kind}}</b>: {{html .Title}} ({{join .SKUs ", "}})`, valid: true},
+		{name: "branches", text: `{{if eq .Kind "sold_out"}}Sold out{{else}}{{.Quantity}} left{{end}}`, valid: true},
+		{name: "syntax", text: `{{.Title`},
+		{name: "unknown field", text: `{{.Token}}`},
+		{name: "unbalanced tag", text: `<b>{{.Title}}`},
+		{name: "unsupported tag", text: `<div>{{.Title}}</div>`},
+		{name: "empty output", text: `{{if false}}x{{end}}`},
+		{name: "too long", text: strings.Repeat("a", maxTemplateLength+1)},
+		{name: "too long output", text: `{{printf "%05000d" .Quantity}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUserTemplate(tt.text)
+			if tt.valid && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if !tt.valid && err == nil {
+				t.Error("Expected template to be rejected")
+			}
+		})
+	}
+}
+
+func TestRenderUserAlertFallsBackToDefault(t *testing.T) {
+	data := newAlertData(alertSoldOut, Update{Title: "Mug", ListingID: 42}, nil)
+
+	user := User{Template: `{{index .SKUs 3}}`}
+
+	msg, err := renderUserAlert(user, Subscription{}, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(msg.Text, "<b>Sold out:</b> Mug") {
+		t.Errorf("Got text: %q, expected the built-in template", msg.Text)
+	}
+
+	user.Template = `Gone: {{html .Title}}`
+
+	msg, err = renderUserAlert(user, Subscription{}, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if msg.Text != "Gone: Mug" {
+		t.Errorf("Got text: %q, expected user template", msg.Text)
+	}
+
+	user.Template = `{{range .SKUs}}{{printf "%02000d" 0}}{{end}}`
+	data.SKUs = []string{"MUG-1", "MUG-2", "MUG-3"}
+
+	msg, err = renderUserAlert(user, Subscription{}, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(msg.Text, "<b>Sold out:</b> Mug") {
+		t.Errorf("Got text: %q, expected the built-in template for too long output", msg.Text)
+	}
+}
+
+func TestDoTemplate(t *testing.T) {
+	user := User{EtsyUserID: 12}
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: user.EtsyUserID, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return user, nil
+		},
+		SaveUserFunc: func(ctx context.Context, u User) error {
+			user = u
+			return nil
+		},
+	}
+
+	var reply string
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			reply = msg
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	tests := []struct {
+		text          string
+		expectedReply string
+		expected      string
+	}{
+		{text: "/template set {{.Title}}\nleft: {{.Quantity}}", expectedReply: templateSavedMsg, expected: "{{.Title}}\nleft: {{.Quantity}}"},
+		{text: "/template set <div>{{.Title}}</div>", expected: "{{.Title}}\nleft: {{.Quantity}}"},
+		{text: "/template reset", expectedReply: templateResetMsg, expected: ""},
+		{text: "/template", expectedReply: templateDefaultMsg, expected: ""},
+	}
+
+	for _, tt := range tests {
+		update := MessengerUpdate{Command: "/template", Text: tt.text, ChatID: 42}
+		if err := ls.DoTemplate(context.Background(), update); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if tt.expectedReply != "" && reply != tt.expectedReply {
+			t.Errorf("Got reply: %q for %q, expected: %q", reply, tt.text, tt.expectedReply)
+		}
+
+		if user.Template != tt.expected {
+			t.Errorf("Got template: %q after %q, expected: %q", user.Template, tt.text, tt.expected)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package lowstock
 import (
 	"context"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,15 +17,28 @@ func TestUpdates(t *testing.T) {
 		Update{State: expired},
 	}
 
+	var (
+		expectedOffset int64 = 1580000000
+		expectedLimit        = 10 * time.Minute
+	)
+
 	etsy := &EtsyMock{
-		UpdatesFunc: func(ctx context.Context) ([]Update, error) {
+		UpdatesFunc: func(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error) {
+			if timeOffset != expectedOffset {
+				t.Errorf("Got time offset: %d, expected: %d", timeOffset, expectedOffset)
+			}
+
+			if timeLimit != expectedLimit {
+				t.Errorf("Got time limit: %s, expected: %s", timeLimit, expectedLimit)
+			}
+
 			return etsyUpdates, nil
 		},
 	}
 
 	ls := New(etsy, nil, nil)
 
-	actualUpdates, err := ls.Updates(context.Background())
+	actualUpdates, err := ls.Updates(context.Background(), expectedOffset, expectedLimit)
 	if err != nil {
 		t.Fatalf("Unexpected error: %s", err)
 	}
@@ -42,34 +57,77 @@ func TestHandleEtsyUpdate(t *testing.T) {
 		expectedSecret           = "test_secret"
 	)
 
+	var alerts int
+
 	storage := &StorageMock{
 		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
 			return User{
 				EtsyUserID:  expectedEtsyUserID,
-				ChatUserID:  expectedUserID,
-				ChatID:      expectedChatID,
 				Token:       expectedToken,
 				TokenSecret: expectedSecret,
 			}, nil
 		},
-	}
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{
+				Subscription{EtsyUserID: etsyUserID, ChatID: expectedChatID, ChatUserID: expectedUserID},
+				Subscription{EtsyUserID: etsyUserID, ChatID: 1, Paused: true},
+			}, nil
+		},
+		SaveUserFunc: func(ctx context.Context, user User) error {
+			if user.ShopName != "Test shop" {
+				t.Errorf("Got shop name: %q, expected: %q", user.ShopName, "Test shop")
+			}
 
-	etsy := &EtsyMock{
-		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
-			return []string{"TestSKU#1", "TestSKU#2"}, nil
+			return nil
 		},
-	}
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			return false, nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, EtsyUserID: 123456, State: active, Quantity: 1}, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			if state.State != soldOut {
+				t.Errorf("Got listing state: %s, expected: %s", state.State, soldOut)
+			}
 
-	messenger := &MessengerMock{
-		SendTextMessageFunc: func(msg string, chatID int64) error {
-			if chatID != expectedChatID {
-				t.Errorf("Got chat ID: %d, expected: %d", chatID, expectedChatID)
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			alerts++
+
+			if msg.ChatID != expectedChatID {
+				t.Errorf("Got chat ID: %d, expected: %d", msg.ChatID, expectedChatID)
+			}
+
+			if !strings.Contains(msg.Message.Text, "TestSKU#1, TestSKU#2") {
+				t.Errorf("SKUs are missing in the message: %s", msg.Message.Text)
 			}
 
 			return nil
 		},
 	}
 
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			return []string{"TestSKU#1", "TestSKU#2"}, nil
+		},
+	}
+
+	messenger := &MessengerMock{}
+
 	ls := New(etsy, messenger, storage)
 
 	update := Update{
@@ -86,10 +144,15 @@ func TestHandleEtsyUpdate(t *testing.T) {
 	if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
 		t.Fatalf("Unexpected error: %s", err)
 	}
+
+	// The paused chat gets no alert.
+	if alerts != 1 {
+		t.Errorf("Got %d alerts, expected: 1", alerts)
+	}
 }
 
 func TestHandleEtsyUpdateUnsupportedState(t *testing.T) {
-	states := []string{active, expired, removed, edit, vacation, private, unavailable}
+	states := []string{edit, vacation, private, unavailable}
 
 	var (
 		storage   = &StorageMock{}
@@ -137,6 +200,580 @@ func TestHandleEtsyUpdateUnknownUserID(t *testing.T) {
 	}
 }
 
+func TestHandleEtsyUpdateLowStock(t *testing.T) {
+	var (
+		expectedChatID int64 = 100500
+		threshold      int64 = 3
+		quantities           = []int64{5, 3, 2, 4, 1, 0}
+		expectedAlerts       = []int64{3, 1}
+	)
+
+	states := map[int64]ListingState{}
+
+	var (
+		alerts  []int64
+		current int64
+	)
+
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID, Threshold: threshold}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: etsyUserID, ChatID: expectedChatID}}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			return false, nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			state, ok := states[listingID]
+			if !ok {
+				return ListingState{}, ErrNotFound
+			}
+
+			return state, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			states[state.ListingID] = state
+			return nil
+		},
+		WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+			return nil, nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			if msg.ChatID != expectedChatID {
+				t.Errorf("Got chat ID: %d, expected: %d", msg.ChatID, expectedChatID)
+			}
+
+			alerts = append(alerts, current)
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			return []string{"TestSKU#1"}, nil
+		},
+	}
+
+	messenger := &MessengerMock{}
+
+	ls := New(etsy, messenger, storage)
+
+	for _, current = range quantities {
+		update := Update{
+			State:     active,
+			ListingID: 42,
+			UserID:    123456,
+			Quantity:  current,
+		}
+
+		if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	if diff := cmp.Diff(expectedAlerts, alerts); diff != "" {
+		t.Errorf("Alerts do not match:\n%s", diff)
+	}
+}
+
+func TestHandleEtsyUpdateConcurrent(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		states = map[int64]ListingState{}
+		alerts int
+	)
+
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID, Threshold: 3}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: etsyUserID, ChatID: 100500}}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			return false, nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			state, ok := states[listingID]
+			if !ok {
+				return ListingState{}, ErrNotFound
+			}
+
+			return state, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			states[state.ListingID] = state
+			return nil
+		},
+		WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+			return nil, nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			alerts++
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			// Give other handlers a chance to read the state in the meantime.
+			time.Sleep(time.Millisecond)
+			return []string{"TestSKU#1"}, nil
+		},
+	}
+
+	ls := New(etsy, &MessengerMock{}, storage)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			update := Update{State: active, ListingID: 42, UserID: 123456, Quantity: 2, LastModifiedTSZ: int64(i)}
+			if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if alerts != 1 {
+		t.Errorf("Got %d alerts, expected: 1", alerts)
+	}
+}
+
+func TestHandleEtsyUpdateTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     User
+		states   []string
+		expected []string
+	}{
+		{
+			name:     "opted in",
+			user:     User{NotifyRestocked: true, NotifyExpired: true, NotifyRemoved: true},
+			states:   []string{active, soldOut, active, active, expired, expired, removed},
+			expected: []string{"<b>Sold out:</b>", "<b>Back in stock:</b>", "<b>Listing expired:</b>", "<b>Listing removed:</b>"},
+		},
+		{
+			name:     "opted out",
+			user:     User{},
+			states:   []string{active, soldOut, active, expired, removed},
+			expected: []string{"<b>Sold out:</b>"},
+		},
+		{
+			name:     "first seen sold out and repeated",
+			user:     User{NotifyRestocked: true, NotifyExpired: true, NotifyRemoved: true},
+			states:   []string{soldOut, soldOut, active, soldOut, soldOut},
+			expected: []string{"<b>Sold out:</b>", "<b>Back in stock:</b>", "<b>Sold out:</b>"},
+		},
+		{
+			name:     "first seen expired",
+			user:     User{NotifyExpired: true, NotifyRemoved: true},
+			states:   []string{expired, expired},
+			expected: nil,
+		},
+		{
+			name:     "first seen removed",
+			user:     User{NotifyExpired: true, NotifyRemoved: true},
+			states:   []string{removed, removed},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := map[int64]ListingState{}
+
+			var alerts []string
+			storage := &StorageMock{
+				UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+					return tt.user, nil
+				},
+				SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+					return []Subscription{Subscription{ChatID: 42}}, nil
+				},
+				SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+					return false, nil
+				},
+				CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+					return nil
+				},
+				MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+					return nil, nil
+				},
+				SaveEventFunc: func(ctx context.Context, event Event) error {
+					return nil
+				},
+				ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+					state, ok := states[listingID]
+					if !ok {
+						return ListingState{}, ErrNotFound
+					}
+
+					return state, nil
+				},
+				WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+					return nil, nil
+				},
+				SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+					states[state.ListingID] = state
+					return nil
+				},
+				WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+					return nil, nil
+				},
+				EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+					alerts = append(alerts, msg.Message.Text)
+					return nil
+				},
+			}
+
+			etsy := &EtsyMock{
+				ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+					return []string{"TestSKU#1"}, nil
+				},
+			}
+
+			messenger := &MessengerMock{}
+
+			ls := New(etsy, messenger, storage)
+
+			for _, state := range tt.states {
+				update := Update{State: state, ListingID: 42, Quantity: 5}
+				if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+			}
+
+			if len(alerts) != len(tt.expected) {
+				t.Fatalf("Got alerts: %q, expected: %q", alerts, tt.expected)
+			}
+
+			for i, prefix := range tt.expected {
+				if !strings.HasPrefix(alerts[i], prefix) {
+					t.Errorf("Got alert: %q, expected it to start with: %q", alerts[i], prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestDoNotify(t *testing.T) {
+	var saved User
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID, NotifyExpired: true}, nil
+		},
+		SaveUserFunc: func(ctx context.Context, user User) error {
+			saved = user
+			return nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	update := MessengerUpdate{Command: "/notify", Text: "/notify restocked on", ChatID: 42}
+	if err := ls.DoNotify(context.Background(), update); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !saved.NotifyRestocked || !saved.NotifyExpired || saved.NotifyRemoved {
+		t.Errorf("Unexpected notification settings: %+v", saved)
+	}
+
+	update.Text = "/notify sold on"
+	if err := ls.DoNotify(context.Background(), update); !errors.Is(err, ErrBadArguments) {
+		t.Errorf("Got error: %v, expected: %s", err, ErrBadArguments)
+	}
+}
+
+func TestHandleEtsyUpdateDuplicate(t *testing.T) {
+	seen := map[string]bool{}
+	counted := 0
+	sent := 0
+
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: etsyUserID, ChatID: 42}}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			if seen[key] {
+				return true, nil
+			}
+
+			seen[key] = true
+			return false, nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			counted++
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, State: active, Quantity: 1}, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			sent++
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			return []string{"TestSKU#1"}, nil
+		},
+	}
+
+	messenger := &MessengerMock{}
+
+	ls := New(etsy, messenger, storage)
+
+	updates := []Update{
+		Update{State: soldOut, ListingID: 42, LastModifiedTSZ: 1000},
+		Update{State: soldOut, ListingID: 42, LastModifiedTSZ: 1000},
+		Update{State: soldOut, ListingID: 42, LastModifiedTSZ: 2000},
+	}
+
+	for _, update := range updates {
+		if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	if sent != 2 {
+		t.Errorf("Got %d alerts, expected: 2", sent)
+	}
+
+	if counted != 2 {
+		t.Errorf("Got %d counted updates, expected: 2", counted)
+	}
+}
+
+func TestHandleEtsyUpdateReplayAfterFailure(t *testing.T) {
+	seen := map[string]bool{}
+	sent := 0
+	failures := 1
+
+	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SubscriptionsFunc: func(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: etsyUserID, ChatID: 42}}, nil
+		},
+		SeenUpdateFunc: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			if seen[key] {
+				return true, nil
+			}
+
+			seen[key] = true
+			return false, nil
+		},
+		ForgetUpdateFunc: func(ctx context.Context, key string) error {
+			delete(seen, key)
+			return nil
+		},
+		CountUpdateFunc: func(ctx context.Context, etsyUserID int64, at time.Time) error {
+			return nil
+		},
+		MutesFunc: func(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+			return nil, nil
+		},
+		SaveEventFunc: func(ctx context.Context, event Event) error {
+			return nil
+		},
+		ListingStateFunc: func(ctx context.Context, listingID int64) (ListingState, error) {
+			return ListingState{ListingID: listingID, State: active, Quantity: 1}, nil
+		},
+		WebhooksFunc: func(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+			return nil, nil
+		},
+		SaveListingStateFunc: func(ctx context.Context, state ListingState) error {
+			return nil
+		},
+		EnqueueMessageFunc: func(ctx context.Context, msg OutboxMessage) error {
+			sent++
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			if failures > 0 {
+				failures--
+				return nil, errors.New("etsy is down")
+			}
+
+			return []string{"TestSKU#1"}, nil
+		},
+	}
+
+	ls := New(etsy, &MessengerMock{}, storage)
+
+	update := Update{State: soldOut, ListingID: 42, LastModifiedTSZ: 1000}
+
+	if err := ls.HandleEtsyUpdate(context.Background(), update); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if err := ls.HandleEtsyUpdate(context.Background(), update); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if sent != 1 {
+		t.Errorf("Got %d alerts, expected: 1", sent)
+	}
+
+	if !seen[update.seenKey()] {
+		t.Error("Handled update is not marked as seen")
+	}
+}
+
+func TestDoThreshold(t *testing.T) {
+	var (
+		expectedChatID    int64 = 100500
+		expectedThreshold int64 = 3
+	)
+
+	saved := false
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			if chatID != expectedChatID {
+				t.Errorf("Got chat ID: %d, expected: %d", chatID, expectedChatID)
+			}
+
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+		SaveUserFunc: func(ctx context.Context, user User) error {
+			if user.Threshold != expectedThreshold {
+				t.Errorf("Got threshold: %d, expected: %d", user.Threshold, expectedThreshold)
+			}
+
+			saved = true
+			return nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	update := MessengerUpdate{
+		Command: "/threshold",
+		Text:    "/threshold 3",
+		ChatID:  expectedChatID,
+	}
+
+	if err := ls.DoThreshold(context.Background(), update); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !saved {
+		t.Error("Threshold was not saved")
+	}
+}
+
+func TestDoThresholdBadArguments(t *testing.T) {
+	inputs := []string{"/threshold three", "/threshold -1", "/threshold 1 2"}
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 5432, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			if msg != thresholdUsageMsg {
+				t.Error("Unexpected message")
+			}
+
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	for _, text := range inputs {
+		update := MessengerUpdate{Command: "/threshold", Text: text, ChatID: 42}
+
+		if err := ls.DoThreshold(context.Background(), update); !errors.Is(err, ErrBadArguments) {
+			t.Errorf("Got error: %v for %q, expected: %s", err, text, ErrBadArguments)
+		}
+	}
+}
+
 func TestDoEmptyPin(t *testing.T) {
 	var (
 		expectedChatID int64 = 100500
@@ -196,13 +833,26 @@ func TestDoPin(t *testing.T) {
 
 	expectedUser := User{
 		EtsyUserID:  expectedEtsyUserID,
-		ChatUserID:  expectedUserID,
-		ChatID:      expectedChatID,
 		Token:       finalToken,
 		TokenSecret: finalTokenSecret,
 	}
 
+	expectedSubs := map[int64]Subscription{
+		expectedEtsyUserID: Subscription{
+			EtsyUserID: expectedEtsyUserID,
+			ChatID:     expectedChatID,
+			ChatUserID: expectedUserID,
+			Locale:     "de",
+			Selected:   true,
+		},
+		1: Subscription{EtsyUserID: 1, ChatID: expectedChatID, ChatUserID: 1},
+	}
+	savedSubs := map[int64]Subscription{}
+
 	storage := &StorageMock{
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{}, ErrNotFound
+		},
 		TokenDetailsFunc: func(ctx context.Context, id int64) (TokenDetails, error) {
 			if id != expectedUserID {
 				t.Errorf("Got user ID: %d, expected: %d", id, expectedUserID)
@@ -220,11 +870,19 @@ func TestDoPin(t *testing.T) {
 
 			return nil
 		},
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			// Another shop is linked to the chat already.
+			return []Subscription{Subscription{EtsyUserID: 1, ChatID: chatID, ChatUserID: 1, Selected: true}}, nil
+		},
+		SaveSubscriptionFunc: func(ctx context.Context, sub Subscription) error {
+			savedSubs[sub.EtsyUserID] = sub
+			return nil
+		},
 	}
 
 	messenger := &MessengerMock{
 		SendTextMessageFunc: func(msg string, chatID int64) error {
-			if msg != successMsg {
+			if msg != deBundle.success {
 				t.Error("Unexpected message")
 			}
 
@@ -263,23 +921,32 @@ func TestDoPin(t *testing.T) {
 	ls := New(etsy, messenger, storage)
 
 	update := MessengerUpdate{
-		Command: "/pin",
-		Text:    "/pin " + expectedPin,
-		ChatID:  expectedChatID,
-		UserID:  expectedUserID,
+		Command:      "/pin",
+		Text:         "/pin " + expectedPin,
+		ChatID:       expectedChatID,
+		UserID:       expectedUserID,
+		LanguageCode: "de-DE",
 	}
 
 	err := ls.DoPin(context.Background(), update)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
+
+	if diff := cmp.Diff(expectedSubs, savedSubs); diff != "" {
+		t.Errorf("Subscriptions are different:\n%s", diff)
+	}
 }
 
 func TestDoHelp(t *testing.T) {
 	var expectedChatID int64 = 42
 
 	etsy := &EtsyMock{}
-	storage := &StorageMock{}
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return nil, nil
+		},
+	}
 
 	messageSent := false
 
@@ -373,11 +1040,12 @@ func TestDoStart(t *testing.T) {
 }
 
 type EtsyMock struct {
-	CallbackFunc    func(ctx context.Context, pin, token, secret string) (TokenDetails, error)
-	LoginFunc       func(ctx context.Context, id int64) (string, TokenDetails, error)
-	ListingSKUsFunc func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error)
-	UserIDFunc      func(accessToken, accessSecret string) (int64, error)
-	UpdatesFunc     func(ctx context.Context) ([]Update, error)
+	CallbackFunc     func(ctx context.Context, pin, token, secret string) (TokenDetails, error)
+	LoginFunc        func(ctx context.Context, id int64) (string, TokenDetails, error)
+	ListingSKUsFunc  func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error)
+	UserIDFunc       func(accessToken, accessSecret string) (int64, error)
+	UpdatesFunc      func(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error)
+	ShopListingsFunc func(ctx context.Context, accessToken, accessSecret string) ([]Listing, error)
 }
 
 func (e *EtsyMock) Callback(ctx context.Context, pin, token, secret string) (TokenDetails, error) {
@@ -396,14 +1064,22 @@ func (e *EtsyMock) UserID(accessToken, accessSecret string) (int64, error) {
 	return e.UserIDFunc(accessToken, accessSecret)
 }
 
-func (e *EtsyMock) Updates(ctx context.Context) ([]Update, error) {
-	return e.UpdatesFunc(ctx)
+func (e *EtsyMock) Updates(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error) {
+	return e.UpdatesFunc(ctx, timeOffset, timeLimit)
+}
+
+func (e *EtsyMock) ShopListings(ctx context.Context, accessToken, accessSecret string) ([]Listing, error) {
+	return e.ShopListingsFunc(ctx, accessToken, accessSecret)
 }
 
 type MessengerMock struct {
 	SendLoginURLFunc    func(text, url string, chatID int64) error
 	SendTextMessageFunc func(msg string, chatID int64) error
+	SendMessageFunc     func(msg Message, chatID int64) error
+	EditMessageFunc     func(msg Message, chatID, messageID int64) error
+	AnswerCallbackFunc  func(callbackID string) error
 	UpdatesFunc         func(lastMsgID int64) ([]MessengerUpdate, error)
+	IsChatAdminFunc     func(chatID, userID int64) (bool, error)
 }
 
 func (m *MessengerMock) SendLoginURL(text, url string, chatID int64) error {
@@ -414,15 +1090,86 @@ func (m *MessengerMock) SendTextMessage(msg string, chatID int64) error {
 	return m.SendTextMessageFunc(msg, chatID)
 }
 
+func (m *MessengerMock) SendMessage(msg Message, chatID int64) error {
+	return m.SendMessageFunc(msg, chatID)
+}
+
+func (m *MessengerMock) EditMessage(msg Message, chatID, messageID int64) error {
+	return m.EditMessageFunc(msg, chatID, messageID)
+}
+
+func (m *MessengerMock) AnswerCallback(callbackID string) error {
+	return m.AnswerCallbackFunc(callbackID)
+}
+
 func (m *MessengerMock) Updates(lastMsgID int64) ([]MessengerUpdate, error) {
 	return m.UpdatesFunc(lastMsgID)
 }
 
+func (m *MessengerMock) IsChatAdmin(chatID, userID int64) (bool, error) {
+	return m.IsChatAdminFunc(chatID, userID)
+}
+
+type MailerMock struct {
+	SendMailFunc func(to string, mail Mail) error
+}
+
+func (m *MailerMock) SendMail(to string, mail Mail) error {
+	return m.SendMailFunc(to, mail)
+}
+
 type StorageMock struct {
-	SaveUserFunc         func(ctx context.Context, user User) error
-	UserFunc             func(ctx context.Context, etsyUserID int64) (User, error)
-	TokenDetailsFunc     func(ctx context.Context, id int64) (TokenDetails, error)
-	SaveTokenDetailsFunc func(ctx context.Context, td TokenDetails) error
+	SaveUserFunc                func(ctx context.Context, user User) error
+	UserFunc                    func(ctx context.Context, etsyUserID int64) (User, error)
+	DeleteUserFunc              func(ctx context.Context, etsyUserID int64) error
+	TokenDetailsFunc            func(ctx context.Context, id int64) (TokenDetails, error)
+	SaveTokenDetailsFunc        func(ctx context.Context, td TokenDetails) error
+	DeleteTokenDetailsFunc      func(ctx context.Context, id int64) error
+	SubscriptionsFunc           func(ctx context.Context, etsyUserID int64) ([]Subscription, error)
+	ChatSubscriptionsFunc       func(ctx context.Context, chatID int64) ([]Subscription, error)
+	AllSubscriptionsFunc        func(ctx context.Context) ([]Subscription, error)
+	SaveSubscriptionFunc        func(ctx context.Context, sub Subscription) error
+	DeleteSubscriptionFunc      func(ctx context.Context, sub Subscription) error
+	FeedCursorFunc              func(ctx context.Context) (int64, error)
+	SaveFeedCursorFunc          func(ctx context.Context, tsz int64) error
+	SyncTokenFunc               func(ctx context.Context, messenger string) (string, error)
+	SaveSyncTokenFunc           func(ctx context.Context, messenger, token string) error
+	ListingStateFunc            func(ctx context.Context, listingID int64) (ListingState, error)
+	ListingStatesFunc           func(ctx context.Context, etsyUserID int64) ([]ListingState, error)
+	SaveListingStateFunc        func(ctx context.Context, state ListingState) error
+	WatchesFunc                 func(ctx context.Context, etsyUserID int64) ([]Watch, error)
+	SaveWatchFunc               func(ctx context.Context, watch Watch) error
+	DeleteWatchFunc             func(ctx context.Context, watch Watch) error
+	MutesFunc                   func(ctx context.Context, etsyUserID int64) ([]Mute, error)
+	SaveMuteFunc                func(ctx context.Context, mute Mute) error
+	DeleteMuteFunc              func(ctx context.Context, mute Mute) error
+	EmailVerificationFunc       func(ctx context.Context, etsyUserID int64) (EmailVerification, error)
+	SaveEmailVerificationFunc   func(ctx context.Context, v EmailVerification) error
+	DeleteEmailVerificationFunc func(ctx context.Context, etsyUserID int64) error
+	WebhooksFunc                func(ctx context.Context, etsyUserID int64) ([]Webhook, error)
+	AddWebhookFunc              func(ctx context.Context, hook Webhook) (uint64, error)
+	DeleteWebhookFunc           func(ctx context.Context, etsyUserID int64, id uint64) error
+	EnqueueWebhookDeliveryFunc  func(ctx context.Context, d WebhookDelivery) error
+	WebhookDeliveriesFunc       func(ctx context.Context) ([]WebhookDelivery, error)
+	SaveWebhookDeliveryFunc     func(ctx context.Context, d WebhookDelivery) error
+	DeleteWebhookDeliveryFunc   func(ctx context.Context, id uint64) error
+	LogWebhookAttemptFunc       func(ctx context.Context, attempt WebhookAttempt) error
+	WebhookAttemptsFunc         func(ctx context.Context, etsyUserID int64, webhookID uint64) ([]WebhookAttempt, error)
+	SeenUpdateFunc              func(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	ForgetUpdateFunc            func(ctx context.Context, key string) error
+	CountUpdateFunc             func(ctx context.Context, etsyUserID int64, at time.Time) error
+	UpdateCountFunc             func(ctx context.Context, etsyUserID int64, since time.Time) (int64, error)
+	SaveEventFunc               func(ctx context.Context, event Event) error
+	EventsFunc                  func(ctx context.Context, etsyUserID int64, since time.Time) ([]Event, error)
+	DeferAlertFunc              func(ctx context.Context, chatID int64, msg Message) error
+	DeferredAlertsFunc          func(ctx context.Context, chatID int64) ([]DeferredAlert, error)
+	DeleteDeferredAlertsFunc    func(ctx context.Context, chatID int64, ids []uint64) error
+	EnqueueMessageFunc          func(ctx context.Context, msg OutboxMessage) error
+	OutboxMessagesFunc          func(ctx context.Context) ([]OutboxMessage, error)
+	SaveOutboxMessageFunc       func(ctx context.Context, msg OutboxMessage) error
+	DeleteOutboxMessageFunc     func(ctx context.Context, id uint64) error
+	DeadLetterFunc              func(ctx context.Context, msg OutboxMessage) error
+	PurgeExpiredFunc            func(ctx context.Context, now time.Time) error
 }
 
 func (s *StorageMock) SaveUser(ctx context.Context, user User) error {
@@ -433,6 +1180,30 @@ func (s *StorageMock) User(ctx context.Context, etsyUserID int64) (User, error)
 	return s.UserFunc(ctx, etsyUserID)
 }
 
+func (s *StorageMock) Subscriptions(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+	return s.SubscriptionsFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) ChatSubscriptions(ctx context.Context, chatID int64) ([]Subscription, error) {
+	return s.ChatSubscriptionsFunc(ctx, chatID)
+}
+
+func (s *StorageMock) AllSubscriptions(ctx context.Context) ([]Subscription, error) {
+	return s.AllSubscriptionsFunc(ctx)
+}
+
+func (s *StorageMock) SaveSubscription(ctx context.Context, sub Subscription) error {
+	return s.SaveSubscriptionFunc(ctx, sub)
+}
+
+func (s *StorageMock) DeleteSubscription(ctx context.Context, sub Subscription) error {
+	return s.DeleteSubscriptionFunc(ctx, sub)
+}
+
+func (s *StorageMock) DeleteUser(ctx context.Context, etsyUserID int64) error {
+	return s.DeleteUserFunc(ctx, etsyUserID)
+}
+
 func (s *StorageMock) TokenDetails(ctx context.Context, id int64) (TokenDetails, error) {
 	return s.TokenDetailsFunc(ctx, id)
 }
@@ -440,3 +1211,167 @@ func (s *StorageMock) TokenDetails(ctx context.Context, id int64) (TokenDetails,
 func (s *StorageMock) SaveTokenDetails(ctx context.Context, td TokenDetails) error {
 	return s.SaveTokenDetailsFunc(ctx, td)
 }
+
+func (s *StorageMock) DeleteTokenDetails(ctx context.Context, id int64) error {
+	return s.DeleteTokenDetailsFunc(ctx, id)
+}
+
+func (s *StorageMock) FeedCursor(ctx context.Context) (int64, error) {
+	return s.FeedCursorFunc(ctx)
+}
+
+func (s *StorageMock) SaveFeedCursor(ctx context.Context, tsz int64) error {
+	return s.SaveFeedCursorFunc(ctx, tsz)
+}
+
+func (s *StorageMock) SyncToken(ctx context.Context, messenger string) (string, error) {
+	return s.SyncTokenFunc(ctx, messenger)
+}
+
+func (s *StorageMock) SaveSyncToken(ctx context.Context, messenger, token string) error {
+	return s.SaveSyncTokenFunc(ctx, messenger, token)
+}
+
+func (s *StorageMock) ListingState(ctx context.Context, listingID int64) (ListingState, error) {
+	return s.ListingStateFunc(ctx, listingID)
+}
+
+func (s *StorageMock) ListingStates(ctx context.Context, etsyUserID int64) ([]ListingState, error) {
+	return s.ListingStatesFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) SaveListingState(ctx context.Context, state ListingState) error {
+	return s.SaveListingStateFunc(ctx, state)
+}
+
+func (s *StorageMock) Watches(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+	return s.WatchesFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) SaveWatch(ctx context.Context, watch Watch) error {
+	return s.SaveWatchFunc(ctx, watch)
+}
+
+func (s *StorageMock) DeleteWatch(ctx context.Context, watch Watch) error {
+	return s.DeleteWatchFunc(ctx, watch)
+}
+
+func (s *StorageMock) Mutes(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+	return s.MutesFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) SaveMute(ctx context.Context, mute Mute) error {
+	return s.SaveMuteFunc(ctx, mute)
+}
+
+func (s *StorageMock) DeleteMute(ctx context.Context, mute Mute) error {
+	return s.DeleteMuteFunc(ctx, mute)
+}
+
+func (s *StorageMock) EmailVerification(ctx context.Context, etsyUserID int64) (EmailVerification, error) {
+	return s.EmailVerificationFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) SaveEmailVerification(ctx context.Context, v EmailVerification) error {
+	return s.SaveEmailVerificationFunc(ctx, v)
+}
+
+func (s *StorageMock) DeleteEmailVerification(ctx context.Context, etsyUserID int64) error {
+	return s.DeleteEmailVerificationFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) Webhooks(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+	return s.WebhooksFunc(ctx, etsyUserID)
+}
+
+func (s *StorageMock) AddWebhook(ctx context.Context, hook Webhook) (uint64, error) {
+	return s.AddWebhookFunc(ctx, hook)
+}
+
+func (s *StorageMock) DeleteWebhook(ctx context.Context, etsyUserID int64, id uint64) error {
+	return s.DeleteWebhookFunc(ctx, etsyUserID, id)
+}
+
+func (s *StorageMock) EnqueueWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	return s.EnqueueWebhookDeliveryFunc(ctx, d)
+}
+
+func (s *StorageMock) WebhookDeliveries(ctx context.Context) ([]WebhookDelivery, error) {
+	return s.WebhookDeliveriesFunc(ctx)
+}
+
+func (s *StorageMock) SaveWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	return s.SaveWebhookDeliveryFunc(ctx, d)
+}
+
+func (s *StorageMock) DeleteWebhookDelivery(ctx context.Context, id uint64) error {
+	return s.DeleteWebhookDeliveryFunc(ctx, id)
+}
+
+func (s *StorageMock) LogWebhookAttempt(ctx context.Context, attempt WebhookAttempt) error {
+	return s.LogWebhookAttemptFunc(ctx, attempt)
+}
+
+func (s *StorageMock) WebhookAttempts(ctx context.Context, etsyUserID int64, webhookID uint64) ([]WebhookAttempt, error) {
+	return s.WebhookAttemptsFunc(ctx, etsyUserID, webhookID)
+}
+
+func (s *StorageMock) SeenUpdate(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.SeenUpdateFunc(ctx, key, ttl)
+}
+
+func (s *StorageMock) ForgetUpdate(ctx context.Context, key string) error {
+	return s.ForgetUpdateFunc(ctx, key)
+}
+
+func (s *StorageMock) CountUpdate(ctx context.Context, etsyUserID int64, at time.Time) error {
+	return s.CountUpdateFunc(ctx, etsyUserID, at)
+}
+
+func (s *StorageMock) UpdateCount(ctx context.Context, etsyUserID int64, since time.Time) (int64, error) {
+	return s.UpdateCountFunc(ctx, etsyUserID, since)
+}
+
+func (s *StorageMock) SaveEvent(ctx context.Context, event Event) error {
+	return s.SaveEventFunc(ctx, event)
+}
+
+func (s *StorageMock) Events(ctx context.Context, etsyUserID int64, since time.Time) ([]Event, error) {
+	return s.EventsFunc(ctx, etsyUserID, since)
+}
+
+func (s *StorageMock) DeferAlert(ctx context.Context, chatID int64, msg Message) error {
+	return s.DeferAlertFunc(ctx, chatID, msg)
+}
+
+func (s *StorageMock) DeferredAlerts(ctx context.Context, chatID int64) ([]DeferredAlert, error) {
+	return s.DeferredAlertsFunc(ctx, chatID)
+}
+
+func (s *StorageMock) DeleteDeferredAlerts(ctx context.Context, chatID int64, ids []uint64) error {
+	return s.DeleteDeferredAlertsFunc(ctx, chatID, ids)
+}
+
+func (s *StorageMock) EnqueueMessage(ctx context.Context, msg OutboxMessage) error {
+	return s.EnqueueMessageFunc(ctx, msg)
+}
+
+func (s *StorageMock) OutboxMessages(ctx context.Context) ([]OutboxMessage, error) {
+	return s.OutboxMessagesFunc(ctx)
+}
+
+func (s *StorageMock) SaveOutboxMessage(ctx context.Context, msg OutboxMessage) error {
+	return s.SaveOutboxMessageFunc(ctx, msg)
+}
+
+func (s *StorageMock) DeleteOutboxMessage(ctx context.Context, id uint64) error {
+	return s.DeleteOutboxMessageFunc(ctx, id)
+}
+
+func (s *StorageMock) DeadLetter(ctx context.Context, msg OutboxMessage) error {
+	return s.DeadLetterFunc(ctx, msg)
+}
+
+func (s *StorageMock) PurgeExpired(ctx context.Context, now time.Time) error {
+	return s.PurgeExpiredFunc(ctx, now)
+}
@@ -0,0 +1,200 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Watch overrides the user low stock threshold for a single listing or SKU.
+// Exactly one of ListingID and SKU is set.
+type Watch struct {
+	EtsyUserID int64
+	ListingID  int64
+	SKU        string
+	Threshold  int64
+}
+
+// skuPrefix marks an argument as SKU, so SKUs made of digits are not taken for listing IDs.
+const skuPrefix = "sku:"
+
+// watchTarget treats numeric arguments as listing IDs and everything else as SKUs.
+// Arguments starting with skuPrefix are SKUs, e.g. "sku:1001".
+func watchTarget(etsyUserID int64, arg string) Watch {
+	if sku := strings.TrimPrefix(arg, skuPrefix); sku != arg && sku != "" {
+		return Watch{EtsyUserID: etsyUserID, SKU: sku}
+	}
+
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil && id > 0 {
+		return Watch{EtsyUserID: etsyUserID, ListingID: id}
+	}
+
+	return Watch{EtsyUserID: etsyUserID, SKU: arg}
+}
+
+// threshold resolves the low stock threshold for the update.
+func (ls *LowStock) threshold(ctx context.Context, user User, update Update) (int64, error) {
+	watches, err := ls.storage.Watches(ctx, user.EtsyUserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get watches: %w", err)
+	}
+
+	var listingSKUs []string
+	if hasSKUWatches(watches) {
+		listingSKUs, err = ls.etsy.ListingSKUs(ctx, update.ListingID, user.Token, user.TokenSecret)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get Listing SKUs: %w", err)
+		}
+	}
+
+	return listingThreshold(user, watches, update.ListingID, listingSKUs), nil
+}
+
+func hasSKUWatches(watches []Watch) bool {
+	for _, w := range watches {
+		if w.SKU != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listingThreshold resolves the low stock threshold of a listing with the SKUs.
+// Listing watch goes first, then SKU watches, then the user default.
+func listingThreshold(user User, watches []Watch, listingID int64, listingSKUs []string) int64 {
+	skuWatches := map[string]int64{}
+	for _, w := range watches {
+		if w.SKU == "" && w.ListingID == listingID {
+			return w.Threshold
+		}
+
+		if w.SKU != "" {
+			skuWatches[w.SKU] = w.Threshold
+		}
+	}
+
+	// The highest threshold wins when several SKUs of a listing are watched.
+	threshold, found := int64(0), false
+	for _, sku := range listingSKUs {
+		if t, ok := skuWatches[sku]; ok && (!found || t > threshold) {
+			threshold, found = t, true
+		}
+	}
+
+	if !found {
+		return user.Threshold
+	}
+
+	return threshold
+}
+
+func (ls *LowStock) sendWatchUsage(msgs *bundle, chatID int64) error {
+	if err := ls.messenger.SendTextMessage(msgs.watchUsage, chatID); err != nil {
+		return fmt.Errorf("failed to send watch usage: %w", err)
+	}
+
+	return ErrBadArguments
+}
+
+func (ls *LowStock) DoWatch(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	args := commandArgs(msgUpdate)
+	if len(args) != 2 {
+		return ls.sendWatchUsage(msgs, msgUpdate.ChatID)
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	threshold, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || threshold < 0 {
+		return ls.sendWatchUsage(msgs, msgUpdate.ChatID)
+	}
+
+	watch := watchTarget(user.EtsyUserID, args[0])
+	watch.Threshold = threshold
+
+	if err := ls.storage.SaveWatch(ctx, watch); err != nil {
+		return fmt.Errorf("failed to save watch: %w", err)
+	}
+
+	msg := fmt.Sprintf(msgs.watch, html.EscapeString(msgs.watchName(watch)), watch.Threshold)
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) DoUnwatch(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+	args := commandArgs(msgUpdate)
+	if len(args) != 1 {
+		return ls.sendWatchUsage(msgs, msgUpdate.ChatID)
+	}
+
+	if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+		return err
+	}
+
+	watch := watchTarget(user.EtsyUserID, args[0])
+
+	msg := fmt.Sprintf(msgs.unwatch, html.EscapeString(msgs.watchName(watch)))
+	if err := ls.storage.DeleteWatch(ctx, watch); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to delete watch: %w", err)
+		}
+		msg = fmt.Sprintf(msgs.watchNotFound, html.EscapeString(msgs.watchName(watch)))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) DoWatches(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, err := ls.chatUser(ctx, msgUpdate)
+	if err != nil {
+		return err
+	}
+
+	watches, err := ls.storage.Watches(ctx, user.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get watches: %w", err)
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	list := msgs.noWatches
+	if len(watches) > 0 {
+		lines := make([]string, 0, len(watches))
+		for _, w := range watches {
+			lines = append(lines, fmt.Sprintf("%s: <b>%d</b>", html.EscapeString(msgs.watchName(w)), w.Threshold))
+		}
+		list = strings.Join(lines, "\n")
+	}
+
+	msg := fmt.Sprintf(msgs.watches, user.Threshold, list)
+	if err := ls.messenger.SendTextMessage(msg, msgUpdate.ChatID); err != nil {
+		return fmt.Errorf("failed to send watches: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package lowstock
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestThresholdResolution(t *testing.T) {
+	user := User{EtsyUserID: 12, Threshold: 3}
+
+	tests := []struct {
+		name     string
+		watches  []Watch
+		expected int64
+	}{
+		{
+			name:     "default",
+			expected: 3,
+		},
+		{
+			name:     "listing",
+			watches:  []Watch{Watch{ListingID: 7, Threshold: 1}, Watch{ListingID: 42, Threshold: 10}},
+			expected: 10,
+		},
+		{
+			name:     "listing before SKU",
+			watches:  []Watch{Watch{SKU: "MUG-RED", Threshold: 5}, Watch{ListingID: 42, Threshold: 0}},
+			expected: 0,
+		},
+		{
+			name:     "highest SKU",
+			watches:  []Watch{Watch{SKU: "MUG-RED", Threshold: 5}, Watch{SKU: "MUG-BLUE", Threshold: 8}},
+			expected: 8,
+		},
+		{
+			name:     "other SKU",
+			watches:  []Watch{Watch{SKU: "CUP", Threshold: 5}},
+			expected: 3,
+		},
+	}
+
+	etsy := &EtsyMock{
+		ListingSKUsFunc: func(ctx context.Context, id int64, accessToken, accessSecret string) ([]string, error) {
+			return []string{"MUG-RED", "MUG-BLUE"}, nil
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &StorageMock{
+				WatchesFunc: func(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+					return tt.watches, nil
+				},
+			}
+
+			ls := New(etsy, &MessengerMock{}, storage)
+
+			threshold, err := ls.threshold(context.Background(), user, Update{ListingID: 42})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if threshold != tt.expected {
+				t.Errorf("Got threshold: %d, expected: %d", threshold, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDoWatch(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Watch
+	}{
+		{text: "/watch 42 10", expected: Watch{EtsyUserID: 12, ListingID: 42, Threshold: 10}},
+		{text: "/watch MUG-RED 0", expected: Watch{EtsyUserID: 12, SKU: "MUG-RED", Threshold: 0}},
+		{text: "/watch sku:1001 5", expected: Watch{EtsyUserID: 12, SKU: "1001", Threshold: 5}},
+		{text: "/watch sku: 5", expected: Watch{EtsyUserID: 12, SKU: "sku:", Threshold: 5}},
+	}
+
+	for _, tt := range tests {
+		saved := false
+		storage := &StorageMock{
+			ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+				return []Subscription{Subscription{EtsyUserID: 12, ChatID: chatID}}, nil
+			},
+			UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+				return User{EtsyUserID: etsyUserID}, nil
+			},
+			SaveWatchFunc: func(ctx context.Context, watch Watch) error {
+				if watch != tt.expected {
+					t.Errorf("Got watch: %+v, expected: %+v", watch, tt.expected)
+				}
+
+				saved = true
+				return nil
+			},
+		}
+
+		messenger := &MessengerMock{
+			SendTextMessageFunc: func(msg string, chatID int64) error {
+				return nil
+			},
+		}
+
+		ls := New(&EtsyMock{}, messenger, storage)
+
+		update := MessengerUpdate{Command: "/watch", Text: tt.text, ChatID: 100}
+		if err := ls.DoWatch(context.Background(), update); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !saved {
+			t.Errorf("Watch was not saved for %q", tt.text)
+		}
+	}
+}
+
+func TestDoWatchBadArguments(t *testing.T) {
+	inputs := []string{"/watch", "/watch 42", "/watch 42 ten", "/watch 42 -1"}
+
+	storage := &StorageMock{
+		ChatSubscriptionsFunc: func(ctx context.Context, chatID int64) ([]Subscription, error) {
+			return []Subscription{Subscription{EtsyUserID: 12, ChatID: chatID}}, nil
+		},
+		UserFunc: func(ctx context.Context, etsyUserID int64) (User, error) {
+			return User{EtsyUserID: etsyUserID}, nil
+		},
+	}
+
+	messenger := &MessengerMock{
+		SendTextMessageFunc: func(msg string, chatID int64) error {
+			if msg != watchUsageMsg {
+				t.Error("Unexpected message")
+			}
+
+			return nil
+		},
+	}
+
+	ls := New(&EtsyMock{}, messenger, storage)
+
+	for _, text := range inputs {
+		update := MessengerUpdate{Command: "/watch", Text: text, ChatID: 100}
+
+		if err := ls.DoWatch(context.Background(), update); !errors.Is(err, ErrBadArguments) {
+			t.Errorf("Got error: %v for %q, expected: %s", err, text, ErrBadArguments)
+		}
+	}
+}
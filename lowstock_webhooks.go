@@ -0,0 +1,725 @@
+package lowstock
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// webhookVersion is bumped when fields of WebhookPayload change meaning or go away.
+	webhookVersion   = 1
+	webhookTestEvent = "test"
+
+	maxWebhooks      = 5
+	maxWebhookURL    = 2048
+	maxWebhookErrLen = 200
+
+	// Attempts kept in the delivery log of an endpoint.
+	maxWebhookAttempts = 20
+
+	signatureHeader = "X-Lowstock-Signature"
+	timestampHeader = "X-Lowstock-Timestamp"
+	eventHeader     = "X-Lowstock-Event"
+	deliveryHeader  = "X-Lowstock-Delivery"
+)
+
+var (
+	webhookSentCounter  = metrics.NewCounter(`webhook_deliveries_total{status="sent"}`)
+	webhookRetryCounter = metrics.NewCounter(`webhook_deliveries_total{status="retry"}`)
+	webhookDeadCounter  = metrics.NewCounter(`webhook_deliveries_total{status="failed"}`)
+)
+
+// Webhook is an endpoint that gets listing events of a shop.
+type Webhook struct {
+	// ID is assigned by storage.
+	ID         uint64
+	EtsyUserID int64
+	URL        string
+	// Secret signs payloads, it is shown once when the webhook is added.
+	Secret  string
+	Created time.Time
+}
+
+// WebhookDelivery is a payload waiting to be posted to a webhook.
+type WebhookDelivery struct {
+	// ID is assigned by storage, deliveries to a webhook go in ID order.
+	ID         uint64
+	EtsyUserID int64
+	WebhookID  uint64
+	Event      string
+	Payload    json.RawMessage
+
+	Attempts    int
+	NextAttempt time.Time
+	Created     time.Time
+}
+
+// WebhookAttempt is an entry of the delivery log of a webhook.
+type WebhookAttempt struct {
+	EtsyUserID int64
+	WebhookID  uint64
+	DeliveryID uint64
+	Event      string
+	Attempt    int
+	// Status is the HTTP status code, zero when there was no response.
+	Status int
+	Error  string
+	Time   time.Time
+}
+
+// WebhookPayload is the JSON body of webhook calls.
+// Fields are only added within a version.
+type WebhookPayload struct {
+	Version int `json:"version"`
+	// ID is the same for every attempt of a delivery, receivers may use it to drop duplicates.
+	ID      string         `json:"id"`
+	Event   string         `json:"event"`
+	Test    bool           `json:"test,omitempty"`
+	Listing WebhookListing `json:"listing"`
+	Shop    WebhookShop    `json:"shop"`
+	// OccurredAt is the time of the listing change.
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type WebhookListing struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	State     string    `json:"state"`
+	Quantity  int64     `json:"quantity"`
+	SKUs      []string  `json:"skus"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookShop struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+func newWebhookPayload(kind string, update Update, skus []string) WebhookPayload {
+	if skus == nil {
+		skus = []string{}
+	}
+
+	updated := time.Unix(update.LastModifiedTSZ, 0).UTC()
+
+	return WebhookPayload{
+		Version: webhookVersion,
+		ID:      update.dedupeKey() + "/" + kind,
+		Event:   kind,
+		Listing: WebhookListing{
+			ID:        update.ListingID,
+			Title:     update.Title,
+			State:     update.State,
+			Quantity:  update.Quantity,
+			SKUs:      skus,
+			URL:       fmt.Sprintf(listingURLFormat, update.ListingID),
+			CreatedAt: time.Unix(update.CreationTSZ, 0).UTC(),
+			UpdatedAt: updated,
+		},
+		Shop:       WebhookShop{UserID: update.UserID, Name: update.ShopName},
+		OccurredAt: updated,
+	}
+}
+
+func testWebhookPayload(user User, now time.Time) WebhookPayload {
+	return WebhookPayload{
+		Version:    webhookVersion,
+		ID:         fmt.Sprintf("%s/%d", webhookTestEvent, now.UnixNano()),
+		Event:      webhookTestEvent,
+		Test:       true,
+		Listing:    WebhookListing{SKUs: []string{}},
+		Shop:       WebhookShop{UserID: user.EtsyUserID, Name: user.ShopName},
+		OccurredAt: now.UTC(),
+	}
+}
+
+// signWebhook signs the timestamp and the body, the timestamp lets receivers refuse replays.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Webhooks of shop owners must not reach the bot host or its network.
+var privateNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+
+	return nets
+}()
+
+func publicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dialPublic refuses connections to private addresses, it runs after DNS resolution.
+func dialPublic(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !publicIP(net.ParseIP(host)) {
+		return fmt.Errorf("address %s is not public", host)
+	}
+
+	return nil
+}
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublic}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 2,
+	},
+	// Redirects are not followed, the endpoint has to answer itself.
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// postWebhook returns the response status code, non 2xx codes are errors.
+func postWebhook(ctx context.Context, hook Webhook, d WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("Lowstock-Webhook/%d", webhookVersion))
+	req.Header.Set(eventHeader, d.Event)
+	req.Header.Set(deliveryHeader, strconv.FormatUint(d.ID, 10))
+	req.Header.Set(timestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(signatureHeader, signWebhook(hook.Secret, now.Unix(), d.Payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// queueWebhooks queues the event for every webhook of the user.
+// Webhooks get every event, notification settings and mutes are for chats.
+func (ls *LowStock) queueWebhooks(ctx context.Context, hooks []Webhook, update Update, kind string, skus []string) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(newWebhookPayload(kind, update, skus))
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	// One failed webhook does not hold back the others, the last error is returned.
+	var lastErr error
+	for _, hook := range hooks {
+		if err := ls.enqueueWebhook(ctx, hook, kind, payload); err != nil {
+			lastErr = fmt.Errorf("webhook %d: %w", hook.ID, err)
+		}
+	}
+
+	return lastErr
+}
+
+func (ls *LowStock) enqueueWebhook(ctx context.Context, hook Webhook, event string, payload []byte) error {
+	if err := ls.storage.EnqueueWebhookDelivery(ctx, WebhookDelivery{
+		EtsyUserID: hook.EtsyUserID,
+		WebhookID:  hook.ID,
+		Event:      event,
+		Payload:    payload,
+		Created:    time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to enqueue webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// sendWebhooks posts queued deliveries that are due, every webhook in its own goroutine,
+// so a slow endpoint does not hold back the others. A webhook still busy from an earlier pass is skipped.
+// Use waitWebhooks to wait for the started deliveries.
+func (ls *LowStock) sendWebhooks(ctx context.Context, now time.Time) {
+	queue, err := ls.storage.WebhookDeliveries(ctx)
+	if err != nil {
+		log.Printf("Failed to get webhook deliveries: %s", err)
+		return
+	}
+
+	hooks := map[int64]map[uint64]Webhook{}
+	blocked := map[uint64]bool{}
+	lanes := map[uint64][]WebhookDelivery{}
+	var due []Webhook
+
+	for _, d := range queue {
+		if blocked[d.WebhookID] {
+			continue
+		}
+
+		if d.NextAttempt.After(now) {
+			blocked[d.WebhookID] = true
+			continue
+		}
+
+		userHooks, ok := hooks[d.EtsyUserID]
+		if !ok {
+			list, err := ls.storage.Webhooks(ctx, d.EtsyUserID)
+			if err != nil {
+				log.Printf("Failed to get webhooks of user %d: %s", d.EtsyUserID, err)
+				continue
+			}
+
+			userHooks = map[uint64]Webhook{}
+			for _, hook := range list {
+				userHooks[hook.ID] = hook
+			}
+			hooks[d.EtsyUserID] = userHooks
+		}
+
+		hook, ok := userHooks[d.WebhookID]
+		if !ok {
+			// The webhook was removed.
+			if err := ls.storage.DeleteWebhookDelivery(ctx, d.ID); err != nil {
+				log.Printf("Failed to delete webhook delivery %d: %s", d.ID, err)
+			}
+			continue
+		}
+
+		if _, ok := lanes[hook.ID]; !ok {
+			due = append(due, hook)
+		}
+		lanes[hook.ID] = append(lanes[hook.ID], d)
+	}
+
+	for _, hook := range due {
+		ls.webhookMu.Lock()
+		busy := ls.webhookBusy[hook.ID]
+		if !busy {
+			ls.webhookBusy[hook.ID] = true
+		}
+		ls.webhookMu.Unlock()
+
+		if busy {
+			continue
+		}
+
+		ls.webhookWG.Add(1)
+		go func(hook Webhook, lane []WebhookDelivery) {
+			defer ls.webhookWG.Done()
+
+			ls.sendWebhookLane(ctx, hook, lane, now)
+
+			ls.webhookMu.Lock()
+			delete(ls.webhookBusy, hook.ID)
+			ls.webhookMu.Unlock()
+		}(hook, lanes[hook.ID])
+	}
+}
+
+// waitWebhooks waits for the deliveries started by sendWebhooks.
+func (ls *LowStock) waitWebhooks() {
+	ls.webhookWG.Wait()
+}
+
+// sendWebhookLane posts the deliveries of a single webhook in order and stops at the first failure,
+// so its events stay in order.
+func (ls *LowStock) sendWebhookLane(ctx context.Context, hook Webhook, lane []WebhookDelivery, now time.Time) {
+	for _, d := range lane {
+		if !ls.sendWebhook(ctx, hook, d, now) {
+			return
+		}
+	}
+}
+
+// sendWebhook posts a delivery and reports whether it went through.
+// A failed delivery is scheduled for a retry or dropped after maxSendAttempts.
+func (ls *LowStock) sendWebhook(ctx context.Context, hook Webhook, d WebhookDelivery, now time.Time) bool {
+	d.Attempts++
+	status, err := postWebhook(ctx, hook, d, now)
+
+	attempt := WebhookAttempt{
+		EtsyUserID: d.EtsyUserID,
+		WebhookID:  d.WebhookID,
+		DeliveryID: d.ID,
+		Event:      d.Event,
+		Attempt:    d.Attempts,
+		Status:     status,
+		Time:       now,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	if err := ls.storage.LogWebhookAttempt(ctx, attempt); err != nil {
+		log.Printf("Failed to log webhook delivery %d: %s", d.ID, err)
+	}
+
+	if err == nil {
+		webhookSentCounter.Inc()
+		if err := ls.storage.DeleteWebhookDelivery(ctx, d.ID); err != nil {
+			log.Printf("Failed to delete sent webhook delivery %d: %s", d.ID, err)
+		}
+		return true
+	}
+
+	if d.Attempts >= maxSendAttempts {
+		webhookDeadCounter.Inc()
+		log.Printf("Giving up on webhook delivery %d to webhook %d after %d attempts: %s", d.ID, d.WebhookID, d.Attempts, err)
+		if err := ls.storage.DeleteWebhookDelivery(ctx, d.ID); err != nil {
+			log.Printf("Failed to delete webhook delivery %d: %s", d.ID, err)
+		}
+		return false
+	}
+
+	delay := retryDelay(d.Attempts)
+
+	webhookRetryCounter.Inc()
+	log.Printf("Failed to deliver %d to webhook %d, retrying in %s: %s", d.ID, d.WebhookID, delay, err)
+
+	d.NextAttempt = now.Add(delay)
+	if err := ls.storage.SaveWebhookDelivery(ctx, d); err != nil {
+		log.Printf("Failed to save webhook delivery %d: %s", d.ID, err)
+	}
+
+	return false
+}
+
+type WebhookSender struct {
+	ls     *LowStock
+	ticker *time.Ticker
+}
+
+func NewWebhookSender(l *LowStock) *WebhookSender {
+	return &WebhookSender{
+		ls:     l,
+		ticker: time.NewTicker(outboxPeriod),
+	}
+}
+
+func (s *WebhookSender) Run(ctx context.Context) {
+	log.Println("Starting webhook sender...")
+	defer s.ticker.Stop()
+
+	for {
+		select {
+		case now := <-s.ticker.C:
+			s.ls.sendWebhooks(ctx, now)
+		case <-ctx.Done():
+			log.Println("Stopping webhook sender...")
+			s.ls.waitWebhooks()
+			return
+		}
+	}
+}
+
+// DoWebhook lists, adds, removes and tests webhooks of the shop.
+func (ls *LowStock) DoWebhook(ctx context.Context, msgUpdate MessengerUpdate) error {
+	user, sub, args, err := ls.shopUser(ctx, msgUpdate, commandArgs(msgUpdate))
+	if err != nil {
+		return err
+	}
+
+	msgs := messages(sub.Locale, msgUpdate.LanguageCode)
+
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	if len(args) == 0 {
+		return ls.sendWebhookList(ctx, msgs, user, loc, msgUpdate.ChatID)
+	}
+
+	if len(args) != 2 && (len(args) != 1 || args[0] != "list") {
+		return ls.sendWebhookUsage(msgs, msgUpdate.ChatID)
+	}
+
+	if args[0] == "add" {
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		if isGroup(msgUpdate) {
+			if err := ls.messenger.SendTextMessage(msgs.webhookPrivate, msgUpdate.ChatID); err != nil {
+				return fmt.Errorf("failed to send notification: %w", err)
+			}
+
+			return ErrForbidden
+		}
+
+		return ls.addWebhook(ctx, msgs, user, args[1], msgUpdate.ChatID)
+	}
+
+	if args[0] == "list" && len(args) == 1 {
+		return ls.sendWebhookList(ctx, msgs, user, loc, msgUpdate.ChatID)
+	}
+
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return ls.sendWebhookUsage(msgs, msgUpdate.ChatID)
+	}
+
+	hooks, err := ls.storage.Webhooks(ctx, user.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	var hook *Webhook
+	for i := range hooks {
+		if hooks[i].ID == id {
+			hook = &hooks[i]
+		}
+	}
+
+	if hook == nil {
+		if err := ls.messenger.SendTextMessage(fmt.Sprintf(msgs.webhookNotFound, id), msgUpdate.ChatID); err != nil {
+			return fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		return nil
+	}
+
+	switch args[0] {
+	case "list":
+		return ls.sendWebhookLog(ctx, msgs, *hook, loc, msgUpdate.ChatID)
+	case "remove":
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		return ls.removeWebhook(ctx, msgs, *hook, msgUpdate.ChatID)
+	case "test":
+		if err := ls.authorize(ctx, msgUpdate, sub); err != nil {
+			return err
+		}
+
+		return ls.testWebhook(ctx, msgs, user, *hook, msgUpdate.ChatID)
+	default:
+		return ls.sendWebhookUsage(msgs, msgUpdate.ChatID)
+	}
+}
+
+func (ls *LowStock) sendWebhookUsage(msgs *bundle, chatID int64) error {
+	if err := ls.messenger.SendTextMessage(msgs.webhookUsage, chatID); err != nil {
+		return fmt.Errorf("failed to send webhook usage: %w", err)
+	}
+
+	return ErrBadArguments
+}
+
+// validWebhookURL accepts absolute HTTPS URLs without credentials.
+func validWebhookURL(rawURL string) bool {
+	if len(rawURL) > maxWebhookURL {
+		return false
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "https" && u.Hostname() != "" && u.User == nil
+}
+
+func attemptResult(a WebhookAttempt) string {
+	if a.Error == "" {
+		return fmt.Sprintf("HTTP %d", a.Status)
+	}
+
+	errText := a.Error
+	if len(errText) > maxWebhookErrLen {
+		errText = errText[:maxWebhookErrLen] + "…"
+	}
+
+	return html.EscapeString(errText)
+}
+
+func (ls *LowStock) sendWebhookList(ctx context.Context, msgs *bundle, user User, loc *time.Location, chatID int64) error {
+	hooks, err := ls.storage.Webhooks(ctx, user.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	lines := []string{}
+	for _, hook := range hooks {
+		attempts, err := ls.storage.WebhookAttempts(ctx, user.EtsyUserID, hook.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get webhook log: %w", err)
+		}
+
+		last := msgs.webhookNever
+		if len(attempts) > 0 {
+			a := attempts[0]
+			last = fmt.Sprintf("%s, %s", a.Time.In(loc).Format(statusTimeFormat), attemptResult(a))
+		}
+
+		lines = append(lines, fmt.Sprintf(msgs.webhookItem, hook.ID, html.EscapeString(hook.URL), last))
+	}
+
+	msg := msgs.noWebhooks
+	if len(lines) > 0 {
+		msg = fmt.Sprintf(msgs.webhooks, strings.Join(lines, "\n"))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send webhooks: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) sendWebhookLog(ctx context.Context, msgs *bundle, hook Webhook, loc *time.Location, chatID int64) error {
+	attempts, err := ls.storage.WebhookAttempts(ctx, hook.EtsyUserID, hook.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook log: %w", err)
+	}
+
+	name := html.EscapeString(hook.URL)
+
+	lines := []string{}
+	for _, a := range attempts {
+		lines = append(lines, fmt.Sprintf(msgs.webhookLogItem, a.Time.In(loc).Format(statusTimeFormat), a.Event, a.Attempt, attemptResult(a)))
+	}
+
+	msg := fmt.Sprintf(msgs.webhookLogEmpty, name)
+	if len(lines) > 0 {
+		msg = fmt.Sprintf(msgs.webhookLog, name, strings.Join(lines, "\n"))
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send webhook log: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) addWebhook(ctx context.Context, msgs *bundle, user User, rawURL string, chatID int64) error {
+	if !validWebhookURL(rawURL) {
+		return ls.sendWebhookUsage(msgs, chatID)
+	}
+
+	hooks, err := ls.storage.Webhooks(ctx, user.EtsyUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	if len(hooks) >= maxWebhooks {
+		if err := ls.messenger.SendTextMessage(fmt.Sprintf(msgs.webhookLimit, maxWebhooks), chatID); err != nil {
+			return fmt.Errorf("failed to send notification: %w", err)
+		}
+
+		return ErrBadArguments
+	}
+
+	secret, err := webhookSecret()
+	if err != nil {
+		return fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	id, err := ls.storage.AddWebhook(ctx, Webhook{
+		EtsyUserID: user.EtsyUserID,
+		URL:        rawURL,
+		Secret:     secret,
+		Created:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add webhook: %w", err)
+	}
+
+	msg := fmt.Sprintf(msgs.webhookAdded, html.EscapeString(rawURL), id, secret)
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) removeWebhook(ctx context.Context, msgs *bundle, hook Webhook, chatID int64) error {
+	msg := fmt.Sprintf(msgs.webhookRemoved, html.EscapeString(hook.URL))
+	if err := ls.storage.DeleteWebhook(ctx, hook.EtsyUserID, hook.ID); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+		msg = fmt.Sprintf(msgs.webhookNotFound, hook.ID)
+	}
+
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+func (ls *LowStock) testWebhook(ctx context.Context, msgs *bundle, user User, hook Webhook, chatID int64) error {
+	payload, err := json.Marshal(testWebhookPayload(user, time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	if err := ls.enqueueWebhook(ctx, hook, webhookTestEvent, payload); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf(msgs.webhookTest, html.EscapeString(hook.URL), hook.ID)
+	if err := ls.messenger.SendTextMessage(msg, chatID); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package lowstock
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 )
@@ -9,12 +10,24 @@ import (
 var (
 	pollPeriod   = 20 * time.Second
 	nUpdHandlers = 10
+
+	// Widest time range requested from the listings feed at once.
+	feedWindow = 10 * time.Minute
+	// Windows with more updates than the feed page cap are split down to this range.
+	minFeedWindow = time.Minute
+	// How far back the feed is replayed after downtime.
+	maxCatchUp = 24 * time.Hour
+
+	purgePeriod = time.Hour
 )
 
 type Worker struct {
 	ls      *LowStock
 	ticker  *time.Ticker
 	updChan chan Update
+
+	// Feed time offset, everything before it was handed to update handlers.
+	cursor int64
 }
 
 func NewWorker(l *LowStock) *Worker {
@@ -38,14 +51,74 @@ func (w *Worker) handleUpdates(ctx context.Context) {
 	}
 }
 
-func (w *Worker) etsyUpdates(ctx context.Context) {
-	updates, err := w.ls.Updates(ctx)
+func (w *Worker) loadCursor(ctx context.Context) {
+	now := time.Now()
+
+	cursor, err := w.ls.storage.FeedCursor(ctx)
 	if err != nil {
-		return
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Failed to read feed cursor, starting from now: %s", err)
+		}
+		cursor = now.Unix()
+	}
+
+	if oldest := now.Add(-maxCatchUp).Unix(); cursor < oldest {
+		log.Printf("Feed cursor is older than %s, skipping to %s", maxCatchUp, time.Unix(oldest, 0))
+		cursor = oldest
+	}
+
+	w.cursor = cursor
+}
+
+// etsyUpdates reads the feed from the cursor up to now.
+// After downtime the gap is replayed window by window,
+// the cursor is saved once a window is handed to update handlers.
+// A truncated window is split in half and read again, so updates past the page cap are not lost.
+func (w *Worker) etsyUpdates(ctx context.Context) {
+	now := time.Now().Unix()
+	window := int64(feedWindow / time.Second)
+	minWindow := int64(minFeedWindow / time.Second)
+
+	if now-w.cursor > window {
+		log.Printf("Catching up on Etsy feed since %s", time.Unix(w.cursor, 0))
 	}
 
-	for _, upd := range updates {
-		w.updChan <- upd
+	for w.cursor < now {
+		end := w.cursor + window
+		if end > now {
+			end = now
+		}
+
+		updates, err := w.ls.Updates(ctx, w.cursor, time.Duration(end-w.cursor)*time.Second)
+		if err != nil {
+			if !errors.Is(err, ErrFeedTruncated) {
+				return
+			}
+
+			if end-w.cursor > minWindow {
+				window = (end - w.cursor) / 2
+				if window < minWindow {
+					window = minWindow
+				}
+				continue
+			}
+
+			// Nothing to split anymore, the rest of the window is lost.
+			log.Printf("Feed window since %s is truncated even at %s", time.Unix(w.cursor, 0), minFeedWindow)
+		}
+
+		for _, upd := range updates {
+			select {
+			case w.updChan <- upd:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := w.ls.storage.SaveFeedCursor(ctx, end); err != nil {
+			log.Printf("Failed to save feed cursor: %s", err)
+		}
+		w.cursor = end
 	}
 }
 
@@ -55,12 +128,20 @@ func (w *Worker) Run(ctx context.Context) {
 		go w.handleUpdates(ctx)
 	}
 
+	w.loadCursor(ctx)
 	w.etsyUpdates(ctx)
 
+	purgeTicker := time.NewTicker(purgePeriod)
+	defer purgeTicker.Stop()
+
 	for {
 		select {
 		case <-w.ticker.C:
 			w.etsyUpdates(ctx)
+		case now := <-purgeTicker.C:
+			if err := w.ls.storage.PurgeExpired(ctx, now); err != nil {
+				log.Printf("Failed to purge expired records: %s", err)
+			}
 		case <-ctx.Done():
 			log.Println("Stopping worker...")
 			return
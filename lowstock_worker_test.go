@@ -0,0 +1,148 @@
+package lowstock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWorkerCatchesUpSinceSavedCursor(t *testing.T) {
+	var (
+		startedAt   = time.Now().Unix()
+		savedCursor = startedAt - int64(25*time.Minute/time.Second)
+		offsets     []int64
+		saved       []int64
+	)
+
+	storage := &StorageMock{
+		FeedCursorFunc: func(ctx context.Context) (int64, error) {
+			return savedCursor, nil
+		},
+		SaveFeedCursorFunc: func(ctx context.Context, tsz int64) error {
+			saved = append(saved, tsz)
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		UpdatesFunc: func(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error) {
+			if timeLimit > feedWindow {
+				t.Errorf("Got time limit: %s, expected at most: %s", timeLimit, feedWindow)
+			}
+
+			offsets = append(offsets, timeOffset)
+			return []Update{Update{ListingID: timeOffset}}, nil
+		},
+	}
+
+	w := NewWorker(New(etsy, nil, storage))
+	defer w.ticker.Stop()
+
+	ctx := context.Background()
+	w.loadCursor(ctx)
+	w.etsyUpdates(ctx)
+
+	if len(offsets) != 3 {
+		t.Fatalf("Got %d feed calls, expected: 3", len(offsets))
+	}
+
+	if offsets[0] != savedCursor {
+		t.Errorf("Got first offset: %d, expected: %d", offsets[0], savedCursor)
+	}
+
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] != saved[i-1] {
+			t.Errorf("Got offset: %d, expected previous saved cursor: %d", offsets[i], saved[i-1])
+		}
+	}
+
+	if last := saved[len(saved)-1]; last < startedAt {
+		t.Errorf("Got final cursor: %d, expected at least: %d", last, startedAt)
+	}
+
+	if len(w.updChan) != 3 {
+		t.Errorf("Got %d updates handed to workers, expected: 3", len(w.updChan))
+	}
+}
+
+func TestWorkerKeepsCursorOnFeedFailure(t *testing.T) {
+	var savedCursor = time.Now().Add(-time.Minute).Unix()
+
+	storage := &StorageMock{
+		FeedCursorFunc: func(ctx context.Context) (int64, error) {
+			return savedCursor, nil
+		},
+		SaveFeedCursorFunc: func(ctx context.Context, tsz int64) error {
+			t.Error("Cursor must not be saved when feed call fails")
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		UpdatesFunc: func(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error) {
+			return nil, ErrNotFound
+		},
+	}
+
+	w := NewWorker(New(etsy, nil, storage))
+	defer w.ticker.Stop()
+
+	ctx := context.Background()
+	w.loadCursor(ctx)
+	w.etsyUpdates(ctx)
+
+	if w.cursor != savedCursor {
+		t.Errorf("Got cursor: %d, expected: %d", w.cursor, savedCursor)
+	}
+}
+
+func TestWorkerSplitsTruncatedWindow(t *testing.T) {
+	var (
+		savedCursor = time.Now().Add(-feedWindow).Unix()
+		limits      []time.Duration
+		saved       []int64
+	)
+
+	storage := &StorageMock{
+		FeedCursorFunc: func(ctx context.Context) (int64, error) {
+			return savedCursor, nil
+		},
+		SaveFeedCursorFunc: func(ctx context.Context, tsz int64) error {
+			saved = append(saved, tsz)
+			return nil
+		},
+	}
+
+	etsy := &EtsyMock{
+		UpdatesFunc: func(ctx context.Context, timeOffset int64, timeLimit time.Duration) ([]Update, error) {
+			limits = append(limits, timeLimit)
+
+			updates := []Update{Update{ListingID: timeOffset}}
+			if timeLimit > 3*time.Minute {
+				return updates, ErrFeedTruncated
+			}
+
+			return updates, nil
+		},
+	}
+
+	w := NewWorker(New(etsy, nil, storage))
+	defer w.ticker.Stop()
+
+	ctx := context.Background()
+	w.loadCursor(ctx)
+	w.etsyUpdates(ctx)
+
+	if len(limits) < 3 || limits[0] != feedWindow || limits[1] != feedWindow/2 {
+		t.Fatalf("Got time limits: %v, expected the window to be halved", limits)
+	}
+
+	if saved[0] != savedCursor+int64(feedWindow/4/time.Second) {
+		t.Errorf("Got first saved cursor: %d, expected a quarter of the window", saved[0]-savedCursor)
+	}
+
+	// Truncated reads are not handed to update handlers.
+	if len(w.updChan) != len(saved) {
+		t.Errorf("Got %d updates handed to workers, expected: %d", len(w.updChan), len(saved))
+	}
+}
@@ -0,0 +1,496 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	apiPath = "/_matrix/client/v3"
+
+	msgTypeText   = "m.text"
+	msgTypeNotice = "m.notice"
+	formatHTML    = "org.matrix.custom.html"
+
+	// Members with this power level or higher are admins, 50 is a moderator in most clients.
+	adminPowerLevel = 50
+
+	// Sent messages that can be edited later.
+	maxEvents = 1000
+
+	// Name the sync token is stored under.
+	syncTokenName = "matrix"
+)
+
+// SyncTokens keeps the sync token across restarts, lowstock.Storage implements it.
+type SyncTokens interface {
+	SyncToken(ctx context.Context, messenger string) (string, error)
+	SaveSyncToken(ctx context.Context, messenger, token string) error
+}
+
+// Matrix implements lowstock.Messenger with the client-server API of a homeserver.
+// Room and user IDs are mapped to int64 chat and user IDs with ChatID.
+type Matrix struct {
+	homeserver string
+	token      string
+
+	// userID of the bot, it is asked from the homeserver on the first sync.
+	userID string
+
+	// since is the stored sync token, next is the token after pending updates.
+	// next is stored once pending updates are handled, so they are synced again after a restart.
+	tokens  SyncTokens
+	loaded  bool
+	since   string
+	next    string
+	lastID  int64
+	pending []lowstock.MessengerUpdate
+
+	mu sync.Mutex
+	// rooms by chat ID and their joined member counts.
+	rooms   map[int64]string
+	members map[string]int
+	// events sent by the bot by message ID, oldest first in order.
+	events map[int64]string
+	order  []int64
+
+	txnPrefix string
+	txnID     int64
+
+	client  *http.Client
+	timeout time.Duration
+}
+
+// New creates a Matrix client for the homeserver, e.g. "https://matrix.example.com".
+// The access token belongs to the bot account, the sync token is kept in tokens.
+func New(homeserver, accessToken string, tokens SyncTokens) *Matrix {
+	return &Matrix{
+		homeserver: strings.TrimRight(homeserver, "/"),
+		token:      accessToken,
+		tokens:     tokens,
+		rooms:      map[int64]string{},
+		members:    map[string]int{},
+		events:     map[int64]string{},
+		txnPrefix:  fmt.Sprintf("lowstock.%d", time.Now().UnixNano()),
+		client:     &http.Client{Timeout: timeout + 30*time.Second},
+		timeout:    timeout,
+	}
+}
+
+// ChatID maps a Matrix ID, e.g. "!room:example.com" or "@alice:example.com", to an int64 ID.
+// Matrix IDs are too long for int64, a 63 bit hash of the ID is used.
+func ChatID(id string) int64 {
+	h := fnv.New64a()
+	io.WriteString(h, id)
+
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// messageID maps an event ID, e.g. "$abc:example.com", to an int64 ID.
+func messageID(eventID string) int64 {
+	return ChatID(eventID)
+}
+
+var (
+	linkTag  = regexp.MustCompile(`<a href="([^"]*)">(.*?)</a>`)
+	anyTag   = regexp.MustCompile(`<[^>]*>`)
+	preBlock = regexp.MustCompile(`(?s)<pre>.*?</pre>`)
+)
+
+// formattedBody converts the HTML subset of lowstock messages to Matrix HTML.
+// Line breaks are tags there, except in preformatted blocks.
+func formattedBody(text string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, loc := range preBlock.FindAllStringIndex(text, -1) {
+		b.WriteString(strings.Replace(text[last:loc[0]], "\n", "<br>", -1))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(strings.Replace(text[last:], "\n", "<br>", -1))
+
+	return b.String()
+}
+
+// plainBody is the text for clients without HTML, links keep their URLs.
+func plainBody(text string) string {
+	return html.UnescapeString(anyTag.ReplaceAllString(linkTag.ReplaceAllString(text, "$2 ($1)"), ""))
+}
+
+// command is the way to type button data, most clients take "/" for their own commands.
+func command(data string) string {
+	return "!" + strings.TrimPrefix(data, "/")
+}
+
+// toContent renders the message, Matrix has no buttons.
+// Link buttons are added as links and buttons with data as commands to type.
+func toContent(m lowstock.Message) Content {
+	text, body := m.Text, formattedBody(m.Text)
+
+	for _, row := range m.Buttons {
+		var plain, links []string
+		for _, b := range row {
+			if b.URL != "" {
+				plain = append(plain, fmt.Sprintf("%s: %s", b.Text, b.URL))
+				links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(b.URL), html.EscapeString(b.Text)))
+				continue
+			}
+
+			plain = append(plain, fmt.Sprintf("%s: %s", b.Text, command(b.Data)))
+			links = append(links, fmt.Sprintf("%s: <code>%s</code>", html.EscapeString(b.Text), html.EscapeString(command(b.Data))))
+		}
+
+		text += "\n" + strings.Join(plain, "\n")
+		body += "<br>" + strings.Join(links, " · ")
+	}
+
+	msgType := msgTypeText
+	if m.Silent {
+		// Default push rules do not notify about notices.
+		msgType = msgTypeNotice
+	}
+
+	return Content{
+		MsgType:       msgType,
+		Body:          plainBody(text),
+		Format:        formatHTML,
+		FormattedBody: body,
+	}
+}
+
+type InReplyTo struct {
+	EventID string `json:"event_id"`
+}
+
+type RelatesTo struct {
+	RelType   string     `json:"rel_type,omitempty"`
+	EventID   string     `json:"event_id,omitempty"`
+	InReplyTo *InReplyTo `json:"m.in_reply_to,omitempty"`
+}
+
+// Content of m.room.message events.
+type Content struct {
+	MsgType       string     `json:"msgtype"`
+	Body          string     `json:"body"`
+	Format        string     `json:"format,omitempty"`
+	FormattedBody string     `json:"formatted_body,omitempty"`
+	NewContent    *Content   `json:"m.new_content,omitempty"`
+	RelatesTo     *RelatesTo `json:"m.relates_to,omitempty"`
+}
+
+type SendResponse struct {
+	EventID string `json:"event_id"`
+}
+
+// ErrorResponse is returned by the homeserver for failed requests.
+type ErrorResponse struct {
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMS int64  `json:"retry_after_ms"`
+}
+
+type PowerLevels struct {
+	Users        map[string]int `json:"users"`
+	UsersDefault int            `json:"users_default"`
+}
+
+type JoinedRooms struct {
+	JoinedRooms []string `json:"joined_rooms"`
+}
+
+type JoinedMembers struct {
+	Joined map[string]json.RawMessage `json:"joined"`
+}
+
+type WhoAmI struct {
+	UserID string `json:"user_id"`
+}
+
+func apiCall(name string, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`matrix_api_calls{status=%q, method=%q}`, status, name)).Inc()
+}
+
+// do calls the API at path and decodes the response into v.
+// 429 responses are returned as lowstock.RetryAfterError.
+func (m *Matrix) do(name, method, path string, query url.Values, request, v interface{}) (err error) {
+	defer func() { apiCall(name, err) }()
+
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to serialize request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	apiURL := m.homeserver + apiPath + path
+	if len(query) > 0 {
+		apiURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, apiURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("failed to call %s, status: %s, body: %s", name, resp.Status, string(respBody))
+
+		var errResp ErrorResponse
+		if resp.StatusCode == http.StatusTooManyRequests && json.Unmarshal(respBody, &errResp) == nil && errResp.RetryAfterMS > 0 {
+			return &lowstock.RetryAfterError{RetryAfter: time.Duration(errResp.RetryAfterMS) * time.Millisecond, Err: err}
+		}
+
+		// Bad requests and rooms the bot may not post to fail again on retries.
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: %s", lowstock.ErrUndeliverable, err)
+		}
+
+		return err
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(respBody, v); err != nil {
+			return fmt.Errorf("failed to unmarshal %s response: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func roomPath(roomID string) string {
+	return "/rooms/" + url.PathEscape(roomID)
+}
+
+// roomID returns the room of the chat ID, joined rooms are listed when the room is not known yet.
+func (m *Matrix) roomID(chatID int64) (string, error) {
+	m.mu.Lock()
+	roomID, ok := m.rooms[chatID]
+	m.mu.Unlock()
+
+	if ok {
+		return roomID, nil
+	}
+
+	var joined JoinedRooms
+	if err := m.do("joined_rooms", http.MethodGet, "/joined_rooms", nil, nil, &joined); err != nil {
+		return "", err
+	}
+
+	for _, id := range joined.JoinedRooms {
+		m.addRoom(id)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if roomID, ok := m.rooms[chatID]; ok {
+		return roomID, nil
+	}
+
+	return "", fmt.Errorf("room of chat %d is not joined", chatID)
+}
+
+func (m *Matrix) addRoom(roomID string) {
+	m.mu.Lock()
+	m.rooms[ChatID(roomID)] = roomID
+	m.mu.Unlock()
+}
+
+// addEvent keeps the event ID of a sent message for EditMessage.
+func (m *Matrix) addEvent(eventID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := messageID(eventID)
+	if _, ok := m.events[id]; ok {
+		return
+	}
+
+	m.events[id] = eventID
+	m.order = append(m.order, id)
+
+	if len(m.order) > maxEvents {
+		delete(m.events, m.order[0])
+		m.order = m.order[1:]
+	}
+}
+
+func (m *Matrix) eventID(messageID int64) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eventID, ok := m.events[messageID]
+	return eventID, ok
+}
+
+// send puts an m.room.message event to the room of the chat.
+func (m *Matrix) send(content Content, chatID int64) error {
+	roomID, err := m.roomID(chatID)
+	if err != nil {
+		return err
+	}
+
+	txnID := fmt.Sprintf("%s.%d", m.txnPrefix, atomic.AddInt64(&m.txnID, 1))
+	path := roomPath(roomID) + "/send/m.room.message/" + url.PathEscape(txnID)
+
+	var resp SendResponse
+	if err := m.do("send", http.MethodPut, path, nil, content, &resp); err != nil {
+		return err
+	}
+
+	m.addEvent(resp.EventID)
+
+	return nil
+}
+
+// SendTextMessage to the chat with provided ID.
+func (m *Matrix) SendTextMessage(text string, chatID int64) error {
+	return m.send(toContent(lowstock.Message{Text: text}), chatID)
+}
+
+// SendMessage with buttons rendered as links and commands to the chat with provided ID.
+func (m *Matrix) SendMessage(msg lowstock.Message, chatID int64) error {
+	return m.send(toContent(msg), chatID)
+}
+
+// EditMessage replaces the message sent by the bot with an m.replace event.
+// Only recent messages of this process can be edited.
+func (m *Matrix) EditMessage(msg lowstock.Message, chatID, messageID int64) error {
+	eventID, ok := m.eventID(messageID)
+	if !ok {
+		return fmt.Errorf("message %d is not known", messageID)
+	}
+
+	content := toContent(msg)
+	newContent := content
+
+	// Clients without edits show the fallback.
+	content.Body = "* " + content.Body
+	content.FormattedBody = "* " + content.FormattedBody
+	content.NewContent = &newContent
+	content.RelatesTo = &RelatesTo{RelType: "m.replace", EventID: eventID}
+
+	return m.send(content, chatID)
+}
+
+// AnswerCallback does nothing, Matrix has no buttons to confirm.
+func (m *Matrix) AnswerCallback(callbackID string) error {
+	return nil
+}
+
+func (m *Matrix) SendLoginURL(text, uri string, chatID int64) error {
+	msg := lowstock.Message{
+		Text: text,
+		Buttons: [][]lowstock.Button{
+			[]lowstock.Button{lowstock.Button{Text: "Login to Etsy", URL: uri}},
+		},
+	}
+
+	return m.send(toContent(msg), chatID)
+}
+
+// IsChatAdmin reports whether the user has at least the moderator power level in the room.
+func (m *Matrix) IsChatAdmin(chatID, userID int64) (bool, error) {
+	roomID, err := m.roomID(chatID)
+	if err != nil {
+		return false, err
+	}
+
+	var levels PowerLevels
+	if err := m.do("power_levels", http.MethodGet, roomPath(roomID)+"/state/m.room.power_levels", nil, nil, &levels); err != nil {
+		return false, err
+	}
+
+	for id, level := range levels.Users {
+		if ChatID(id) == userID {
+			return level >= adminPowerLevel, nil
+		}
+	}
+
+	return levels.UsersDefault >= adminPowerLevel, nil
+}
+
+// memberCount returns the number of joined members of the room, it is asked from the homeserver when not known.
+func (m *Matrix) memberCount(roomID string) (int, error) {
+	m.mu.Lock()
+	count, ok := m.members[roomID]
+	m.mu.Unlock()
+
+	if ok {
+		return count, nil
+	}
+
+	var members JoinedMembers
+	if err := m.do("joined_members", http.MethodGet, roomPath(roomID)+"/joined_members", nil, nil, &members); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	m.members[roomID] = len(members.Joined)
+	m.mu.Unlock()
+
+	return len(members.Joined), nil
+}
+
+var errNoUserID = errors.New("homeserver returned no user ID")
+
+func (m *Matrix) whoAmI() error {
+	if m.userID != "" {
+		return nil
+	}
+
+	var resp WhoAmI
+	if err := m.do("whoami", http.MethodGet, "/account/whoami", nil, nil, &resp); err != nil {
+		return err
+	}
+
+	if resp.UserID == "" {
+		return errNoUserID
+	}
+	m.userID = resp.UserID
+
+	return nil
+}
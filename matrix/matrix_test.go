@@ -0,0 +1,211 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ lowstock.Messenger = (*Matrix)(nil)
+
+const roomID = "!shop:example.com"
+
+func TestChatID(t *testing.T) {
+	id := ChatID(roomID)
+
+	if id <= 0 || id != ChatID(roomID) {
+		t.Errorf("Expected a stable positive ID, got: %d", id)
+	}
+
+	if id == ChatID("!other:example.com") {
+		t.Errorf("Different rooms got the same ID: %d", id)
+	}
+}
+
+func TestToContent(t *testing.T) {
+	msg := lowstock.Message{
+		Text: "<b>Sold out:</b> Mug &amp; cup\n<pre>a\nb</pre>",
+		Buttons: [][]lowstock.Button{
+			[]lowstock.Button{lowstock.Button{Text: "Open listing", URL: "https://www.etsy.com/listing/42"}},
+			[]lowstock.Button{lowstock.Button{Text: "Mark restocked", Data: "/restocked 42 #7"}},
+		},
+		Silent: true,
+	}
+
+	expected := Content{
+		MsgType: msgTypeNotice,
+		Body:    "Sold out: Mug & cup\na\nb\nOpen listing: https://www.etsy.com/listing/42\nMark restocked: !restocked 42 #7",
+		Format:  formatHTML,
+		FormattedBody: "<b>Sold out:</b> Mug &amp; cup<br><pre>a\nb</pre>" +
+			`<br><a href="https://www.etsy.com/listing/42">Open listing</a>` +
+			"<br>Mark restocked: <code>!restocked 42 #7</code>",
+	}
+
+	if diff := cmp.Diff(expected, toContent(msg)); diff != "" {
+		t.Errorf("Content does not match:\n%s", diff)
+	}
+}
+
+// tokens keeps sync tokens in memory.
+type tokens map[string]string
+
+func (t tokens) SyncToken(ctx context.Context, messenger string) (string, error) {
+	token, ok := t[messenger]
+	if !ok {
+		return "", lowstock.ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (t tokens) SaveSyncToken(ctx context.Context, messenger, token string) error {
+	t[messenger] = token
+	return nil
+}
+
+type request struct {
+	method  string
+	path    string
+	content Content
+}
+
+// homeserver records requests and answers them with responses by path.
+func homeserver(t *testing.T, responses map[string]string) (*httptest.Server, *[]request) {
+	var requests []request
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			t.Errorf("Unexpected authorization: %q", r.Header.Get("Authorization"))
+		}
+
+		req := request{method: r.Method, path: r.URL.Path}
+		if r.Method == http.MethodPut {
+			if err := json.NewDecoder(r.Body).Decode(&req.content); err != nil {
+				t.Errorf("Failed to decode request: %s", err)
+			}
+		}
+		requests = append(requests, req)
+
+		path := strings.TrimPrefix(r.URL.Path, apiPath)
+		if strings.Contains(path, "/send/") {
+			path = "/send"
+		}
+
+		resp, ok := responses[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			resp = `{"errcode":"M_NOT_FOUND","error":"Not found"}`
+		}
+		if strings.Contains(resp, "M_LIMIT_EXCEEDED") {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+
+		w.Write([]byte(resp))
+	}))
+
+	return ts, &requests
+}
+
+func TestSendMessage(t *testing.T) {
+	ts, requests := homeserver(t, map[string]string{
+		"/joined_rooms": `{"joined_rooms":["!shop:example.com"]}`,
+		"/send":         `{"event_id":"$sent:example.com"}`,
+	})
+	defer ts.Close()
+
+	m := New(ts.URL+"/", "s3cret", tokens{})
+
+	if err := m.SendMessage(lowstock.Message{Text: "<b>Hi</b>"}, ChatID(roomID)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := m.EditMessage(lowstock.Message{Text: "<b>Bye</b>"}, ChatID(roomID), messageID("$sent:example.com")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(*requests) != 3 {
+		t.Fatalf("Unexpected requests: %+v", *requests)
+	}
+
+	// The room is looked up once.
+	sent := (*requests)[1]
+	if sent.method != http.MethodPut || !strings.HasPrefix(sent.path, apiPath+"/rooms/!shop:example.com/send/m.room.message/") {
+		t.Errorf("Unexpected request: %s %s", sent.method, sent.path)
+	}
+
+	if sent.content.MsgType != msgTypeText || sent.content.FormattedBody != "<b>Hi</b>" || sent.content.Body != "Hi" {
+		t.Errorf("Unexpected content: %+v", sent.content)
+	}
+
+	edit := (*requests)[2].content
+	if edit.RelatesTo == nil || edit.RelatesTo.RelType != "m.replace" || edit.RelatesTo.EventID != "$sent:example.com" ||
+		edit.NewContent == nil || edit.NewContent.Body != "Bye" || edit.Body != "* Bye" {
+		t.Errorf("Unexpected edit: %+v", edit)
+	}
+
+	if (*requests)[1].path == (*requests)[2].path {
+		t.Error("Transaction ID is reused")
+	}
+
+	if err := m.EditMessage(lowstock.Message{Text: "Bye"}, ChatID(roomID), 42); err == nil {
+		t.Error("Expected an error for an unknown message")
+	}
+}
+
+func TestSendMessageErrors(t *testing.T) {
+	ts, _ := homeserver(t, map[string]string{
+		"/joined_rooms": `{"joined_rooms":["!shop:example.com"]}`,
+		"/send":         `{"errcode":"M_LIMIT_EXCEEDED","error":"Too many requests","retry_after_ms":2500}`,
+	})
+	defer ts.Close()
+
+	m := New(ts.URL, "s3cret", tokens{})
+
+	err := m.SendTextMessage("Hi", ChatID(roomID))
+
+	var retryErr *lowstock.RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter != 2500*time.Millisecond {
+		t.Errorf("Got error: %v, expected to retry after 2.5s", err)
+	}
+
+	if err := m.SendTextMessage("Hi", ChatID("!gone:example.com")); err == nil || !strings.Contains(err.Error(), "not joined") {
+		t.Errorf("Got error: %v, expected the room not to be joined", err)
+	}
+}
+
+func TestIsChatAdmin(t *testing.T) {
+	ts, _ := homeserver(t, map[string]string{
+		"/joined_rooms": `{"joined_rooms":["!shop:example.com"]}`,
+		"/rooms/!shop:example.com/state/m.room.power_levels": `{"users":{"@owner:example.com":100,"@mod:example.com":50,"@muted:example.com":-1},"users_default":0}`,
+	})
+	defer ts.Close()
+
+	m := New(ts.URL, "s3cret", tokens{})
+
+	tests := map[string]bool{
+		"@owner:example.com": true,
+		"@mod:example.com":   true,
+		"@muted:example.com": false,
+		"@guest:example.com": false,
+	}
+
+	for user, expected := range tests {
+		actual, err := m.IsChatAdmin(ChatID(roomID), ChatID(user))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if actual != expected {
+			t.Errorf("Got %t for %s, expected: %t", actual, user, expected)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+)
+
+const (
+	// Wait timeout of /sync long polling, same as Telegram.
+	timeout = 60 * time.Second
+
+	// Only messages are synced, summaries need lazy loading of members.
+	syncFilter = `{"presence":{"not_types":["*"]},"account_data":{"not_types":["*"]},` +
+		`"room":{"timeline":{"types":["m.room.message"]},"state":{"lazy_load_members":true},` +
+		`"ephemeral":{"not_types":["*"]},"account_data":{"not_types":["*"]}}}`
+)
+
+type Event struct {
+	Type           string  `json:"type"`
+	EventID        string  `json:"event_id"`
+	Sender         string  `json:"sender"`
+	OriginServerTS int64   `json:"origin_server_ts"`
+	Content        Content `json:"content"`
+}
+
+type RoomSummary struct {
+	JoinedMemberCount *int `json:"m.joined_member_count"`
+}
+
+type Timeline struct {
+	Events  []Event `json:"events"`
+	Limited bool    `json:"limited"`
+}
+
+type JoinedRoom struct {
+	Summary  RoomSummary `json:"summary"`
+	Timeline Timeline    `json:"timeline"`
+}
+
+type SyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join   map[string]JoinedRoom      `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+		Leave  map[string]json.RawMessage `json:"leave"`
+	} `json:"rooms"`
+}
+
+// stripReplyFallback removes the quote of the replied message, older clients put it in front of the reply.
+func stripReplyFallback(body string) string {
+	lines := strings.Split(body, "\n")
+
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+
+	return strings.Join(lines[i:], "\n")
+}
+
+// toMessengerUpdate converts a command message, other events are skipped.
+// Commands start with "/" or with "!", as most clients take "/" for their own commands.
+// A command replying to a message of the bot is handled like a pressed button of that message.
+func (m *Matrix) toMessengerUpdate(roomID string, e Event) (lowstock.MessengerUpdate, bool) {
+	if e.Type != "m.room.message" || e.Sender == m.userID || e.Content.MsgType != msgTypeText {
+		return lowstock.MessengerUpdate{}, false
+	}
+
+	relatesTo := e.Content.RelatesTo
+	if relatesTo != nil && relatesTo.RelType == "m.replace" {
+		// Edits are not commands.
+		return lowstock.MessengerUpdate{}, false
+	}
+
+	body := e.Content.Body
+	if relatesTo != nil && relatesTo.InReplyTo != nil {
+		body = stripReplyFallback(body)
+	}
+
+	text := strings.TrimSpace(body)
+	if strings.HasPrefix(text, "!") {
+		text = "/" + text[1:]
+	}
+
+	if !strings.HasPrefix(text, "/") || len(text) == 1 {
+		return lowstock.MessengerUpdate{}, false
+	}
+
+	chatType := "group"
+	count, err := m.memberCount(roomID)
+	if err != nil {
+		log.Printf("Failed to get members of room %s: %s", roomID, err)
+	} else if count <= 2 {
+		chatType = "private"
+	}
+
+	upd := lowstock.MessengerUpdate{
+		Command:  strings.Fields(text)[0],
+		Text:     text,
+		ChatID:   ChatID(roomID),
+		UserID:   ChatID(e.Sender),
+		ChatType: chatType,
+	}
+
+	if relatesTo != nil && relatesTo.InReplyTo != nil {
+		if _, ok := m.eventID(messageID(relatesTo.InReplyTo.EventID)); ok {
+			upd.CallbackID = e.EventID
+			upd.MessageID = messageID(relatesTo.InReplyTo.EventID)
+		}
+	}
+
+	return upd, true
+}
+
+func (m *Matrix) join(roomID string) {
+	if err := m.do("join", http.MethodPost, "/join/"+url.PathEscape(roomID), nil, struct{}{}, nil); err != nil {
+		log.Printf("Failed to join room %s: %s", roomID, err)
+		return
+	}
+
+	m.addRoom(roomID)
+}
+
+func (m *Matrix) leave(roomID string) {
+	m.mu.Lock()
+	delete(m.rooms, ChatID(roomID))
+	delete(m.members, roomID)
+	m.mu.Unlock()
+}
+
+// syncToken returns the token to sync from.
+// The token after handled updates is stored first, the stored token is read on the first call.
+func (m *Matrix) syncToken() (string, error) {
+	ctx := context.Background()
+
+	if !m.loaded {
+		since, err := m.tokens.SyncToken(ctx, syncTokenName)
+		if err != nil && !errors.Is(err, lowstock.ErrNotFound) {
+			return "", fmt.Errorf("failed to get sync token: %w", err)
+		}
+
+		m.since, m.next, m.loaded = since, since, true
+	}
+
+	if m.next != m.since {
+		if err := m.tokens.SaveSyncToken(ctx, syncTokenName, m.next); err != nil {
+			return "", fmt.Errorf("failed to save sync token: %w", err)
+		}
+
+		m.since = m.next
+	}
+
+	return m.since, nil
+}
+
+// Updates provides commands with IDs not less than lastMsgID, like the offset of Telegram getUpdates.
+// Updates before lastMsgID are handled, the rest are returned again until then.
+// New updates are long polled with /sync. The sync token is stored once they are handled,
+// commands sent while the bot was down are synced after a restart.
+func (m *Matrix) Updates(lastMsgID int64) ([]lowstock.MessengerUpdate, error) {
+	for len(m.pending) > 0 && m.pending[0].ID < lastMsgID {
+		m.pending = m.pending[1:]
+	}
+
+	if len(m.pending) > 0 {
+		return m.pending, nil
+	}
+
+	if err := m.whoAmI(); err != nil {
+		return nil, err
+	}
+
+	since, err := m.syncToken()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"timeout": {strconv.FormatInt(int64(m.timeout/time.Millisecond), 10)},
+		"filter":  {syncFilter},
+	}
+	if since != "" {
+		query.Set("since", since)
+	}
+
+	var resp SyncResponse
+	if err := m.do("sync", http.MethodGet, "/sync", query, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	for roomID := range resp.Rooms.Invite {
+		m.join(roomID)
+	}
+
+	for roomID := range resp.Rooms.Leave {
+		m.leave(roomID)
+	}
+
+	var events []Event
+	rooms := map[string]string{}
+
+	for roomID, room := range resp.Rooms.Join {
+		m.addRoom(roomID)
+
+		if count := room.Summary.JoinedMemberCount; count != nil {
+			m.mu.Lock()
+			m.members[roomID] = *count
+			m.mu.Unlock()
+		}
+
+		// The very first sync only learns the rooms, old commands like !stop are not replayed.
+		if since == "" {
+			continue
+		}
+
+		if room.Timeline.Limited {
+			log.Printf("Sync of room %s is limited, older messages are skipped", roomID)
+		}
+
+		for _, e := range room.Timeline.Events {
+			events = append(events, e)
+			rooms[e.EventID] = roomID
+		}
+	}
+
+	// Rooms come in no particular order.
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].OriginServerTS < events[j].OriginServerTS
+	})
+
+	updates := []lowstock.MessengerUpdate{}
+	for _, e := range events {
+		upd, ok := m.toMessengerUpdate(rooms[e.EventID], e)
+		if !ok {
+			continue
+		}
+
+		m.lastID++
+		upd.ID = m.lastID
+		updates = append(updates, upd)
+	}
+
+	m.next = resp.NextBatch
+	m.pending = updates
+
+	return updates, nil
+}
@@ -0,0 +1,157 @@
+package matrix
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStripReplyFallback(t *testing.T) {
+	body := "> <@lowstock:example.com> Low stock: Mug\n> Quantity: 2\n\n!stock 2"
+
+	if actual := strings.TrimSpace(stripReplyFallback(body)); actual != "!stock 2" {
+		t.Errorf("Got: %q, expected: %q", actual, "!stock 2")
+	}
+}
+
+func message(id, sender, body string, ts int64) string {
+	return fmt.Sprintf(`{"type":"m.room.message","event_id":%q,"sender":%q,"origin_server_ts":%d,"content":{"msgtype":"m.text","body":%q}}`, id, sender, ts, body)
+}
+
+func TestUpdates(t *testing.T) {
+	syncs := map[string]string{
+		// Without a stored token the first sync only learns the rooms, old commands are skipped.
+		"": `{"next_batch":"s1","rooms":{"invite":{"!new:example.com":{}},"join":{"!shop:example.com":{"summary":{"m.joined_member_count":5},` +
+			`"timeline":{"events":[` + message("$old", "@alice:example.com", "/start", 1) + `]}}}}}`,
+		"s1": `{"next_batch":"s2","rooms":{"join":{` +
+			`"!shop:example.com":{"summary":{"m.joined_member_count":5},"timeline":{"events":[` +
+			message("$3", "@alice:example.com", "!stock 2", 30) + `,` +
+			message("$1", "@alice:example.com", "hello", 10) + `,` +
+			message("$4", "@lowstock:example.com", "/help", 40) + `,` +
+			`{"type":"m.room.message","event_id":"$5","sender":"@alice:example.com","origin_server_ts":50,` +
+			`"content":{"msgtype":"m.text","body":"> <@lowstock:example.com> Stock\n\n!stock 3","m.relates_to":{"m.in_reply_to":{"event_id":"$sent:example.com"}}}}` +
+			`]}},` +
+			`"!dm:example.com":{"timeline":{"events":[` + message("$2", "@bob:example.com", "/pin 1234", 20) + `]}}}}}`,
+		"s2": `{"next_batch":"s3"}`,
+	}
+
+	var calls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, apiPath)
+		calls = append(calls, r.Method+" "+path)
+
+		switch {
+		case path == "/account/whoami":
+			fmt.Fprint(w, `{"user_id":"@lowstock:example.com"}`)
+		case path == "/sync":
+			if r.URL.Query().Get("filter") != syncFilter || r.URL.Query().Get("timeout") != "60000" {
+				t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, syncs[r.URL.Query().Get("since")])
+		case path == "/join/!new:example.com":
+			fmt.Fprint(w, `{"room_id":"!new:example.com"}`)
+		case path == "/rooms/!dm:example.com/joined_members":
+			fmt.Fprint(w, `{"joined":{"@bob:example.com":{},"@lowstock:example.com":{}}}`)
+		default:
+			t.Errorf("Unexpected call: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	stored := tokens{}
+	m := New(ts.URL, "s3cret", stored)
+	m.addEvent("$sent:example.com")
+
+	shop, dm := ChatID("!shop:example.com"), ChatID("!dm:example.com")
+	alice, bob := ChatID("@alice:example.com"), ChatID("@bob:example.com")
+
+	updates, err := m.Updates(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(updates) != 0 {
+		t.Errorf("Old commands are replayed: %+v", updates)
+	}
+
+	if _, err := m.roomID(ChatID("!new:example.com")); err != nil {
+		t.Errorf("Invited room is not joined: %s", err)
+	}
+
+	if len(stored) != 0 {
+		t.Errorf("Sync token is stored before updates are handled: %v", stored)
+	}
+
+	expected := []lowstock.MessengerUpdate{
+		lowstock.MessengerUpdate{ID: 1, ChatID: dm, UserID: bob, Command: "/pin", Text: "/pin 1234", ChatType: "private"},
+		lowstock.MessengerUpdate{ID: 2, ChatID: shop, UserID: alice, Command: "/stock", Text: "/stock 2", ChatType: "group"},
+		lowstock.MessengerUpdate{
+			ID: 3, ChatID: shop, UserID: alice, Command: "/stock", Text: "/stock 3", ChatType: "group",
+			CallbackID: "$5", MessageID: messageID("$sent:example.com"),
+		},
+	}
+
+	updates, err = m.Updates(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(expected, updates); diff != "" {
+		t.Errorf("Updates mismatch (-want +got):\n%s", diff)
+	}
+
+	if stored[syncTokenName] != "s1" {
+		t.Errorf("Got sync token: %q, expected: %q", stored[syncTokenName], "s1")
+	}
+
+	// Updates that are not handled yet come again without a sync.
+	updates, _ = m.Updates(3)
+	if diff := cmp.Diff(expected[2:], updates); diff != "" {
+		t.Errorf("Updates mismatch (-want +got):\n%s", diff)
+	}
+
+	// After a restart updates that were not handled are synced again.
+	restarted := New(ts.URL, "s3cret", stored)
+	restarted.addEvent("$sent:example.com")
+
+	updates, err = restarted.Updates(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(expected, updates); diff != "" {
+		t.Errorf("Updates mismatch (-want +got):\n%s", diff)
+	}
+
+	updates, _ = m.Updates(4)
+	if len(updates) != 0 {
+		t.Errorf("Unexpected updates: %+v", updates)
+	}
+
+	if stored[syncTokenName] != "s2" {
+		t.Errorf("Got sync token: %q, expected: %q", stored[syncTokenName], "s2")
+	}
+
+	expectedCalls := []string{
+		"GET /account/whoami",
+		"GET /sync",
+		"POST /join/!new:example.com",
+		"GET /sync",
+		"GET /rooms/!dm:example.com/joined_members",
+		"GET /account/whoami",
+		"GET /sync",
+		"GET /rooms/!dm:example.com/joined_members",
+		"GET /sync",
+	}
+
+	if diff := cmp.Diff(expectedCalls, calls); diff != "" {
+		t.Errorf("Calls mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -5,6 +5,27 @@ var (
 
 /start	- Login to your Etsy shop
 /pin	- Submit login Pin
+/threshold	- Show or set low stock threshold
+/watch	- Set threshold for a listing or SKU
+/unwatch	- Remove listing or SKU threshold
+/watches	- List listing and SKU thresholds
+/notify	- Turn listing state alerts on or off
+/template	- Show, set or reset alert template
+/language	- Change bot language
+/stop	- Pause alerts
+/resume	- Resume alerts
+/logout	- Unlink your shop and delete your data
+/shops	- List and switch shops linked to this chat
+/status	- Show status of the linked shop
+/stock	- List low and sold-out listings
+/digest	- Show or set daily and weekly digests
+/quiet	- Show or set quiet hours
+/snooze	- Hold alerts back for a while
+/mute	- Show or mute alerts of a listing or SKU
+/unmute	- Unmute a listing or SKU
+/restocked	- Mark a listing restocked
+/email	- Show or set the email address for alerts
+/webhook	- List, add, remove or test webhooks
 /help	- Send this message`
 
 	startMsg = `<b>Welcome to the Lowstock!</b>
@@ -12,7 +33,9 @@ var (
 This bot keeps track of your Etsy listings and informs you when the listing is sold-out.
 Before you start getting notifications, you need to log in.
 This application will request read-only access to your shop information and your listings.
-This app stores a minimal amount of data needed for notification functionality: your Etsy user id and access token.
+This app stores a minimal amount of data needed for notification functionality: your Etsy user id and access token, listing states and alerts.
+If you set them, it also stores your email address, webhook URLs and their secrets.
+Type /logout at any time to delete all of them.
 
 After you have logged in into your Etsy account and authorized this app - you will get a one-time pin code.
 
@@ -31,6 +54,78 @@ This bot is opensource. You can find <a href="https://github.com/cooldarkdryplac
 	successMsg = `Success!
 You will be notified when products are sold out.`
 
+	notLinkedMsg = `There is no Etsy shop linked to this chat.
+
+Type /start to log in.`
+
+	thresholdMsg = `Low stock threshold: <b>%d</b>.
+
+You will be notified when an active listing has this many items or less. Zero turns low stock alerts off.`
+
+	thresholdUsageMsg = `Please submit a threshold in a form:
+<code>/threshold {quantity}</code>
+
+Example:
+<code>/threshold 3</code>`
+
+	watchMsg = `Low stock threshold for %s: <b>%d</b>.`
+
+	unwatchMsg = `Threshold for %s is removed, the default one applies.`
+
+	watchNotFoundMsg = `There is no threshold for %s.`
+
+	watchUsageMsg = `Please submit a listing ID or SKU and a threshold in a form:
+<code>/watch {listing id or SKU} {quantity}</code>
+<code>/unwatch {listing id or SKU}</code>
+Numbers are listing IDs, use <code>sku:1001</code> for SKUs made of digits.
+
+Example:
+<code>/watch 771234567 10</code>
+<code>/watch MUG-RED-01 0</code>`
+
+	watchesMsg = `Default low stock threshold: <b>%d</b>.
+%s`
+
+	noWatchesMsg = `There are no listing or SKU thresholds.`
+
+	notifyMsg = `Sold-out and low stock alerts are always on.
+
+Back in stock: <b>%s</b>
+Expired: <b>%s</b>
+Removed: <b>%s</b>`
+
+	notifyUsageMsg = `Please submit an alert and on or off in a form:
+<code>/notify {restocked|expired|removed} {on|off}</code>
+
+Example:
+<code>/notify restocked on</code>`
+
+	templateMsg = `Your alert template:
+
+<pre>%s</pre>
+
+Type <code>/template reset</code> to use the built-in one.`
+
+	templateDefaultMsg = `You are using the built-in alert template.
+
+Type <code>/template set {template}</code> to write your own.`
+
+	templateSavedMsg = `Alert template is saved.`
+
+	templateResetMsg = `Alert template is reset, the built-in one is used.`
+
+	templateErrorMsg = `Template is not saved: <code>%s</code>`
+
+	templateUsageMsg = `Alert template uses Go text/template syntax, the result is HTML:
+<code>/template set {template}</code>
+<code>/template reset</code>
+
+Fields: <code>.Kind</code> (sold_out, low_stock, restocked, expired, removed), <code>.Title</code>, <code>.ShopName</code>, <code>.ListingID</code>, <code>.Quantity</code>, <code>.SKUs</code>, <code>.ListingURL</code>, <code>.EditURL</code>, <code>.Time</code>.
+Functions: <code>html</code> escapes a value, <code>join</code> joins SKUs.
+
+Example:
+<code>/template set {{if eq .Kind "sold_out"}}Ausverkauft{{else}}{{.Kind}}{{end}}: {{html .Title}} ({{join .SKUs ", " | html}})</code>`
+
 	emptyPinMsg = `You have entered an empty Pin.
 
 Please submit pin to this chat in a form:
@@ -40,5 +135,299 @@ Example:
 <code>/pin 76279961</code>
 
 If you need a new pin, please type /start and go through login procedure again.
+`
+
+	languageMsg = `Language: <b>%s</b>.
+
+Available: %s
+Type <code>/language {code}</code> to change it, e.g. <code>/language de</code>.`
+
+	languageUsageMsg = `This language is not supported.
+
+Available: %s`
+
+	stopMsg = `Alerts are paused.
+
+Type /resume to turn them on again, or /logout to unlink your shop and delete your data.`
+
+	resumeMsg = `Alerts are on.`
+
+	logoutMsg = `Your shop is unlinked, your Etsy user id, access token and settings are deleted.
+
+To revoke access of this app on Etsy side, remove it in <a href="https://www.etsy.com/your/account/apps">Apps you've connected</a>.
+Type /start to log in again.`
+
+	logoutChatMsg = `The shop is unlinked from this chat.
+
+It is still linked to other chats, so its settings are kept until it is unlinked from all of them.`
+
+	adminOnlyMsg = `Only group admins and the member who linked the shop can do this.`
+
+	shopsMsg = `Shops linked to this chat, commands apply to the one in bold:
+%s
+
+Type <code>/shops {number}</code> to switch, or /start to link one more shop.`
+
+	shopsUsageMsg = `Please submit a shop number from the /shops list in a form:
+<code>/shops {number}</code>
+
+Example:
+<code>/shops 2</code>`
+
+	unnamedShopText = `Etsy user %d`
+
+	statusMsg = `<b>Shop:</b> %s
+<b>Last feed poll:</b> %s
+<b>Updates in the last 24 hours:</b> %d
+<b>Low stock threshold:</b> %d
+<b>Listing and SKU thresholds:</b> %d
+<b>Alerts:</b> %s
+<b>Etsy access:</b> %s`
+
+	stockMsg = `Low and sold-out listings of <b>%s</b>, page %d of %d:`
+
+	stockEmptyMsg = `Nothing is low or sold out in <b>%s</b>.`
+
+	stockUsageMsg = `Please submit a page number in a form:
+<code>/stock {page}</code>
+
+Example:
+<code>/stock 2</code>`
+
+	stockSoldOutText = `• <a href="%s">%s</a> — sold out`
+	stockLowText     = `• <a href="%s">%s</a> — <b>%d</b> left`
+
+	digestMsg = `Digest: <b>%s</b> at <b>%s</b> (%s).
+Instant alerts: <b>%s</b>
+
+Type <code>/digest off</code> to turn digests off.`
+
+	digestOffMsg = `Digests are off.
+
+Type <code>/digest daily 08:00 Europe/Berlin</code> to get one every morning.`
+
+	digestUsageMsg = `Please submit a digest schedule in a form:
+<code>/digest {daily|weekly} {HH:MM} {timezone}</code>
+<code>/digest off</code>
+
+Weekly digests are sent on Mondays. Add <code>only</code> to get digests instead of instant alerts.
+
+Example:
+<code>/digest daily 08:00 Europe/Berlin</code>
+<code>/digest weekly 09:30 America/New_York only</code>`
+
+	digestDailyText  = `daily`
+	digestWeeklyText = `weekly on Mondays`
+
+	digestTitleMsg = `<b>Digest of %s</b>`
+
+	digestSoldOutText  = `Sold out:`
+	digestBackText     = `Back in stock:`
+	digestLowStockText = `Under threshold:`
+
+	digestItemText     = `• <a href="%s">%s</a>`
+	digestBackItemText = `• <a href="%s">%s</a> — <b>%d</b> in stock`
+
+	digestEmptyMsg = `Nothing sold out, came back or dropped under the threshold.`
+
+	quietMsg = `Quiet hours: <b>%s–%s</b> (%s), alerts are <b>%s</b>.
+
+Type <code>/quiet off</code> to turn quiet hours off.`
+
+	quietOffMsg = `Quiet hours are off.
+
+Type <code>/quiet 22:00 07:00 Europe/Berlin</code> to hold alerts back at night.`
+
+	quietUsageMsg = `Please submit quiet hours in a form:
+<code>/quiet {HH:MM} {HH:MM} {timezone}</code>
+<code>/quiet off</code>
+
+Alerts are held back and sent as one message when quiet hours end. Add <code>silent</code> to get them right away without a sound.
+
+Example:
+<code>/quiet 22:00 07:00 Europe/Berlin</code>
+<code>/quiet 23:30 06:00 silent</code>`
+
+	quietDeferText  = `held back until quiet hours end`
+	quietSilentText = `delivered without a sound`
+
+	snoozeMsg = `Alerts are snoozed until <b>%s</b>, you will get them in one message then.
+
+Type <code>/snooze off</code> to get them now.`
+
+	snoozeOffMsg = `Snooze is off.`
+
+	snoozeUsageMsg = `Please submit snooze time in a form:
+<code>/snooze {duration}</code>
+<code>/snooze off</code>
+
+Example:
+<code>/snooze 30m</code>
+<code>/snooze 2h</code>
+<code>/snooze 1d</code>`
+
+	deferredMsg = `<b>Alerts held back: %d</b>`
+
+	muteMsg = `Alerts of %s are muted.`
+
+	muteUntilMsg = `Alerts of %s are muted until <b>%s</b>.`
+
+	unmuteMsg = `Alerts of %s are on again.`
+
+	muteNotFoundMsg = `%s is not muted.`
+
+	muteUsageMsg = `Please submit a listing ID or SKU and an optional duration in a form:
+<code>/mute {listing id or SKU} {duration}</code>
+<code>/unmute {listing id or SKU}</code>
+Numbers are listing IDs, use <code>sku:1001</code> for SKUs made of digits.
+
+Example:
+<code>/mute 771234567 1d</code>
+<code>/mute MUG-RED-01</code>`
+
+	mutesMsg = `Muted alerts:
+%s`
+
+	noMutesMsg = `Nothing is muted.`
+
+	muteItemText      = `• %s`
+	muteItemUntilText = `• %s until <b>%s</b>`
+
+	restockedMsg = `Marked %s restocked, the next drop under the threshold sends an alert again.`
+
+	restockedUsageMsg = `Please submit a listing ID in a form:
+<code>/restocked {listing id}</code>`
+
+	listingNotFoundMsg = `Listing %d is not known in this shop.`
+
+	emailMsg = `Alerts are emailed to <b>%s</b>.
+
+Type <code>/email off</code> to stop.`
+
+	emailUnsetMsg = `Alerts are not emailed.
+
+Type <code>/email {address}</code> to get them by email as well.`
+
+	emailUsageMsg = `Please submit an email address or the confirmation code in a form:
+<code>/email {address}</code>
+<code>/email verify {code}</code>
+<code>/email off</code>
+
+Example:
+<code>/email books@example.com</code>
+<code>/email verify 123456</code>`
+
+	emailCodeMsg = `Lowstock confirmation code: %[1]s
+
+Send <code>/email verify %[1]s</code> to the bot within an hour to get alerts at this address.
+If you did not ask for it, ignore this email.`
+
+	emailCodeSentMsg = `A confirmation code is sent to <b>%s</b>. Submit it within an hour in a form:
+<code>/email verify {code}</code>`
+
+	emailVerifiedMsg = `Done! Alerts are emailed to <b>%s</b>.`
+
+	emailBadCodeMsg = `The code is wrong or expired. Type <code>/email {address}</code> to get a new one.`
+
+	emailFailedMsg = `Failed to send an email to <b>%s</b>, please check the address.`
+
+	emailOffMsg = `Alerts are no longer emailed.`
+
+	emailDisabledMsg = `Email alerts are not available in this bot.`
+
+	webhooksMsg = `Webhooks:
+%s
+
+Type <code>/webhook list {id}</code> to see recent deliveries.`
+
+	noWebhooksMsg = `No webhooks yet.
+
+Type <code>/webhook add {url}</code> to get listing events as signed JSON.`
+
+	webhookItemText = `<b>%d</b>. %s
+    last delivery: %s`
+	webhookNeverText = `none yet`
+
+	webhookLogMsg = `Recent deliveries to %s:
+%s`
+	webhookLogItemText = `• %s %s, attempt %d: %s`
+	webhookLogEmptyMsg = `Nothing was delivered to %s yet.`
+
+	webhookAddedMsg = `Added webhook %s with ID <b>%d</b>.
+
+Signing secret, it is not shown again:
+<code>%s</code>
+
+Type <code>/webhook test {id}</code> to send a test event.`
+
+	webhookRemovedMsg = `Removed webhook %s.`
+
+	webhookNotFoundMsg = `Webhook %d is not found, type /webhook to list them.`
+
+	webhookTestMsg = `A test event is queued for %s. Type <code>/webhook list %d</code> to see how it went.`
+
+	webhookLimitMsg = `This shop already has %d webhooks, remove one first.`
+
+	webhookPrivateMsg = `The signing secret of a webhook is shown once, please add webhooks in a private chat with the bot.`
+
+	webhookUsageMsg = `Please submit a command in a form:
+<code>/webhook list</code>
+<code>/webhook list {id}</code>
+<code>/webhook add {https url}</code>
+<code>/webhook remove {id}</code>
+<code>/webhook test {id}</code>
+
+Example:
+<code>/webhook add https://erp.example.com/hooks/etsy</code>`
+
+	neverText       = `never`
+	tokenOKText     = `working`
+	tokenBrokenText = `not working, type /start to log in again`
+
+	listingName = `listing %d`
+	skuName     = `SKU %s`
+
+	onText  = `on`
+	offText = `off`
+
+	openListingText = `Open listing`
+	editListingText = `Edit in Shop Manager`
+
+	snoozeListingText = `Snooze this listing`
+	muteSKUText       = `Mute SKU`
+	markRestockedText = `Mark restocked`
+
+	// Values are escaped, Telegram expects HTML.
+	alertsTmpl = `
+{{- define "sku" }}{{ if .SKUs }}
+SKU: <code>{{ join .SKUs ", " | html }}</code>{{ end }}{{ end }}
+
+{{- define "sold_out" -}}
+<b>Sold out:</b> {{ html .Title }}
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+Sold out at {{ .Time.Format "2 Jan 2006 15:04 MST" }}
+{{- end }}
+
+{{- define "low_stock" -}}
+<b>Low stock:</b> {{ html .Title }}
+Only <b>{{ .Quantity }}</b> left
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "restocked" -}}
+<b>Back in stock:</b> {{ html .Title }}
+Quantity: <b>{{ .Quantity }}</b>
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "expired" -}}
+<b>Listing expired:</b> {{ html .Title }}
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "removed" -}}
+<b>Listing removed:</b> {{ html .Title }}
+Shop: {{ html .ShopName }}
+{{- end }}
 `
 )
@@ -0,0 +1,434 @@
+package lowstock
+
+var deBundle = bundle{
+	name: "Deutsch",
+
+	help: `Unterstützte Befehle:
+
+/start	- Bei deinem Etsy-Shop anmelden
+/pin	- Anmelde-PIN senden
+/threshold	- Mindestbestand anzeigen oder festlegen
+/watch	- Mindestbestand für ein Angebot oder eine SKU festlegen
+/unwatch	- Mindestbestand für ein Angebot oder eine SKU entfernen
+/watches	- Mindestbestände für Angebote und SKUs anzeigen
+/notify	- Benachrichtigungen über Statusänderungen ein- oder ausschalten
+/template	- Benachrichtigungsvorlage anzeigen, festlegen oder zurücksetzen
+/language	- Sprache des Bots ändern
+/stop	- Benachrichtigungen pausieren
+/resume	- Benachrichtigungen fortsetzen
+/logout	- Shop trennen und deine Daten löschen
+/shops	- Mit diesem Chat verbundene Shops anzeigen und wechseln
+/status	- Status des verbundenen Shops anzeigen
+/stock	- Angebote mit niedrigem Bestand und ausverkaufte Angebote anzeigen
+/digest	- Tägliche und wöchentliche Zusammenfassung anzeigen oder festlegen
+/quiet	- Ruhezeiten anzeigen oder festlegen
+/snooze	- Benachrichtigungen eine Weile zurückhalten
+/mute	- Stummgeschaltete Angebote anzeigen oder ein Angebot oder eine SKU stummschalten
+/unmute	- Stummschaltung eines Angebots oder einer SKU aufheben
+/restocked	- Angebot als wieder aufgefüllt markieren
+/email	- E-Mail-Adresse für Benachrichtigungen anzeigen oder festlegen
+/webhook	- Webhooks anzeigen, hinzufügen, entfernen oder testen
+/help	- Diese Nachricht senden`,
+
+	start: `<b>Willkommen bei Lowstock!</b>
+
+Dieser Bot behält deine Etsy-Angebote im Blick und benachrichtigt dich, wenn ein Angebot ausverkauft ist.
+Bevor du Benachrichtigungen erhältst, musst du dich anmelden.
+Diese Anwendung fordert Lesezugriff auf deine Shop-Informationen und deine Angebote an.
+Die App speichert nur die für Benachrichtigungen nötigen Daten: deine Etsy-Benutzer-ID und dein Zugriffstoken, Angebotsstände und Benachrichtigungen.
+Wenn du sie einrichtest, speichert sie auch deine E-Mail-Adresse, Webhook-URLs und deren Secrets.
+Mit /logout kannst du all das jederzeit löschen.
+
+Nachdem du dich bei Etsy angemeldet und diese App autorisiert hast, erhältst du eine einmalige PIN.
+
+Bitte sende diese PIN in folgender Form an diesen Chat:
+<code>/pin {PIN}</code>
+
+Beispiel:
+<code>/pin 76279961</code>
+
+Mit /help erhältst du die Liste der Befehle, oder lies die <a href="">Online-Dokumentation</a>.
+
+Dieser Bot ist Open Source. Den <a href="https://github.com/cooldarkdryplace/lowstock">Quellcode</a> findest du auf Github.
+
+<i>* Der Begriff „Etsy“ ist eine Marke von Etsy, Inc. Diese Anwendung nutzt die Etsy-API, wird aber nicht von Etsy, Inc. unterstützt oder zertifiziert.</i>`,
+
+	success: `Erfolgreich!
+Du wirst benachrichtigt, wenn Artikel ausverkauft sind.`,
+
+	emptyPin: `Du hast eine leere PIN eingegeben.
+
+Bitte sende die PIN in folgender Form an diesen Chat:
+<code>/pin {PIN}</code>
+
+Beispiel:
+<code>/pin 76279961</code>
+
+Wenn du eine neue PIN brauchst, tippe /start und melde dich erneut an.
+`,
+
+	notLinked: `Mit diesem Chat ist kein Etsy-Shop verbunden.
+
+Tippe /start, um dich anzumelden.`,
+
+	threshold: `Mindestbestand: <b>%d</b>.
+
+Du wirst benachrichtigt, wenn ein aktives Angebot diese Menge oder weniger hat. Null schaltet Benachrichtigungen über niedrigen Bestand aus.`,
+
+	thresholdUsage: `Bitte sende den Mindestbestand in folgender Form:
+<code>/threshold {Menge}</code>
+
+Beispiel:
+<code>/threshold 3</code>`,
+
+	watch: `Mindestbestand für %s: <b>%d</b>.`,
+
+	unwatch: `Mindestbestand für %s ist entfernt, es gilt der Standardwert.`,
+
+	watchNotFound: `Für %s ist kein Mindestbestand festgelegt.`,
+
+	watchUsage: `Bitte sende eine Angebots-ID oder SKU und einen Mindestbestand in folgender Form:
+<code>/watch {Angebots-ID oder SKU} {Menge}</code>
+<code>/unwatch {Angebots-ID oder SKU}</code>
+Zahlen gelten als Angebots-IDs, für SKUs aus Ziffern nutze <code>sku:1001</code>.
+
+Beispiel:
+<code>/watch 771234567 10</code>
+<code>/watch MUG-RED-01 0</code>`,
+
+	watches: `Standard-Mindestbestand: <b>%d</b>.
+%s`,
+
+	noWatches: `Es gibt keine Mindestbestände für Angebote oder SKUs.`,
+
+	listingName: `Angebot %d`,
+	skuName:     `SKU %s`,
+
+	notify: `Benachrichtigungen über ausverkaufte Artikel und niedrigen Bestand sind immer an.
+
+Wieder vorrätig: <b>%s</b>
+Abgelaufen: <b>%s</b>
+Entfernt: <b>%s</b>`,
+
+	notifyUsage: `Bitte sende die Benachrichtigung und on oder off in folgender Form:
+<code>/notify {restocked|expired|removed} {on|off}</code>
+
+Beispiel:
+<code>/notify restocked on</code>`,
+
+	on:  `an`,
+	off: `aus`,
+
+	template: `Deine Benachrichtigungsvorlage:
+
+<pre>%s</pre>
+
+Tippe <code>/template reset</code>, um die eingebaute Vorlage zu verwenden.`,
+
+	templateDefault: `Du verwendest die eingebaute Benachrichtigungsvorlage.
+
+Tippe <code>/template set {Vorlage}</code>, um eine eigene zu schreiben.`,
+
+	templateSaved: `Benachrichtigungsvorlage ist gespeichert.`,
+
+	templateReset: `Benachrichtigungsvorlage ist zurückgesetzt, die eingebaute wird verwendet.`,
+
+	templateError: `Vorlage ist nicht gespeichert: <code>%s</code>`,
+
+	templateUsage: `Die Vorlage verwendet Go-text/template-Syntax, das Ergebnis ist HTML:
+<code>/template set {Vorlage}</code>
+<code>/template reset</code>
+
+Felder: <code>.Kind</code> (sold_out, low_stock, restocked, expired, removed), <code>.Title</code>, <code>.ShopName</code>, <code>.ListingID</code>, <code>.Quantity</code>, <code>.SKUs</code>, <code>.ListingURL</code>, <code>.EditURL</code>, <code>.Time</code>.
+Funktionen: <code>html</code> maskiert einen Wert, <code>join</code> verbindet SKUs.
+
+Beispiel:
+<code>/template set {{if eq .Kind "sold_out"}}Ausverkauft{{else}}{{.Kind}}{{end}}: {{html .Title}} ({{join .SKUs ", " | html}})</code>`,
+
+	language: `Sprache: <b>%s</b>.
+
+Verfügbar: %s
+Tippe <code>/language {Code}</code>, um sie zu ändern, z. B. <code>/language en</code>.`,
+
+	languageUsage: `Diese Sprache wird nicht unterstützt.
+
+Verfügbar: %s`,
+
+	stop: `Benachrichtigungen sind pausiert.
+
+Tippe /resume, um sie wieder einzuschalten, oder /logout, um deinen Shop zu trennen und deine Daten zu löschen.`,
+
+	resume: `Benachrichtigungen sind an.`,
+
+	logout: `Dein Shop ist getrennt, deine Etsy-Benutzer-ID, dein Zugriffstoken und deine Einstellungen sind gelöscht.
+
+Um den Zugriff dieser App bei Etsy zu widerrufen, entferne sie unter <a href="https://www.etsy.com/your/account/apps">Verbundene Apps</a>.
+Tippe /start, um dich erneut anzumelden.`,
+
+	logoutChat: `Der Shop ist von diesem Chat getrennt.
+
+Er ist noch mit anderen Chats verbunden, seine Einstellungen bleiben erhalten, bis er von allen getrennt ist.`,
+
+	adminOnly: `Das dürfen nur Gruppenadmins und das Mitglied, das den Shop verbunden hat.`,
+
+	shops: `Mit diesem Chat verbundene Shops, Befehle gelten für den fett gedruckten:
+%s
+
+Tippe <code>/shops {Nummer}</code>, um zu wechseln, oder /start, um einen weiteren Shop zu verbinden.`,
+
+	shopsUsage: `Bitte sende eine Shop-Nummer aus der /shops-Liste in folgender Form:
+<code>/shops {Nummer}</code>
+
+Beispiel:
+<code>/shops 2</code>`,
+
+	unnamedShop: `Etsy-Benutzer %d`,
+
+	status: `<b>Shop:</b> %s
+<b>Letzte Feed-Abfrage:</b> %s
+<b>Aktualisierungen in den letzten 24 Stunden:</b> %d
+<b>Mindestbestand:</b> %d
+<b>Mindestbestände für Angebote und SKUs:</b> %d
+<b>Benachrichtigungen:</b> %s
+<b>Etsy-Zugriff:</b> %s`,
+
+	stock: `Angebote mit niedrigem Bestand und ausverkaufte Angebote in <b>%s</b>, Seite %d von %d:`,
+
+	stockEmpty: `In <b>%s</b> ist nichts knapp oder ausverkauft.`,
+
+	stockUsage: `Bitte sende eine Seitennummer in folgender Form:
+<code>/stock {Seite}</code>
+
+Beispiel:
+<code>/stock 2</code>`,
+
+	stockSoldOut: `• <a href="%s">%s</a> — ausverkauft`,
+	stockLow:     `• <a href="%s">%s</a> — noch <b>%d</b>`,
+
+	digest: `Zusammenfassung: <b>%s</b> um <b>%s</b> (%s).
+Sofortige Benachrichtigungen: <b>%s</b>
+
+Tippe <code>/digest off</code>, um Zusammenfassungen auszuschalten.`,
+
+	digestOff: `Zusammenfassungen sind aus.
+
+Tippe <code>/digest daily 08:00 Europe/Berlin</code>, um jeden Morgen eine zu erhalten.`,
+
+	digestUsage: `Bitte sende den Zeitplan der Zusammenfassung in folgender Form:
+<code>/digest {daily|weekly} {HH:MM} {Zeitzone}</code>
+<code>/digest off</code>
+
+Wöchentliche Zusammenfassungen kommen montags. Mit <code>only</code> erhältst du Zusammenfassungen statt sofortiger Benachrichtigungen.
+
+Beispiel:
+<code>/digest daily 08:00 Europe/Berlin</code>
+<code>/digest weekly 09:30 America/New_York only</code>`,
+
+	digestDaily:  `täglich`,
+	digestWeekly: `wöchentlich am Montag`,
+
+	digestTitle: `<b>Zusammenfassung für %s</b>`,
+
+	digestSoldOut:  `Ausverkauft:`,
+	digestBack:     `Wieder vorrätig:`,
+	digestLowStock: `Unter dem Mindestbestand:`,
+
+	digestItem:     `• <a href="%s">%s</a>`,
+	digestBackItem: `• <a href="%s">%s</a> — <b>%d</b> vorrätig`,
+
+	digestEmpty: `Nichts ist ausverkauft, wieder vorrätig oder unter den Mindestbestand gefallen.`,
+
+	quiet: `Ruhezeiten: <b>%s–%s</b> (%s), Benachrichtigungen werden <b>%s</b>.
+
+Tippe <code>/quiet off</code>, um Ruhezeiten auszuschalten.`,
+
+	quietOff: `Ruhezeiten sind aus.
+
+Tippe <code>/quiet 22:00 07:00 Europe/Berlin</code>, um Benachrichtigungen nachts zurückzuhalten.`,
+
+	quietUsage: `Bitte sende die Ruhezeiten in folgender Form:
+<code>/quiet {HH:MM} {HH:MM} {Zeitzone}</code>
+<code>/quiet off</code>
+
+Benachrichtigungen werden zurückgehalten und nach den Ruhezeiten in einer Nachricht gesendet. Mit <code>silent</code> kommen sie sofort, aber ohne Ton.
+
+Beispiel:
+<code>/quiet 22:00 07:00 Europe/Berlin</code>
+<code>/quiet 23:30 06:00 silent</code>`,
+
+	quietDefer:  `bis zum Ende der Ruhezeiten zurückgehalten`,
+	quietSilent: `ohne Ton zugestellt`,
+
+	snooze: `Benachrichtigungen sind bis <b>%s</b> stummgeschaltet, danach erhältst du sie in einer Nachricht.
+
+Tippe <code>/snooze off</code>, um sie jetzt zu erhalten.`,
+
+	snoozeOff: `Stummschaltung ist aus.`,
+
+	snoozeUsage: `Bitte sende die Dauer in folgender Form:
+<code>/snooze {Dauer}</code>
+<code>/snooze off</code>
+
+Beispiel:
+<code>/snooze 30m</code>
+<code>/snooze 2h</code>
+<code>/snooze 1d</code>`,
+
+	deferred: `<b>Zurückgehaltene Benachrichtigungen: %d</b>`,
+
+	mute: `Benachrichtigungen für %s sind stummgeschaltet.`,
+
+	muteUntil: `Benachrichtigungen für %s sind bis <b>%s</b> stummgeschaltet.`,
+
+	unmute: `Benachrichtigungen für %s sind wieder an.`,
+
+	muteNotFound: `%s ist nicht stummgeschaltet.`,
+
+	muteUsage: `Bitte sende eine Angebots-ID oder SKU und optional eine Dauer in folgender Form:
+<code>/mute {Angebots-ID oder SKU} {Dauer}</code>
+<code>/unmute {Angebots-ID oder SKU}</code>
+Zahlen gelten als Angebots-IDs, für SKUs aus Ziffern nutze <code>sku:1001</code>.
+
+Beispiel:
+<code>/mute 771234567 1d</code>
+<code>/mute MUG-RED-01</code>`,
+
+	mutes: `Stummgeschaltete Benachrichtigungen:
+%s`,
+
+	noMutes: `Nichts ist stummgeschaltet.`,
+
+	muteItem:      `• %s`,
+	muteItemUntil: `• %s bis <b>%s</b>`,
+
+	restocked: `%s ist als wieder aufgefüllt markiert, beim nächsten Unterschreiten des Mindestbestands kommt wieder eine Benachrichtigung.`,
+
+	restockedUsage: `Bitte sende eine Angebots-ID in folgender Form:
+<code>/restocked {Angebots-ID}</code>`,
+
+	listingNotFound: `Angebot %d ist in diesem Shop nicht bekannt.`,
+
+	email: `Benachrichtigungen gehen per E-Mail an <b>%s</b>.
+
+Tippe <code>/email off</code>, um das zu beenden.`,
+
+	emailUnset: `Benachrichtigungen werden nicht per E-Mail verschickt.
+
+Tippe <code>/email {Adresse}</code>, um sie zusätzlich per E-Mail zu erhalten.`,
+
+	emailUsage: `Bitte sende eine E-Mail-Adresse oder den Bestätigungscode in folgender Form:
+<code>/email {Adresse}</code>
+<code>/email verify {Code}</code>
+<code>/email off</code>
+
+Beispiel:
+<code>/email books@example.com</code>
+<code>/email verify 123456</code>`,
+
+	emailCode: `Lowstock-Bestätigungscode: %[1]s
+
+Sende <code>/email verify %[1]s</code> innerhalb einer Stunde an den Bot, um Benachrichtigungen an diese Adresse zu erhalten.
+Wenn du ihn nicht angefordert hast, ignoriere diese E-Mail.`,
+
+	emailCodeSent: `Ein Bestätigungscode wurde an <b>%s</b> gesendet. Sende ihn innerhalb einer Stunde in folgender Form:
+<code>/email verify {Code}</code>`,
+
+	emailVerified: `Fertig! Benachrichtigungen gehen per E-Mail an <b>%s</b>.`,
+
+	emailBadCode: `Der Code ist falsch oder abgelaufen. Tippe <code>/email {Adresse}</code>, um einen neuen zu erhalten.`,
+
+	emailFailed: `Die E-Mail an <b>%s</b> konnte nicht gesendet werden, bitte prüfe die Adresse.`,
+
+	emailOff: `Benachrichtigungen werden nicht mehr per E-Mail verschickt.`,
+
+	emailDisabled: `E-Mail-Benachrichtigungen sind in diesem Bot nicht verfügbar.`,
+
+	webhooks: `Webhooks:
+%s
+
+Tippe <code>/webhook list {ID}</code>, um die letzten Zustellungen zu sehen.`,
+
+	noWebhooks: `Noch keine Webhooks.
+
+Tippe <code>/webhook add {URL}</code>, um Angebotsereignisse als signiertes JSON zu erhalten.`,
+
+	webhookItem: `<b>%d</b>. %s
+    letzte Zustellung: %s`,
+	webhookNever: `noch keine`,
+
+	webhookLog: `Letzte Zustellungen an %s:
+%s`,
+	webhookLogItem:  `• %s %s, Versuch %d: %s`,
+	webhookLogEmpty: `An %s wurde noch nichts zugestellt.`,
+
+	webhookAdded: `Webhook %s mit der ID <b>%d</b> hinzugefügt.
+
+Signaturschlüssel, er wird nicht erneut angezeigt:
+<code>%s</code>
+
+Tippe <code>/webhook test {ID}</code>, um ein Testereignis zu senden.`,
+
+	webhookRemoved: `Webhook %s entfernt.`,
+
+	webhookNotFound: `Webhook %d wurde nicht gefunden, tippe /webhook, um alle anzuzeigen.`,
+
+	webhookTest: `Ein Testereignis für %s ist eingereiht. Tippe <code>/webhook list %d</code>, um das Ergebnis zu sehen.`,
+
+	webhookLimit: `Dieser Shop hat bereits %d Webhooks, entferne zuerst einen.`,
+
+	webhookPrivate: `Das Signaturgeheimnis eines Webhooks wird nur einmal angezeigt, bitte füge Webhooks in einem privaten Chat mit dem Bot hinzu.`,
+
+	webhookUsage: `Bitte sende einen Befehl in folgender Form:
+<code>/webhook list</code>
+<code>/webhook list {ID}</code>
+<code>/webhook add {https-URL}</code>
+<code>/webhook remove {ID}</code>
+<code>/webhook test {ID}</code>
+
+Beispiel:
+<code>/webhook add https://erp.example.com/hooks/etsy</code>`,
+
+	never:       `nie`,
+	tokenOK:     `funktioniert`,
+	tokenBroken: `funktioniert nicht, tippe /start, um dich erneut anzumelden`,
+
+	openListing: `Angebot öffnen`,
+	editListing: `Im Shop-Manager bearbeiten`,
+
+	snoozeListing: `Angebot pausieren`,
+	muteSKU:       `SKU stummschalten`,
+	markRestocked: `Als aufgefüllt markieren`,
+
+	alerts: `
+{{- define "sku" }}{{ if .SKUs }}
+SKU: <code>{{ join .SKUs ", " | html }}</code>{{ end }}{{ end }}
+
+{{- define "sold_out" -}}
+<b>Ausverkauft:</b> {{ html .Title }}
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+Ausverkauft am {{ .Time.Format "02.01.2006 15:04 MST" }}
+{{- end }}
+
+{{- define "low_stock" -}}
+<b>Niedriger Bestand:</b> {{ html .Title }}
+Nur noch <b>{{ .Quantity }}</b> übrig
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "restocked" -}}
+<b>Wieder vorrätig:</b> {{ html .Title }}
+Menge: <b>{{ .Quantity }}</b>
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "expired" -}}
+<b>Angebot abgelaufen:</b> {{ html .Title }}
+Shop: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "removed" -}}
+<b>Angebot entfernt:</b> {{ html .Title }}
+Shop: {{ html .ShopName }}
+{{- end }}
+`,
+}
@@ -0,0 +1,434 @@
+package lowstock
+
+var ukBundle = bundle{
+	name: "Українська",
+
+	help: `Підтримувані команди:
+
+/start	- Увійти до свого магазину Etsy
+/pin	- Надіслати PIN для входу
+/threshold	- Показати або встановити мінімальний залишок
+/watch	- Встановити мінімальний залишок для товару або SKU
+/unwatch	- Видалити мінімальний залишок для товару або SKU
+/watches	- Показати мінімальні залишки для товарів і SKU
+/notify	- Увімкнути або вимкнути сповіщення про зміну стану
+/template	- Показати, встановити або скинути шаблон сповіщень
+/language	- Змінити мову бота
+/stop	- Призупинити сповіщення
+/resume	- Відновити сповіщення
+/logout	- Відключити магазин і видалити ваші дані
+/shops	- Показати й перемкнути магазини, підключені до цього чату
+/status	- Показати стан підключеного магазину
+/stock	- Показати товари з низьким залишком і розпродані
+/digest	- Показати або налаштувати щоденне й щотижневе зведення
+/quiet	- Показати або налаштувати тихі години
+/snooze	- Відкласти сповіщення на деякий час
+/mute	- Показати або вимкнути сповіщення для товару чи SKU
+/unmute	- Увімкнути сповіщення для товару чи SKU
+/restocked	- Позначити товар поповненим
+/email	- Показати або змінити адресу для сповіщень електронною поштою
+/webhook	- Показати, додати, видалити або перевірити вебхуки
+/help	- Надіслати це повідомлення`,
+
+	start: `<b>Ласкаво просимо до Lowstock!</b>
+
+Цей бот стежить за вашими товарами на Etsy і повідомляє, коли товар розпродано.
+Щоб отримувати сповіщення, потрібно увійти.
+Застосунок запитає доступ лише для читання до інформації про ваш магазин і товари.
+Застосунок зберігає мінімум даних, потрібних для сповіщень: ваш ідентифікатор користувача Etsy, токен доступу, стан товарів і сповіщення.
+Якщо ви їх налаштуєте, він також зберігає вашу адресу email, URL вебхуків та їхні секрети.
+Наберіть /logout будь-коли, щоб видалити все це.
+
+Після входу в обліковий запис Etsy і авторизації застосунку ви отримаєте одноразовий PIN.
+
+Надішліть цей PIN у цей чат у формі:
+<code>/pin {PIN}</code>
+
+Приклад:
+<code>/pin 76279961</code>
+
+Наберіть /help, щоб отримати список команд, або перегляньте <a href="">онлайн-документацію</a>.
+
+Цей бот має відкритий код. <a href="https://github.com/cooldarkdryplace/lowstock">Вихідний код</a> доступний на Github.
+
+<i>* Термін «Etsy» є торговою маркою Etsy, Inc. Цей застосунок використовує Etsy API, але не схвалений і не сертифікований Etsy, Inc.</i>`,
+
+	success: `Готово!
+Ви отримаєте сповіщення, коли товари буде розпродано.`,
+
+	emptyPin: `Ви ввели порожній PIN.
+
+Надішліть PIN у цей чат у формі:
+<code>/pin {PIN}</code>
+
+Приклад:
+<code>/pin 76279961</code>
+
+Якщо потрібен новий PIN, наберіть /start і увійдіть ще раз.
+`,
+
+	notLinked: `До цього чату не підключено магазин Etsy.
+
+Наберіть /start, щоб увійти.`,
+
+	threshold: `Мінімальний залишок: <b>%d</b>.
+
+Ви отримаєте сповіщення, коли в активного товару залишиться стільки одиниць або менше. Нуль вимикає сповіщення про низький залишок.`,
+
+	thresholdUsage: `Надішліть мінімальний залишок у формі:
+<code>/threshold {кількість}</code>
+
+Приклад:
+<code>/threshold 3</code>`,
+
+	watch: `Мінімальний залишок для %s: <b>%d</b>.`,
+
+	unwatch: `Мінімальний залишок для %s видалено, діє стандартний.`,
+
+	watchNotFound: `Для %s мінімальний залишок не встановлено.`,
+
+	watchUsage: `Надішліть ID товару або SKU і мінімальний залишок у формі:
+<code>/watch {ID товару або SKU} {кількість}</code>
+<code>/unwatch {ID товару або SKU}</code>
+Числа вважаються ID товарів, для SKU з цифр використовуйте <code>sku:1001</code>.
+
+Приклад:
+<code>/watch 771234567 10</code>
+<code>/watch MUG-RED-01 0</code>`,
+
+	watches: `Стандартний мінімальний залишок: <b>%d</b>.
+%s`,
+
+	noWatches: `Мінімальних залишків для товарів чи SKU немає.`,
+
+	listingName: `товару %d`,
+	skuName:     `SKU %s`,
+
+	notify: `Сповіщення про розпродані товари та низький залишок увімкнені завжди.
+
+Знову в наявності: <b>%s</b>
+Термін дії минув: <b>%s</b>
+Видалено: <b>%s</b>`,
+
+	notifyUsage: `Надішліть тип сповіщення та on або off у формі:
+<code>/notify {restocked|expired|removed} {on|off}</code>
+
+Приклад:
+<code>/notify restocked on</code>`,
+
+	on:  `увімк.`,
+	off: `вимк.`,
+
+	template: `Ваш шаблон сповіщень:
+
+<pre>%s</pre>
+
+Наберіть <code>/template reset</code>, щоб використовувати вбудований.`,
+
+	templateDefault: `Ви використовуєте вбудований шаблон сповіщень.
+
+Наберіть <code>/template set {шаблон}</code>, щоб написати власний.`,
+
+	templateSaved: `Шаблон сповіщень збережено.`,
+
+	templateReset: `Шаблон сповіщень скинуто, використовується вбудований.`,
+
+	templateError: `Шаблон не збережено: <code>%s</code>`,
+
+	templateUsage: `Шаблон використовує синтаксис Go text/template, результат — HTML:
+<code>/template set {шаблон}</code>
+<code>/template reset</code>
+
+Поля: <code>.Kind</code> (sold_out, low_stock, restocked, expired, removed), <code>.Title</code>, <code>.ShopName</code>, <code>.ListingID</code>, <code>.Quantity</code>, <code>.SKUs</code>, <code>.ListingURL</code>, <code>.EditURL</code>, <code>.Time</code>.
+Функції: <code>html</code> екранує значення, <code>join</code> об'єднує SKU.
+
+Приклад:
+<code>/template set {{if eq .Kind "sold_out"}}Розпродано{{else}}{{.Kind}}{{end}}: {{html .Title}} ({{join .SKUs ", " | html}})</code>`,
+
+	language: `Мова: <b>%s</b>.
+
+Доступні: %s
+Наберіть <code>/language {код}</code>, щоб змінити її, наприклад <code>/language en</code>.`,
+
+	languageUsage: `Ця мова не підтримується.
+
+Доступні: %s`,
+
+	stop: `Сповіщення призупинено.
+
+Наберіть /resume, щоб увімкнути їх знову, або /logout, щоб відключити магазин і видалити ваші дані.`,
+
+	resume: `Сповіщення увімкнено.`,
+
+	logout: `Магазин відключено, ваш ідентифікатор користувача Etsy, токен доступу та налаштування видалено.
+
+Щоб відкликати доступ цього застосунку на боці Etsy, видаліть його в розділі <a href="https://www.etsy.com/your/account/apps">Підключені застосунки</a>.
+Наберіть /start, щоб увійти знову.`,
+
+	logoutChat: `Магазин відключено від цього чату.
+
+Він ще підключений до інших чатів, тому його налаштування збережено, доки його не відключать від усіх.`,
+
+	adminOnly: `Це можуть робити лише адміністратори групи та учасник, який підключив магазин.`,
+
+	shops: `Магазини, підключені до цього чату, команди застосовуються до виділеного жирним:
+%s
+
+Наберіть <code>/shops {номер}</code>, щоб перемкнути, або /start, щоб підключити ще один магазин.`,
+
+	shopsUsage: `Надішліть номер магазину зі списку /shops у формі:
+<code>/shops {номер}</code>
+
+Приклад:
+<code>/shops 2</code>`,
+
+	unnamedShop: `Користувач Etsy %d`,
+
+	status: `<b>Магазин:</b> %s
+<b>Останнє опитування стрічки:</b> %s
+<b>Оновлень за останні 24 години:</b> %d
+<b>Мінімальний залишок:</b> %d
+<b>Мінімальних залишків для товарів і SKU:</b> %d
+<b>Сповіщення:</b> %s
+<b>Доступ до Etsy:</b> %s`,
+
+	stock: `Товари з низьким залишком і розпродані в <b>%s</b>, сторінка %d з %d:`,
+
+	stockEmpty: `У <b>%s</b> немає товарів із низьким залишком чи розпроданих.`,
+
+	stockUsage: `Надішліть номер сторінки у формі:
+<code>/stock {сторінка}</code>
+
+Приклад:
+<code>/stock 2</code>`,
+
+	stockSoldOut: `• <a href="%s">%s</a> — розпродано`,
+	stockLow:     `• <a href="%s">%s</a> — залишилось <b>%d</b>`,
+
+	digest: `Зведення: <b>%s</b> о <b>%s</b> (%s).
+Миттєві сповіщення: <b>%s</b>
+
+Наберіть <code>/digest off</code>, щоб вимкнути зведення.`,
+
+	digestOff: `Зведення вимкнено.
+
+Наберіть <code>/digest daily 08:00 Europe/Kyiv</code>, щоб отримувати його щоранку.`,
+
+	digestUsage: `Надішліть розклад зведення у формі:
+<code>/digest {daily|weekly} {ГГ:ХХ} {часовий пояс}</code>
+<code>/digest off</code>
+
+Щотижневе зведення надходить у понеділок. Додайте <code>only</code>, щоб отримувати зведення замість миттєвих сповіщень.
+
+Приклад:
+<code>/digest daily 08:00 Europe/Kyiv</code>
+<code>/digest weekly 09:30 America/New_York only</code>`,
+
+	digestDaily:  `щодня`,
+	digestWeekly: `щотижня в понеділок`,
+
+	digestTitle: `<b>Зведення для %s</b>`,
+
+	digestSoldOut:  `Розпродано:`,
+	digestBack:     `Знову в наявності:`,
+	digestLowStock: `Нижче мінімального залишку:`,
+
+	digestItem:     `• <a href="%s">%s</a>`,
+	digestBackItem: `• <a href="%s">%s</a> — <b>%d</b> в наявності`,
+
+	digestEmpty: `Нічого не розпродано, не повернулося в наявність і не опустилося нижче мінімального залишку.`,
+
+	quiet: `Тихі години: <b>%s–%s</b> (%s), сповіщення <b>%s</b>.
+
+Наберіть <code>/quiet off</code>, щоб вимкнути тихі години.`,
+
+	quietOff: `Тихі години вимкнено.
+
+Наберіть <code>/quiet 22:00 07:00 Europe/Kyiv</code>, щоб відкладати сповіщення на ніч.`,
+
+	quietUsage: `Надішліть тихі години у формі:
+<code>/quiet {ГГ:ХХ} {ГГ:ХХ} {часовий пояс}</code>
+<code>/quiet off</code>
+
+Сповіщення відкладаються й надходять одним повідомленням, коли тихі години закінчуються. Додайте <code>silent</code>, щоб отримувати їх одразу, але без звуку.
+
+Приклад:
+<code>/quiet 22:00 07:00 Europe/Kyiv</code>
+<code>/quiet 23:30 06:00 silent</code>`,
+
+	quietDefer:  `відкладаються до кінця тихих годин`,
+	quietSilent: `надходять без звуку`,
+
+	snooze: `Сповіщення відкладено до <b>%s</b>, тоді ви отримаєте їх одним повідомленням.
+
+Наберіть <code>/snooze off</code>, щоб отримати їх зараз.`,
+
+	snoozeOff: `Відкладення вимкнено.`,
+
+	snoozeUsage: `Надішліть тривалість у формі:
+<code>/snooze {тривалість}</code>
+<code>/snooze off</code>
+
+Приклад:
+<code>/snooze 30m</code>
+<code>/snooze 2h</code>
+<code>/snooze 1d</code>`,
+
+	deferred: `<b>Відкладені сповіщення: %d</b>`,
+
+	mute: `Сповіщення для %s вимкнено.`,
+
+	muteUntil: `Сповіщення для %s вимкнено до <b>%s</b>.`,
+
+	unmute: `Сповіщення для %s знову увімкнено.`,
+
+	muteNotFound: `Сповіщення для %s не вимкнені.`,
+
+	muteUsage: `Надішліть ID товару або SKU і, за бажанням, тривалість у формі:
+<code>/mute {ID товару або SKU} {тривалість}</code>
+<code>/unmute {ID товару або SKU}</code>
+Числа вважаються ID товарів, для SKU з цифр використовуйте <code>sku:1001</code>.
+
+Приклад:
+<code>/mute 771234567 1d</code>
+<code>/mute MUG-RED-01</code>`,
+
+	mutes: `Вимкнені сповіщення:
+%s`,
+
+	noMutes: `Нічого не вимкнено.`,
+
+	muteItem:      `• для %s`,
+	muteItemUntil: `• для %s до <b>%s</b>`,
+
+	restocked: `Залишок %s позначено як поповнений, наступне падіння нижче порогу знову надішле сповіщення.`,
+
+	restockedUsage: `Надішліть ID товару у формі:
+<code>/restocked {ID товару}</code>`,
+
+	listingNotFound: `Товар %d у цьому магазині невідомий.`,
+
+	email: `Сповіщення надсилаються на <b>%s</b>.
+
+Надішліть <code>/email off</code>, щоб вимкнути.`,
+
+	emailUnset: `Сповіщення не надсилаються електронною поштою.
+
+Надішліть <code>/email {адреса}</code>, щоб отримувати їх також поштою.`,
+
+	emailUsage: `Будь ласка, надішліть адресу електронної пошти або код підтвердження у формі:
+<code>/email {адреса}</code>
+<code>/email verify {код}</code>
+<code>/email off</code>
+
+Приклад:
+<code>/email books@example.com</code>
+<code>/email verify 123456</code>`,
+
+	emailCode: `Код підтвердження Lowstock: %[1]s
+
+Надішліть боту <code>/email verify %[1]s</code> протягом години, щоб отримувати сповіщення на цю адресу.
+Якщо ви його не запитували, проігноруйте цей лист.`,
+
+	emailCodeSent: `Код підтвердження надіслано на <b>%s</b>. Надішліть його протягом години у формі:
+<code>/email verify {код}</code>`,
+
+	emailVerified: `Готово! Сповіщення надсилаються на <b>%s</b>.`,
+
+	emailBadCode: `Код неправильний або застарів. Надішліть <code>/email {адреса}</code>, щоб отримати новий.`,
+
+	emailFailed: `Не вдалося надіслати лист на <b>%s</b>, перевірте адресу.`,
+
+	emailOff: `Сповіщення більше не надсилаються електронною поштою.`,
+
+	emailDisabled: `Сповіщення електронною поштою недоступні в цьому боті.`,
+
+	webhooks: `Вебхуки:
+%s
+
+Надішліть <code>/webhook list {id}</code>, щоб побачити останні доставки.`,
+
+	noWebhooks: `Вебхуків ще немає.
+
+Надішліть <code>/webhook add {url}</code>, щоб отримувати події товарів як підписаний JSON.`,
+
+	webhookItem: `<b>%d</b>. %s
+    остання доставка: %s`,
+	webhookNever: `ще не було`,
+
+	webhookLog: `Останні доставки на %s:
+%s`,
+	webhookLogItem:  `• %s %s, спроба %d: %s`,
+	webhookLogEmpty: `На %s ще нічого не доставлено.`,
+
+	webhookAdded: `Вебхук %s додано з ID <b>%d</b>.
+
+Ключ підпису, він більше не буде показаний:
+<code>%s</code>
+
+Надішліть <code>/webhook test {id}</code>, щоб надіслати тестову подію.`,
+
+	webhookRemoved: `Вебхук %s видалено.`,
+
+	webhookNotFound: `Вебхук %d не знайдено, надішліть /webhook, щоб побачити всі.`,
+
+	webhookTest: `Тестову подію для %s додано в чергу. Надішліть <code>/webhook list %d</code>, щоб побачити результат.`,
+
+	webhookLimit: `Цей магазин уже має %d вебхуків, спершу видаліть один.`,
+
+	webhookPrivate: `Секрет підпису вебхука показується лише один раз, тож додавайте вебхуки в приватному чаті з ботом.`,
+
+	webhookUsage: `Будь ласка, надішліть команду у формі:
+<code>/webhook list</code>
+<code>/webhook list {id}</code>
+<code>/webhook add {https url}</code>
+<code>/webhook remove {id}</code>
+<code>/webhook test {id}</code>
+
+Приклад:
+<code>/webhook add https://erp.example.com/hooks/etsy</code>`,
+
+	never:       `ніколи`,
+	tokenOK:     `працює`,
+	tokenBroken: `не працює, наберіть /start, щоб увійти знову`,
+
+	openListing: `Відкрити товар`,
+	editListing: `Редагувати в Shop Manager`,
+
+	snoozeListing: `Відкласти товар`,
+	muteSKU:       `Вимкнути SKU`,
+	markRestocked: `Позначити поповненим`,
+
+	alerts: `
+{{- define "sku" }}{{ if .SKUs }}
+SKU: <code>{{ join .SKUs ", " | html }}</code>{{ end }}{{ end }}
+
+{{- define "sold_out" -}}
+<b>Розпродано:</b> {{ html .Title }}
+Магазин: {{ html .ShopName }}{{ template "sku" . }}
+Розпродано {{ .Time.Format "02.01.2006 15:04 MST" }}
+{{- end }}
+
+{{- define "low_stock" -}}
+<b>Низький залишок:</b> {{ html .Title }}
+Залишилось лише <b>{{ .Quantity }}</b>
+Магазин: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "restocked" -}}
+<b>Знову в наявності:</b> {{ html .Title }}
+Кількість: <b>{{ .Quantity }}</b>
+Магазин: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "expired" -}}
+<b>Термін дії товару минув:</b> {{ html .Title }}
+Магазин: {{ html .ShopName }}{{ template "sku" . }}
+{{- end }}
+
+{{- define "removed" -}}
+<b>Товар видалено:</b> {{ html .Title }}
+Магазин: {{ html .ShopName }}
+{{- end }}
+`,
+}
@@ -0,0 +1,520 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var baseURL = "https://slack.com/api/"
+
+const (
+	methodPostMessage = "chat.postMessage"
+	methodUpdate      = "chat.update"
+	methodUsersInfo   = "users.info"
+
+	signatureHeader = "X-Slack-Signature"
+	timestampHeader = "X-Slack-Request-Timestamp"
+
+	// Requests signed earlier are rejected as replays.
+	maxRequestAge = 5 * time.Minute
+	// Slash commands and interactions are larger only when something is wrong.
+	maxRequestSize = 1 << 20
+
+	// Wait timeout of Updates, same as Telegram long polling.
+	timeout = 60 * time.Second
+	// Updates waiting for LowStock, requests are rejected once it is full.
+	queueSize = 100
+)
+
+var (
+	msgSuccessCounter = metrics.NewCounter(`slack_api_calls{status="success", method="chat.postMessage"}`)
+	msgFailureCounter = metrics.NewCounter(`slack_api_calls{status="failure", method="chat.postMessage"}`)
+
+	updateSuccessCounter = metrics.NewCounter(`slack_api_calls{status="success", method="chat.update"}`)
+	updateFailureCounter = metrics.NewCounter(`slack_api_calls{status="failure", method="chat.update"}`)
+
+	userSuccessCounter = metrics.NewCounter(`slack_api_calls{status="success", method="users.info"}`)
+	userFailureCounter = metrics.NewCounter(`slack_api_calls{status="failure", method="users.info"}`)
+
+	acceptedCounter = metrics.NewCounter(`slack_requests_total{status="accepted"}`)
+	rejectedCounter = metrics.NewCounter(`slack_requests_total{status="rejected"}`)
+)
+
+// Slack implements lowstock.Messenger with the Web API and an HTTP endpoint for slash commands and buttons.
+// Slack IDs are mapped to int64 chat and user IDs with ChatID.
+type Slack struct {
+	token         string
+	signingSecret string
+
+	updates chan lowstock.MessengerUpdate
+	lastID  int64
+
+	now     func() time.Time
+	timeout time.Duration
+}
+
+// New creates a Slack messenger with the bot token and the signing secret of the app.
+// Requests are verified with the signing secret, it must not be empty.
+func New(token, signingSecret string) (*Slack, error) {
+	if signingSecret == "" {
+		return nil, errors.New("empty signing secret")
+	}
+
+	return &Slack{
+		token:         token,
+		signingSecret: signingSecret,
+		updates:       make(chan lowstock.MessengerUpdate, queueSize),
+		now:           time.Now,
+		timeout:       timeout,
+	}, nil
+}
+
+// ChatID maps a Slack ID, e.g. "C024BE91L", to an int64 ID.
+// Slack IDs are upper case alphanumeric, read as base 36 numbers they fit into int64.
+func ChatID(id string) (int64, error) {
+	if id == "" || len(id) > 12 || strings.ToUpper(id) != id {
+		return 0, fmt.Errorf("unsupported Slack ID %q", id)
+	}
+
+	n, err := strconv.ParseInt(id, 36, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported Slack ID %q: %w", id, err)
+	}
+
+	return n, nil
+}
+
+// slackID is the Slack ID of a chat or user ID made by ChatID.
+func slackID(id int64) string {
+	return strings.ToUpper(strconv.FormatInt(id, 36))
+}
+
+// messageID maps a message timestamp, e.g. "1503435956.000247", to an int64 ID.
+func messageID(ts string) int64 {
+	parts := strings.SplitN(ts, ".", 2)
+
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	var usec int64
+	if len(parts) == 2 {
+		usec, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+
+	return sec*1000000 + usec
+}
+
+func messageTS(id int64) string {
+	return fmt.Sprintf("%d.%06d", id/1000000, id%1000000)
+}
+
+var (
+	linkTag = regexp.MustCompile(`<a href="([^"]*)">(.*?)</a>`)
+
+	// Slack escapes &, < and > the same way HTML does.
+	htmlTags = strings.NewReplacer(
+		"<b>", "*", "</b>", "*",
+		"<i>", "_", "</i>", "_",
+		"<code>", "`", "</code>", "`",
+		"<pre>", "```", "</pre>", "```",
+		"&#34;", `"`, "&quot;", `"`,
+		"&#39;", "'",
+	)
+)
+
+// mrkdwn converts the HTML subset of lowstock messages to Slack mrkdwn.
+func mrkdwn(text string) string {
+	return htmlTags.Replace(linkTag.ReplaceAllString(text, "<$1|$2>"))
+}
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type Element struct {
+	Type     string `json:"type"`
+	Text     Text   `json:"text"`
+	ActionID string `json:"action_id"`
+	URL      string `json:"url,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+type Block struct {
+	Type     string    `json:"type"`
+	Text     *Text     `json:"text,omitempty"`
+	Elements []Element `json:"elements,omitempty"`
+}
+
+type PostMessageRequest struct {
+	Channel     string  `json:"channel"`
+	TS          string  `json:"ts,omitempty"`
+	Text        string  `json:"text"`
+	Blocks      []Block `json:"blocks,omitempty"`
+	UnfurlLinks bool    `json:"unfurl_links"`
+}
+
+type Response struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// toBlocks renders the message as a section with a row of buttons per actions block.
+// Buttons without a URL send their data back, see Handler.
+func toBlocks(m lowstock.Message) []Block {
+	blocks := []Block{
+		Block{Type: "section", Text: &Text{Type: "mrkdwn", Text: mrkdwn(m.Text)}},
+	}
+
+	for i, row := range m.Buttons {
+		actions := Block{Type: "actions"}
+		for j, b := range row {
+			actions.Elements = append(actions.Elements, Element{
+				Type:     "button",
+				Text:     Text{Type: "plain_text", Text: b.Text},
+				ActionID: fmt.Sprintf("button-%d-%d", i, j),
+				URL:      b.URL,
+				Value:    b.Data,
+			})
+		}
+		blocks = append(blocks, actions)
+	}
+
+	return blocks
+}
+
+// call sends the request to the Web API method and decodes the response into v.
+func (s *Slack) call(req *http.Request, method string, v interface{}, success, failure *metrics.Counter) error {
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		failure.Inc()
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		failure.Inc()
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		failure.Inc()
+		err := fmt.Errorf("failed to call %s, status: %s, body: %s", method, resp.Status, string(body))
+
+		if retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After")); resp.StatusCode == http.StatusTooManyRequests && retryAfter > 0 {
+			return &lowstock.RetryAfterError{RetryAfter: time.Duration(retryAfter) * time.Second, Err: err}
+		}
+
+		return err
+	}
+
+	var apiResp Response
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		failure.Inc()
+		return fmt.Errorf("failed to unmarshal %s response: %w", method, err)
+	}
+
+	if !apiResp.Ok {
+		failure.Inc()
+		return fmt.Errorf("failed to call %s: %s", method, apiResp.Error)
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			failure.Inc()
+			return fmt.Errorf("failed to unmarshal %s response: %w", method, err)
+		}
+	}
+
+	success.Inc()
+
+	return nil
+}
+
+func (s *Slack) post(method string, request interface{}, success, failure *metrics.Counter) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+method, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	return s.call(req, method, nil, success, failure)
+}
+
+// SendTextMessage to the channel with provided ID.
+func (s *Slack) SendTextMessage(text string, chatID int64) error {
+	return s.SendMessage(lowstock.Message{Text: text}, chatID)
+}
+
+// SendMessage with buttons to the channel. Slack has no silent messages, all are delivered as usual.
+func (s *Slack) SendMessage(m lowstock.Message, chatID int64) error {
+	req := PostMessageRequest{
+		Channel: slackID(chatID),
+		Text:    mrkdwn(m.Text),
+		Blocks:  toBlocks(m),
+	}
+
+	return s.post(methodPostMessage, req, msgSuccessCounter, msgFailureCounter)
+}
+
+// EditMessage replaces text and buttons of a message sent by the bot.
+func (s *Slack) EditMessage(m lowstock.Message, chatID, messageID int64) error {
+	req := PostMessageRequest{
+		Channel: slackID(chatID),
+		TS:      messageTS(messageID),
+		Text:    mrkdwn(m.Text),
+		Blocks:  toBlocks(m),
+	}
+
+	return s.post(methodUpdate, req, updateSuccessCounter, updateFailureCounter)
+}
+
+// AnswerCallback does nothing, button presses are acknowledged by Handler.
+func (s *Slack) AnswerCallback(callbackID string) error {
+	return nil
+}
+
+// SendLoginURL sends the text with a login button.
+func (s *Slack) SendLoginURL(text, uri string, chatID int64) error {
+	msg := lowstock.Message{
+		Text:    text,
+		Buttons: [][]lowstock.Button{[]lowstock.Button{lowstock.Button{Text: "Login to Etsy", URL: uri}}},
+	}
+
+	return s.SendMessage(msg, chatID)
+}
+
+type UserInfoResponse struct {
+	User struct {
+		IsAdmin bool `json:"is_admin"`
+		IsOwner bool `json:"is_owner"`
+	} `json:"user"`
+}
+
+// IsChatAdmin reports whether the user is an admin or owner of the workspace.
+// Slack channels have no admins of their own.
+func (s *Slack) IsChatAdmin(chatID, userID int64) (bool, error) {
+	form := url.Values{"user": {slackID(userID)}}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+methodUsersInfo, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var info UserInfoResponse
+	if err := s.call(req, methodUsersInfo, &info, userSuccessCounter, userFailureCounter); err != nil {
+		return false, err
+	}
+
+	return info.User.IsAdmin || info.User.IsOwner, nil
+}
+
+// Updates returns slash commands and button presses received by Handler.
+// It waits for one as long as Telegram long polling does, lastMsgID is not needed.
+func (s *Slack) Updates(lastMsgID int64) ([]lowstock.MessengerUpdate, error) {
+	var updates []lowstock.MessengerUpdate
+
+	select {
+	case upd := <-s.updates:
+		updates = append(updates, upd)
+	case <-time.After(s.timeout):
+		return nil, nil
+	}
+
+	for {
+		select {
+		case upd := <-s.updates:
+			updates = append(updates, upd)
+		default:
+			return updates, nil
+		}
+	}
+}
+
+// verify checks the request signature made with the signing secret of the app.
+func (s *Slack) verify(header http.Header, body []byte) error {
+	if s.signingSecret == "" {
+		return errors.New("empty signing secret")
+	}
+
+	ts, err := strconv.ParseInt(header.Get(timestampHeader), 10, 64)
+	if err != nil {
+		return errors.New("bad request timestamp")
+	}
+
+	if age := s.now().Sub(time.Unix(ts, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("request is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.signingSecret))
+	fmt.Fprintf(mac, "v0:%d:%s", ts, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(header.Get(signatureHeader))) {
+		return errors.New("bad request signature")
+	}
+
+	return nil
+}
+
+type InteractionPayload struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Container struct {
+		MessageTS string `json:"message_ts"`
+	} `json:"container"`
+	Actions []struct {
+		Value string `json:"value"`
+	} `json:"actions"`
+}
+
+// chatType of the channel, direct messages are private chats and everything else is a group.
+func chatType(channelID string) string {
+	if strings.HasPrefix(channelID, "D") {
+		return "private"
+	}
+
+	return "group"
+}
+
+// toMessengerUpdate reads a slash command or a button press, ok is false for requests that carry no command.
+func toMessengerUpdate(form url.Values) (lowstock.MessengerUpdate, bool, error) {
+	var (
+		upd                lowstock.MessengerUpdate
+		channelID, userID  string
+		text, ts, callback string
+	)
+
+	if payload := form.Get("payload"); payload != "" {
+		var p InteractionPayload
+		if err := json.Unmarshal([]byte(payload), &p); err != nil {
+			return upd, false, fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+
+		// URL buttons are reported as well.
+		if p.Type != "block_actions" || len(p.Actions) == 0 || !strings.HasPrefix(p.Actions[0].Value, "/") {
+			return upd, false, nil
+		}
+
+		channelID, userID = p.Channel.ID, p.User.ID
+		text, ts, callback = p.Actions[0].Value, p.Container.MessageTS, p.Container.MessageTS
+	} else {
+		if form.Get("command") == "" {
+			return upd, false, errors.New("not a slash command")
+		}
+
+		channelID, userID = form.Get("channel_id"), form.Get("user_id")
+		text = strings.TrimSpace(form.Get("command") + " " + form.Get("text"))
+	}
+
+	chatID, err := ChatID(channelID)
+	if err != nil {
+		return upd, false, err
+	}
+
+	uid, err := ChatID(userID)
+	if err != nil {
+		return upd, false, err
+	}
+
+	upd = lowstock.MessengerUpdate{
+		Command:    strings.Fields(text)[0],
+		Text:       text,
+		ChatID:     chatID,
+		UserID:     uid,
+		ChatType:   chatType(channelID),
+		CallbackID: callback,
+	}
+	if ts != "" {
+		upd.MessageID = messageID(ts)
+	}
+
+	return upd, true, nil
+}
+
+// Handler accepts slash commands and button presses signed by Slack and queues them for Updates.
+// Requests are acknowledged right away, Slack expects an answer within 3 seconds.
+func (s *Slack) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rejectedCounter.Inc()
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.verify(r.Header, body); err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, "failed to parse request", http.StatusBadRequest)
+			return
+		}
+
+		upd, ok, err := toMessengerUpdate(form)
+		if err != nil {
+			rejectedCounter.Inc()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		upd.ID = atomic.AddInt64(&s.lastID, 1)
+
+		select {
+		case s.updates <- upd:
+			acceptedCounter.Inc()
+			w.WriteHeader(http.StatusOK)
+		default:
+			rejectedCounter.Inc()
+			http.Error(w, "too many requests", http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ lowstock.Messenger = (*Slack)(nil)
+
+// testSlack returns a Slack messenger with the signing secret.
+func testSlack(t *testing.T, signingSecret string) *Slack {
+	s, err := New("xoxb-token", signingSecret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	return s
+}
+
+func TestNewEmptySigningSecret(t *testing.T) {
+	if _, err := New("xoxb-token", ""); err == nil {
+		t.Error("Expected an error for an empty signing secret")
+	}
+}
+
+func TestChatID(t *testing.T) {
+	for _, id := range []string{"C024BE91L", "D0123ABCD", "U2147483697", "ZZZZZZZZZZZZ"} {
+		n, err := ChatID(id)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %s", id, err)
+		}
+
+		if got := slackID(n); got != id {
+			t.Errorf("Got ID: %q, expected: %q", got, id)
+		}
+	}
+
+	for _, id := range []string{"", "c024be91l", "C024BE91L-1", "ZZZZZZZZZZZZZ"} {
+		if _, err := ChatID(id); err == nil {
+			t.Errorf("Expected an error for %q", id)
+		}
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	const ts = "1503435956.000247"
+
+	if got := messageTS(messageID(ts)); got != ts {
+		t.Errorf("Got ts: %q, expected: %q", got, ts)
+	}
+}
+
+func TestMrkdwn(t *testing.T) {
+	text := `<b>Sold out</b> <a href="https://www.etsy.com/listing/42">Mug &amp; cup</a>` + "\n<i>SKU</i> <code>m-1</code> &#39;x&#39;"
+	expected := "*Sold out* <https://www.etsy.com/listing/42|Mug &amp; cup>\n_SKU_ `m-1` 'x'"
+
+	if got := mrkdwn(text); got != expected {
+		t.Errorf("Got: %q, expected: %q", got, expected)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	var got PostMessageRequest
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat.postMessage" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+
+		if auth := r.Header.Get("Authorization"); auth != "Bearer xoxb-token" {
+			t.Errorf("Unexpected Authorization: %q", auth)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("Failed to decode request: %s", err)
+		}
+
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = ts.URL + "/api/"
+
+	chatID, _ := ChatID("C024BE91L")
+
+	msg := lowstock.Message{
+		Text: "<b>Sold out</b>",
+		Buttons: [][]lowstock.Button{
+			[]lowstock.Button{lowstock.Button{Text: "Open", URL: "https://www.etsy.com/listing/42"}},
+			[]lowstock.Button{lowstock.Button{Text: "Snooze", Data: "/mute 42 24h #7"}},
+		},
+	}
+
+	if err := testSlack(t, "secret").SendMessage(msg, chatID); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := PostMessageRequest{
+		Channel: "C024BE91L",
+		Text:    "*Sold out*",
+		Blocks: []Block{
+			Block{Type: "section", Text: &Text{Type: "mrkdwn", Text: "*Sold out*"}},
+			Block{Type: "actions", Elements: []Element{
+				Element{Type: "button", Text: Text{Type: "plain_text", Text: "Open"}, ActionID: "button-0-0", URL: "https://www.etsy.com/listing/42"},
+			}},
+			Block{Type: "actions", Elements: []Element{
+				Element{Type: "button", Text: Text{Type: "plain_text", Text: "Snooze"}, ActionID: "button-1-0", Value: "/mute 42 24h #7"},
+			}},
+		},
+	}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Request mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSendMessageErrors(t *testing.T) {
+	limited := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		fmt.Fprint(w, `{"ok":false,"error":"channel_not_found"}`)
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+
+	baseURL = ts.URL + "/api/"
+
+	s := testSlack(t, "secret")
+	if err := s.SendTextMessage("hi", 42); err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("Got error: %v, expected channel_not_found", err)
+	}
+
+	limited = true
+	err := s.SendTextMessage("hi", 42)
+
+	var retryErr *lowstock.RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter != 30*time.Second {
+		t.Errorf("Got error: %v, expected retry after 30s", err)
+	}
+}
+
+func TestIsChatAdmin(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := r.FormValue("user"); user != "U2147483697" {
+			t.Errorf("Unexpected user: %q", user)
+		}
+
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U2147483697","is_admin":false,"is_owner":true}}`)
+	}))
+	defer ts.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = ts.URL + "/api/"
+
+	userID, _ := ChatID("U2147483697")
+
+	isAdmin, err := testSlack(t, "secret").IsChatAdmin(1, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !isAdmin {
+		t.Error("Workspace owner is expected to be an admin")
+	}
+}
+
+func sign(secret string, ts int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:%s", ts, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandler(t *testing.T) {
+	now := time.Unix(1590000000, 0)
+
+	chatID, _ := ChatID("C024BE91L")
+	dmID, _ := ChatID("D0123ABCD")
+	userID, _ := ChatID("U2147483697")
+
+	command := url.Values{
+		"command":    {"/pin"},
+		"text":       {"2"},
+		"channel_id": {"C024BE91L"},
+		"user_id":    {"U2147483697"},
+	}.Encode()
+
+	button := url.Values{
+		"payload": {`{"type":"block_actions","user":{"id":"U2147483697"},"channel":{"id":"D0123ABCD"},"container":{"message_ts":"1590000000.000100"},"actions":[{"value":"/restocked 42 #7"}]}`},
+	}.Encode()
+
+	urlButton := url.Values{
+		"payload": {`{"type":"block_actions","user":{"id":"U2147483697"},"channel":{"id":"D0123ABCD"},"actions":[{"action_id":"button-0-0"}]}`},
+	}.Encode()
+
+	tests := []struct {
+		name     string
+		body     string
+		ts       int64
+		sig      string
+		status   int
+		expected []lowstock.MessengerUpdate
+	}{
+		{
+			name:   "slash command",
+			body:   command,
+			ts:     now.Unix(),
+			status: http.StatusOK,
+			expected: []lowstock.MessengerUpdate{
+				lowstock.MessengerUpdate{ID: 1, Command: "/pin", Text: "/pin 2", ChatID: chatID, UserID: userID, ChatType: "group"},
+			},
+		},
+		{
+			name:   "button",
+			body:   button,
+			ts:     now.Unix(),
+			status: http.StatusOK,
+			expected: []lowstock.MessengerUpdate{
+				lowstock.MessengerUpdate{
+					ID:         1,
+					Command:    "/restocked",
+					Text:       "/restocked 42 #7",
+					ChatID:     dmID,
+					UserID:     userID,
+					ChatType:   "private",
+					CallbackID: "1590000000.000100",
+					MessageID:  1590000000000100,
+				},
+			},
+		},
+		{
+			name:   "URL button",
+			body:   urlButton,
+			ts:     now.Unix(),
+			status: http.StatusOK,
+		},
+		{
+			name:   "bad signature",
+			body:   command,
+			ts:     now.Unix(),
+			sig:    "v0=00",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "replay",
+			body:   command,
+			ts:     now.Add(-10 * time.Minute).Unix(),
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSlack(t, "s3cret")
+			s.now = func() time.Time { return now }
+			s.timeout = time.Millisecond
+
+			sig := test.sig
+			if sig == "" {
+				sig = sign("s3cret", test.ts, test.body)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(test.body))
+			req.Header.Set(timestampHeader, strconv.FormatInt(test.ts, 10))
+			req.Header.Set(signatureHeader, sig)
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				body, _ := ioutil.ReadAll(rec.Body)
+				t.Fatalf("Got status: %d, expected: %d, body: %s", rec.Code, test.status, body)
+			}
+
+			updates, err := s.Updates(0)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expected, updates); diff != "" {
+				t.Errorf("Updates mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
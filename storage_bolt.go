@@ -1,17 +1,38 @@
 package lowstock
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
 
 var (
-	usersBucket  = []byte("Users")
-	tokensBucket = []byte("TempTokens")
+	usersBucket    = []byte("Users")
+	tokensBucket   = []byte("TempTokens")
+	cursorBucket   = []byte("FeedCursor")
+	listingsBucket = []byte("Listings")
+	watchesBucket  = []byte("Watches")
+	seenBucket     = []byte("SeenUpdates")
+	subsBucket     = []byte("Subscriptions")
+	statsBucket    = []byte("UpdateStats")
+	eventsBucket   = []byte("Events")
+	deferredBucket = []byte("DeferredAlerts")
+	outboxBucket   = []byte("Outbox")
+	deadBucket     = []byte("DeadLetters")
+	mutesBucket    = []byte("Mutes")
+	emailsBucket   = []byte("EmailVerifications")
+	webhooksBucket = []byte("Webhooks")
+	deliveryBucket = []byte("WebhookQueue")
+	attemptsBucket = []byte("WebhookLog")
+
+	listingsCursorKey = []byte("listings")
+	syncTokenPrefix   = "sync/"
 )
 
 type BoltStorage struct {
@@ -31,8 +52,53 @@ func NewBoltStorage(file string) (*BoltStorage, error) {
 		if _, err := tx.CreateBucketIfNotExists(tokensBucket); err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists(cursorBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(listingsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(watchesBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(seenBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(subsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(statsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(eventsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(deferredBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(outboxBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(deadBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(mutesBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(emailsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(webhooksBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(deliveryBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(attemptsBucket); err != nil {
+			return err
+		}
 
-		return nil
+		return migrateSubscriptions(tx)
 	}); err != nil {
 		return nil, err
 	}
@@ -40,6 +106,73 @@ func NewBoltStorage(file string) (*BoltStorage, error) {
 	return &BoltStorage{db: db}, nil
 }
 
+// legacyUser is a user record that keeps the only chat linked to the shop.
+type legacyUser struct {
+	EtsyUserID int64
+	ChatUserID int64
+	ChatID     int64
+	Locale     string
+	Paused     bool
+}
+
+// migrateSubscriptions moves chats of legacy user records to subscriptions.
+func migrateSubscriptions(tx *bolt.Tx) error {
+	users := tx.Bucket(usersBucket)
+	subs := tx.Bucket(subsBucket)
+
+	var migrated []User
+
+	c := users.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		legacy := legacyUser{}
+		if err := json.Unmarshal(v, &legacy); err != nil {
+			return err
+		}
+
+		if legacy.ChatID == 0 {
+			continue
+		}
+
+		sub := Subscription{
+			EtsyUserID: legacy.EtsyUserID,
+			ChatID:     legacy.ChatID,
+			ChatUserID: legacy.ChatUserID,
+			Locale:     legacy.Locale,
+			Paused:     legacy.Paused,
+			Selected:   true,
+		}
+
+		value, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+
+		if err := subs.Put(subscriptionKey(sub), value); err != nil {
+			return err
+		}
+
+		user := User{}
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+		migrated = append(migrated, user)
+	}
+
+	// Rewritten records have no chat fields, so they are migrated once.
+	for _, user := range migrated {
+		value, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+
+		if err := users.Put([]byte(strconv.FormatInt(user.EtsyUserID, 10)), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (bs *BoltStorage) SaveUser(ctx context.Context, user User) error {
 	key := []byte(strconv.FormatInt(user.EtsyUserID, 10))
 	value, err := json.Marshal(user)
@@ -84,6 +217,78 @@ func (bs *BoltStorage) User(ctx context.Context, etsyUserID int64) (User, error)
 	return user, nil
 }
 
+// DeleteUser removes the user with subscriptions, watches, update counters, events, listing states and the email verification of the user.
+func (bs *BoltStorage) DeleteUser(ctx context.Context, etsyUserID int64) error {
+	key := []byte(strconv.FormatInt(etsyUserID, 10))
+	prefix := userPrefix(etsyUserID)
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+		if users == nil {
+			return fmt.Errorf("bucket %q not found", usersBucket)
+		}
+
+		if users.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		if err := users.Delete(key); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{watchesBucket, subsBucket, statsBucket, eventsBucket, mutesBucket, webhooksBucket, attemptsBucket, seenBucket} {
+			if err := deletePrefix(tx, name, prefix); err != nil {
+				return err
+			}
+		}
+
+		emails, err := tx.CreateBucketIfNotExists(emailsBucket)
+		if err != nil {
+			return err
+		}
+
+		if err := emails.Delete(key); err != nil {
+			return err
+		}
+
+		if err := deleteMatching(tx, listingsBucket, func(v []byte) (bool, error) {
+			state := ListingState{}
+			err := json.Unmarshal(v, &state)
+			return state.EtsyUserID == etsyUserID, err
+		}); err != nil {
+			return err
+		}
+
+		if err := deleteMatching(tx, deliveryBucket, func(v []byte) (bool, error) {
+			d := WebhookDelivery{}
+			err := json.Unmarshal(v, &d)
+			return d.EtsyUserID == etsyUserID, err
+		}); err != nil {
+			return err
+		}
+
+		if err := deleteMatching(tx, deferredBucket, func(v []byte) (bool, error) {
+			msg := Message{}
+			err := json.Unmarshal(v, &msg)
+			return msg.Alert != nil && msg.Alert.UserID == etsyUserID, err
+		}); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{outboxBucket, deadBucket} {
+			if err := deleteMatching(tx, name, func(v []byte) (bool, error) {
+				msg := OutboxMessage{}
+				err := json.Unmarshal(v, &msg)
+				return msg.EtsyUserID == etsyUserID, err
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 func (bs *BoltStorage) TokenDetails(ctx context.Context, id int64) (TokenDetails, error) {
 	key := []byte(strconv.FormatInt(id, 10))
 	details := TokenDetails{}
@@ -128,6 +333,1272 @@ func (bs *BoltStorage) SaveTokenDetails(ctx context.Context, td TokenDetails) er
 	return nil
 }
 
-func (bs *BoltStorage) Close() {
-	bs.db.Close()
+func (bs *BoltStorage) DeleteTokenDetails(ctx context.Context, id int64) error {
+	key := []byte(strconv.FormatInt(id, 10))
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tokensBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", tokensBucket)
+		}
+
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FeedCursor returns the time offset the listings feed should be read from.
+func (bs *BoltStorage) FeedCursor(ctx context.Context) (int64, error) {
+	var cursor int64
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(cursorBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", cursorBucket)
+		}
+
+		data := bucket.Get(listingsCursorKey)
+		if len(data) == 0 {
+			return ErrNotFound
+		}
+
+		var err error
+		cursor, err = strconv.ParseInt(string(data), 10, 64)
+
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	return cursor, nil
+}
+
+func (bs *BoltStorage) SaveFeedCursor(ctx context.Context, tsz int64) error {
+	value := []byte(strconv.FormatInt(tsz, 10))
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(cursorBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(listingsCursorKey, value)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SyncToken returns the token a messenger syncs updates from, e.g. the Matrix /sync token.
+func (bs *BoltStorage) SyncToken(ctx context.Context, messenger string) (string, error) {
+	var token string
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(cursorBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", cursorBucket)
+		}
+
+		data := bucket.Get([]byte(syncTokenPrefix + messenger))
+		if len(data) == 0 {
+			return ErrNotFound
+		}
+
+		token = string(data)
+
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (bs *BoltStorage) SaveSyncToken(ctx context.Context, messenger, token string) error {
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(cursorBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(syncTokenPrefix+messenger), []byte(token))
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (bs *BoltStorage) ListingState(ctx context.Context, listingID int64) (ListingState, error) {
+	key := []byte(strconv.FormatInt(listingID, 10))
+	state := ListingState{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(listingsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", listingsBucket)
+		}
+
+		data := bucket.Get(key)
+		if len(data) == 0 {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(data, &state)
+	}); err != nil {
+		return ListingState{}, err
+	}
+
+	return state, nil
+}
+
+// ListingStates returns known states of all listings of the user in listing ID order.
+func (bs *BoltStorage) ListingStates(ctx context.Context, etsyUserID int64) ([]ListingState, error) {
+	var states []ListingState
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(listingsBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			state := ListingState{}
+			if err := json.Unmarshal(v, &state); err != nil {
+				return err
+			}
+
+			if state.EtsyUserID == etsyUserID {
+				states = append(states, state)
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	// Keys are decimal strings, they do not sort as numbers.
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ListingID < states[j].ListingID
+	})
+
+	return states, nil
+}
+
+func (bs *BoltStorage) SaveListingState(ctx context.Context, state ListingState) error {
+	key := []byte(strconv.FormatInt(state.ListingID, 10))
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(listingsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(key, value)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// userPrefix is the key prefix of records that belong to the user.
+func userPrefix(etsyUserID int64) []byte {
+	return []byte(strconv.FormatInt(etsyUserID, 10) + "/")
+}
+
+func watchKey(w Watch) []byte {
+	if w.SKU != "" {
+		return append(userPrefix(w.EtsyUserID), "sku/"+w.SKU...)
+	}
+
+	return append(userPrefix(w.EtsyUserID), "listing/"+strconv.FormatInt(w.ListingID, 10)...)
+}
+
+func (bs *BoltStorage) Watches(ctx context.Context, etsyUserID int64) ([]Watch, error) {
+	prefix := userPrefix(etsyUserID)
+	watches := []Watch{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(watchesBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", watchesBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			w := Watch{}
+			if err := json.Unmarshal(v, &w); err != nil {
+				return err
+			}
+			watches = append(watches, w)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return watches, nil
+}
+
+func (bs *BoltStorage) SaveWatch(ctx context.Context, watch Watch) error {
+	value, err := json.Marshal(watch)
+	if err != nil {
+		return err
+	}
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(watchesBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(watchKey(watch), value)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (bs *BoltStorage) DeleteWatch(ctx context.Context, watch Watch) error {
+	key := watchKey(watch)
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(watchesBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", watchesBucket)
+		}
+
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteMatching removes records of the bucket with values picked by match.
+func deleteMatching(tx *bolt.Tx, name []byte, match func(v []byte) (bool, error)) error {
+	bucket, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+
+	c := bucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		ok, err := match(v)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deletePrefix removes all keys with the prefix from the bucket.
+func deletePrefix(tx *bolt.Tx, name, prefix []byte) error {
+	bucket, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+
+	c := bucket.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func subscriptionKey(sub Subscription) []byte {
+	return append(userPrefix(sub.EtsyUserID), strconv.FormatInt(sub.ChatID, 10)...)
+}
+
+// Subscriptions returns chats subscribed to the shop.
+func (bs *BoltStorage) Subscriptions(ctx context.Context, etsyUserID int64) ([]Subscription, error) {
+	prefix := userPrefix(etsyUserID)
+	subs := []Subscription{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", subsBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			sub := Subscription{}
+			if err := json.Unmarshal(v, &sub); err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// ChatSubscriptions returns shops the chat is subscribed to.
+func (bs *BoltStorage) ChatSubscriptions(ctx context.Context, chatID int64) ([]Subscription, error) {
+	return bs.scanSubscriptions(func(sub Subscription) bool {
+		return sub.ChatID == chatID
+	})
+}
+
+// AllSubscriptions returns subscriptions of all shops.
+func (bs *BoltStorage) AllSubscriptions(ctx context.Context) ([]Subscription, error) {
+	return bs.scanSubscriptions(func(sub Subscription) bool {
+		return true
+	})
+}
+
+func (bs *BoltStorage) scanSubscriptions(match func(sub Subscription) bool) ([]Subscription, error) {
+	subs := []Subscription{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", subsBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			sub := Subscription{}
+			if err := json.Unmarshal(v, &sub); err != nil {
+				return err
+			}
+
+			if match(sub) {
+				subs = append(subs, sub)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (bs *BoltStorage) SaveSubscription(ctx context.Context, sub Subscription) error {
+	value, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(subsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(subscriptionKey(sub), value)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (bs *BoltStorage) DeleteSubscription(ctx context.Context, sub Subscription) error {
+	key := subscriptionKey(sub)
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", subsBucket)
+		}
+
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SeenUpdate marks the key as seen for ttl and reports whether it was already seen.
+func (bs *BoltStorage) SeenUpdate(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	seen := false
+
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(seenBucket)
+		if err != nil {
+			return err
+		}
+
+		if data := bucket.Get([]byte(key)); len(data) > 0 {
+			expiresAt, err := strconv.ParseInt(string(data), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			if now.Unix() < expiresAt {
+				seen = true
+				return nil
+			}
+		}
+
+		return bucket.Put([]byte(key), []byte(strconv.FormatInt(now.Add(ttl).Unix(), 10)))
+	}); err != nil {
+		return false, err
+	}
+
+	return seen, nil
+}
+
+// ForgetUpdate removes the key marked by SeenUpdate, so the update is handled again.
+func (bs *BoltStorage) ForgetUpdate(ctx context.Context, key string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(seenBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// PurgeExpired removes records that expired before now.
+func (bs *BoltStorage) PurgeExpired(ctx context.Context, now time.Time) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(seenBucket)
+		if err != nil {
+			return err
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			expiresAt, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil || expiresAt <= now.Unix() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		events, err := tx.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+
+		oldestEvent := now.Add(-eventsTTL).UnixNano()
+
+		c = events.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			at, err := eventTime(k)
+			if err != nil || at < oldestEvent {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		stats, err := tx.CreateBucketIfNotExists(statsBucket)
+		if err != nil {
+			return err
+		}
+
+		oldest := now.Add(-statsPeriod).Truncate(time.Hour).Unix()
+
+		c = stats.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			hour, err := statsHour(k)
+			if err != nil || hour < oldest {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		dead, err := tx.CreateBucketIfNotExists(deadBucket)
+		if err != nil {
+			return err
+		}
+
+		oldestDead := now.Add(-deadLetterTTL)
+
+		c = dead.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			msg := OutboxMessage{}
+			if err := json.Unmarshal(v, &msg); err != nil || msg.Created.Before(oldestDead) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		mutes, err := tx.CreateBucketIfNotExists(mutesBucket)
+		if err != nil {
+			return err
+		}
+
+		c = mutes.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			m := Mute{}
+			if err := json.Unmarshal(v, &m); err != nil || !m.active(now) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		emails, err := tx.CreateBucketIfNotExists(emailsBucket)
+		if err != nil {
+			return err
+		}
+
+		c = emails.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			ev := EmailVerification{}
+			if err := json.Unmarshal(v, &ev); err != nil || ev.Expires <= now.Unix() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// eventKey is "<etsy user id>/<unix nano time>/<listing id>", the time is zero padded to keep events ordered.
+func eventKey(etsyUserID int64, at time.Time, listingID int64) []byte {
+	return append(userPrefix(etsyUserID), fmt.Sprintf("%019d/%d", at.UnixNano(), listingID)...)
+}
+
+func eventTime(key []byte) (int64, error) {
+	parts := bytes.Split(key, []byte("/"))
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("bad event key %q", key)
+	}
+
+	return strconv.ParseInt(string(parts[1]), 10, 64)
+}
+
+func (bs *BoltStorage) SaveEvent(ctx context.Context, event Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(eventKey(event.EtsyUserID, event.Time, event.ListingID), value)
+	})
+}
+
+// Events returns events of the user that happened at or after since, oldest first.
+func (bs *BoltStorage) Events(ctx context.Context, etsyUserID int64, since time.Time) ([]Event, error) {
+	prefix := userPrefix(etsyUserID)
+	events := []Event{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", eventsBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(eventKey(etsyUserID, since, 0)); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			event := Event{}
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func chatPrefix(chatID int64) []byte {
+	return []byte(strconv.FormatInt(chatID, 10) + "/")
+}
+
+// deferredKey is the key of a deferred alert, "<chat id>/<zero padded id>" keeps alerts of a chat in order.
+func deferredKey(chatID int64, id uint64) []byte {
+	return append(chatPrefix(chatID), fmt.Sprintf("%020d", id)...)
+}
+
+// DeferAlert keeps the alert until DeleteDeferredAlerts, alerts of a chat are kept in order.
+func (bs *BoltStorage) DeferAlert(ctx context.Context, chatID int64, msg Message) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(deferredBucket)
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(deferredKey(chatID, seq), value)
+	})
+}
+
+// DeferredAlerts returns deferred alerts of the chat in order, they are kept until deleted.
+func (bs *BoltStorage) DeferredAlerts(ctx context.Context, chatID int64) ([]DeferredAlert, error) {
+	prefix := chatPrefix(chatID)
+	alerts := []DeferredAlert{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deferredBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			id, err := strconv.ParseUint(string(k[len(prefix):]), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			alert := DeferredAlert{ID: id}
+			if err := json.Unmarshal(v, &alert.Message); err != nil {
+				return err
+			}
+			alerts = append(alerts, alert)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// DeleteDeferredAlerts removes deferred alerts of the chat by ID.
+func (bs *BoltStorage) DeleteDeferredAlerts(ctx context.Context, chatID int64, ids []uint64) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(deferredBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := bucket.Delete(deferredKey(chatID, id)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// statsKey is the key of the hourly update counter, "<etsy user id>/<hour unix time>".
+func statsKey(etsyUserID int64, at time.Time) []byte {
+	return append(userPrefix(etsyUserID), strconv.FormatInt(at.Truncate(time.Hour).Unix(), 10)...)
+}
+
+func statsHour(key []byte) (int64, error) {
+	return strconv.ParseInt(string(key[bytes.LastIndexByte(key, '/')+1:]), 10, 64)
+}
+
+// CountUpdate increments the counter of the hour the update was seen in.
+func (bs *BoltStorage) CountUpdate(ctx context.Context, etsyUserID int64, at time.Time) error {
+	key := statsKey(etsyUserID, at)
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(statsBucket)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if data := bucket.Get(key); len(data) > 0 {
+			if count, err = strconv.ParseInt(string(data), 10, 64); err != nil {
+				return err
+			}
+		}
+
+		return bucket.Put(key, []byte(strconv.FormatInt(count+1, 10)))
+	})
+}
+
+// UpdateCount sums hourly update counters of the user starting with the hour of since.
+func (bs *BoltStorage) UpdateCount(ctx context.Context, etsyUserID int64, since time.Time) (int64, error) {
+	prefix := userPrefix(etsyUserID)
+	oldest := since.Truncate(time.Hour).Unix()
+
+	var total int64
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(statsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", statsBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			hour, err := statsHour(k)
+			if err != nil {
+				return err
+			}
+
+			if hour < oldest {
+				continue
+			}
+
+			count, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return err
+			}
+			total += count
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (bs *BoltStorage) Close() {
+	bs.db.Close()
+}
+
+func outboxKey(id uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", id))
+}
+
+// EnqueueMessage adds the message to the end of the outbox, the ID of msg is ignored.
+func (bs *BoltStorage) EnqueueMessage(ctx context.Context, msg OutboxMessage) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(outboxBucket)
+		if err != nil {
+			return err
+		}
+
+		msg.ID, err = bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(outboxKey(msg.ID), value)
+	})
+}
+
+// OutboxMessages returns queued messages in the order they were enqueued.
+func (bs *BoltStorage) OutboxMessages(ctx context.Context) ([]OutboxMessage, error) {
+	queue := []OutboxMessage{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", outboxBucket)
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			msg := OutboxMessage{}
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			queue = append(queue, msg)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// SaveOutboxMessage updates a queued message, messages that left the queue are not added back.
+func (bs *BoltStorage) SaveOutboxMessage(ctx context.Context, msg OutboxMessage) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(outboxBucket)
+		if err != nil {
+			return err
+		}
+
+		key := outboxKey(msg.ID)
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Put(key, value)
+	})
+}
+
+func (bs *BoltStorage) DeleteOutboxMessage(ctx context.Context, id uint64) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", outboxBucket)
+		}
+
+		key := outboxKey(id)
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+// DeadLetter moves the message from the outbox to dead letters.
+func (bs *BoltStorage) DeadLetter(ctx context.Context, msg OutboxMessage) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		outbox, err := tx.CreateBucketIfNotExists(outboxBucket)
+		if err != nil {
+			return err
+		}
+
+		dead, err := tx.CreateBucketIfNotExists(deadBucket)
+		if err != nil {
+			return err
+		}
+
+		key := outboxKey(msg.ID)
+		if err := outbox.Delete(key); err != nil {
+			return err
+		}
+
+		return dead.Put(key, value)
+	})
+}
+
+func muteKey(m Mute) []byte {
+	return watchKey(Watch{EtsyUserID: m.EtsyUserID, ListingID: m.ListingID, SKU: m.SKU})
+}
+
+// Mutes returns mutes of the shop, expired ones are included until purged.
+func (bs *BoltStorage) Mutes(ctx context.Context, etsyUserID int64) ([]Mute, error) {
+	prefix := userPrefix(etsyUserID)
+	mutes := []Mute{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(mutesBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", mutesBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			m := Mute{}
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			mutes = append(mutes, m)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return mutes, nil
+}
+
+func (bs *BoltStorage) SaveMute(ctx context.Context, mute Mute) error {
+	value, err := json.Marshal(mute)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(mutesBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(muteKey(mute), value)
+	})
+}
+
+func (bs *BoltStorage) DeleteMute(ctx context.Context, mute Mute) error {
+	key := muteKey(mute)
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(mutesBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", mutesBucket)
+		}
+
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func (bs *BoltStorage) EmailVerification(ctx context.Context, etsyUserID int64) (EmailVerification, error) {
+	key := []byte(strconv.FormatInt(etsyUserID, 10))
+	v := EmailVerification{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(emailsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", emailsBucket)
+		}
+
+		data := bucket.Get(key)
+		if len(data) == 0 {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(data, &v)
+	}); err != nil {
+		return EmailVerification{}, err
+	}
+
+	return v, nil
+}
+
+// SaveEmailVerification replaces the pending verification of the user.
+func (bs *BoltStorage) SaveEmailVerification(ctx context.Context, v EmailVerification) error {
+	key := []byte(strconv.FormatInt(v.EtsyUserID, 10))
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(emailsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(key, value)
+	})
+}
+
+func (bs *BoltStorage) DeleteEmailVerification(ctx context.Context, etsyUserID int64) error {
+	key := []byte(strconv.FormatInt(etsyUserID, 10))
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(emailsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", emailsBucket)
+		}
+
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func webhookKey(etsyUserID int64, id uint64) []byte {
+	return append(userPrefix(etsyUserID), fmt.Sprintf("%020d", id)...)
+}
+
+// webhookLogPrefix keeps attempts of a webhook together, in time order.
+func webhookLogPrefix(etsyUserID int64, webhookID uint64) []byte {
+	return append(webhookKey(etsyUserID, webhookID), '/')
+}
+
+func (bs *BoltStorage) Webhooks(ctx context.Context, etsyUserID int64) ([]Webhook, error) {
+	prefix := userPrefix(etsyUserID)
+	hooks := []Webhook{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webhooksBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", webhooksBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			hook := Webhook{}
+			if err := json.Unmarshal(v, &hook); err != nil {
+				return err
+			}
+			hooks = append(hooks, hook)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// AddWebhook saves the webhook under a new ID, the ID of hook is ignored.
+func (bs *BoltStorage) AddWebhook(ctx context.Context, hook Webhook) (uint64, error) {
+	if err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(webhooksBucket)
+		if err != nil {
+			return err
+		}
+
+		hook.ID, err = bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(hook)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(webhookKey(hook.EtsyUserID, hook.ID), value)
+	}); err != nil {
+		return 0, err
+	}
+
+	return hook.ID, nil
+}
+
+// DeleteWebhook deletes the webhook with its delivery log, queued deliveries are dropped by the sender.
+func (bs *BoltStorage) DeleteWebhook(ctx context.Context, etsyUserID int64, id uint64) error {
+	key := webhookKey(etsyUserID, id)
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webhooksBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", webhooksBucket)
+		}
+
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+
+		return deletePrefix(tx, attemptsBucket, webhookLogPrefix(etsyUserID, id))
+	})
+}
+
+// EnqueueWebhookDelivery adds the delivery to the end of the queue, the ID of d is ignored.
+func (bs *BoltStorage) EnqueueWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(deliveryBucket)
+		if err != nil {
+			return err
+		}
+
+		d.ID, err = bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(outboxKey(d.ID), value)
+	})
+}
+
+// WebhookDeliveries returns queued deliveries in the order they were enqueued.
+func (bs *BoltStorage) WebhookDeliveries(ctx context.Context) ([]WebhookDelivery, error) {
+	queue := []WebhookDelivery{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deliveryBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", deliveryBucket)
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			d := WebhookDelivery{}
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			queue = append(queue, d)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// SaveWebhookDelivery updates a queued delivery, deliveries that left the queue are not added back.
+func (bs *BoltStorage) SaveWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	value, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(deliveryBucket)
+		if err != nil {
+			return err
+		}
+
+		key := outboxKey(d.ID)
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Put(key, value)
+	})
+}
+
+func (bs *BoltStorage) DeleteWebhookDelivery(ctx context.Context, id uint64) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deliveryBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", deliveryBucket)
+		}
+
+		key := outboxKey(id)
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+// LogWebhookAttempt adds the attempt to the delivery log of the webhook,
+// only the last maxWebhookAttempts entries are kept.
+func (bs *BoltStorage) LogWebhookAttempt(ctx context.Context, attempt WebhookAttempt) error {
+	prefix := webhookLogPrefix(attempt.EtsyUserID, attempt.WebhookID)
+
+	value, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(attemptsBucket)
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put(append(prefix, fmt.Sprintf("%020d", seq)...), value); err != nil {
+			return err
+		}
+
+		var keys [][]byte
+
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+
+		for i := 0; i < len(keys)-maxWebhookAttempts; i++ {
+			if err := bucket.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// WebhookAttempts returns the delivery log of the webhook, the last attempt first.
+func (bs *BoltStorage) WebhookAttempts(ctx context.Context, etsyUserID int64, webhookID uint64) ([]WebhookAttempt, error) {
+	prefix := webhookLogPrefix(etsyUserID, webhookID)
+	attempts := []WebhookAttempt{}
+
+	if err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attemptsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %q not found", attemptsBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			a := WebhookAttempt{}
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			attempts = append([]WebhookAttempt{a}, attempts...)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
 }
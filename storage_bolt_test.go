@@ -2,10 +2,13 @@ package lowstock
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/boltdb/bolt"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -42,8 +45,7 @@ func TestStoredUserCanBeRead(t *testing.T) {
 
 	expectedUser := User{
 		EtsyUserID:  1234,
-		ChatUserID:  4321,
-		ChatID:      9876,
+		ShopName:    "TestShop",
 		Token:       "test_token",
 		TokenSecret: "test_secret",
 	}
@@ -114,3 +116,918 @@ func TestStoredTokenDetailsCanBeRead(t *testing.T) {
 		t.Errorf("Token details are different:\n%s", diff)
 	}
 }
+
+func TestUnknownFeedCursorReturnsNotFound(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_cursor_nf.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	if _, err := db.FeedCursor(context.Background()); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestStoredFeedCursorCanBeRead(t *testing.T) {
+	var expectedCursor int64 = 1580000000
+
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_cursor.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.SaveFeedCursor(ctx, expectedCursor); err != nil {
+		t.Errorf("Failed to save feed cursor: %s", err)
+	}
+
+	actualCursor, err := db.FeedCursor(ctx)
+	if err != nil {
+		t.Errorf("Failed to retrieve feed cursor: %s", err)
+	}
+
+	if actualCursor != expectedCursor {
+		t.Errorf("Got cursor: %d, expected: %d", actualCursor, expectedCursor)
+	}
+}
+
+func TestSyncToken(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_sync_token.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.SyncToken(ctx, "matrix"); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if err := db.SaveSyncToken(ctx, "matrix", "s72594_4483_1934"); err != nil {
+		t.Fatalf("Failed to save sync token: %s", err)
+	}
+
+	token, err := db.SyncToken(ctx, "matrix")
+	if err != nil {
+		t.Fatalf("Failed to get sync token: %s", err)
+	}
+
+	if token != "s72594_4483_1934" {
+		t.Errorf("Got token: %q, expected: %q", token, "s72594_4483_1934")
+	}
+
+	// The token does not move the listings feed.
+	if _, err := db.FeedCursor(ctx); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_subscriptions.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	subs := []Subscription{
+		Subscription{EtsyUserID: 1, ChatID: 10},
+		Subscription{EtsyUserID: 1, ChatID: -20},
+		Subscription{EtsyUserID: 2, ChatID: 10, Selected: true},
+		Subscription{EtsyUserID: 12, ChatID: 30},
+	}
+
+	ctx := context.Background()
+	for _, sub := range subs {
+		if err := db.SaveSubscription(ctx, sub); err != nil {
+			t.Fatalf("Failed to save subscription: %s", err)
+		}
+	}
+
+	shopSubs, err := db.Subscriptions(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to retrieve subscriptions: %s", err)
+	}
+
+	if diff := cmp.Diff([]Subscription{subs[1], subs[0]}, shopSubs); diff != "" {
+		t.Errorf("Shop subscriptions are different:\n%s", diff)
+	}
+
+	chatSubs, err := db.ChatSubscriptions(ctx, 10)
+	if err != nil {
+		t.Fatalf("Failed to retrieve subscriptions: %s", err)
+	}
+
+	if diff := cmp.Diff([]Subscription{subs[0], subs[2]}, chatSubs); diff != "" {
+		t.Errorf("Chat subscriptions are different:\n%s", diff)
+	}
+
+	if err := db.DeleteSubscription(ctx, subs[0]); err != nil {
+		t.Errorf("Failed to delete subscription: %s", err)
+	}
+
+	if err := db.DeleteSubscription(ctx, subs[0]); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestLegacyUsersMigrateToSubscriptions(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_migration.db")
+	defer os.Remove(dbFile)
+
+	db, err := bolt.Open(dbFile, 0644, nil)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(usersBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte("5432"), []byte(`{"EtsyUserID":5432,"ChatUserID":7,"ChatID":42,"Token":"t","Threshold":3,"Locale":"uk"}`))
+	}); err != nil {
+		t.Fatalf("Failed to save legacy user: %s", err)
+	}
+	db.Close()
+
+	storage, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+
+	ctx := context.Background()
+
+	subs, err := storage.Subscriptions(ctx, 5432)
+	if err != nil {
+		t.Fatalf("Failed to retrieve subscriptions: %s", err)
+	}
+
+	expected := []Subscription{Subscription{EtsyUserID: 5432, ChatID: 42, ChatUserID: 7, Locale: "uk", Selected: true}}
+	if diff := cmp.Diff(expected, subs); diff != "" {
+		t.Errorf("Subscriptions are different:\n%s", diff)
+	}
+
+	user, err := storage.User(ctx, 5432)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user: %s", err)
+	}
+
+	if diff := cmp.Diff(User{EtsyUserID: 5432, Token: "t", Threshold: 3}, user); diff != "" {
+		t.Errorf("Users are different:\n%s", diff)
+	}
+
+	if err := storage.DeleteSubscription(ctx, expected[0]); err != nil {
+		t.Fatalf("Failed to delete subscription: %s", err)
+	}
+	storage.Close()
+
+	// Unlinked chat must not come back on the next start.
+	storage, err = NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer storage.Close()
+
+	subs, err = storage.Subscriptions(ctx, 5432)
+	if err != nil {
+		t.Fatalf("Failed to retrieve subscriptions: %s", err)
+	}
+
+	if len(subs) != 0 {
+		t.Errorf("Got %d subscriptions after restart, expected: 0", len(subs))
+	}
+}
+
+func TestStoredListingStateCanBeRead(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_listings.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	expectedState := ListingState{
+		ListingID:  42,
+		EtsyUserID: 1234,
+		State:      "active",
+		Quantity:   2,
+		Title:      "Mug",
+		LowStock:   true,
+	}
+
+	ctx := context.Background()
+	if err := db.SaveListingState(ctx, expectedState); err != nil {
+		t.Errorf("Failed to save listing state: %s", err)
+	}
+
+	actualState, err := db.ListingState(ctx, expectedState.ListingID)
+	if err != nil {
+		t.Errorf("Failed to retrieve listing state: %s", err)
+	}
+
+	if diff := cmp.Diff(actualState, expectedState); diff != "" {
+		t.Errorf("Listing states are different:\n%s", diff)
+	}
+
+	// Listings of other users are left out, the rest come in listing ID order.
+	for _, state := range []ListingState{
+		ListingState{ListingID: 100, EtsyUserID: 1234},
+		ListingState{ListingID: 7, EtsyUserID: 1234},
+		ListingState{ListingID: 8, EtsyUserID: 99},
+	} {
+		if err := db.SaveListingState(ctx, state); err != nil {
+			t.Errorf("Failed to save listing state: %s", err)
+		}
+	}
+
+	states, err := db.ListingStates(ctx, 1234)
+	if err != nil {
+		t.Errorf("Failed to retrieve listing states: %s", err)
+	}
+
+	var ids []int64
+	for _, state := range states {
+		ids = append(ids, state.ListingID)
+	}
+
+	if diff := cmp.Diff([]int64{7, 42, 100}, ids); diff != "" {
+		t.Errorf("Listing states are different:\n%s", diff)
+	}
+}
+
+func TestStoredWatchesCanBeReadAndDeleted(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_watches.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	expectedWatches := []Watch{
+		Watch{EtsyUserID: 12, ListingID: 42, Threshold: 10},
+		Watch{EtsyUserID: 12, SKU: "MUG-RED", Threshold: 0},
+	}
+
+	ctx := context.Background()
+	for _, w := range append(expectedWatches, Watch{EtsyUserID: 1, ListingID: 42}) {
+		if err := db.SaveWatch(ctx, w); err != nil {
+			t.Fatalf("Failed to save watch: %s", err)
+		}
+	}
+
+	actualWatches, err := db.Watches(ctx, 12)
+	if err != nil {
+		t.Fatalf("Failed to retrieve watches: %s", err)
+	}
+
+	if diff := cmp.Diff(actualWatches, expectedWatches); diff != "" {
+		t.Errorf("Watches are different:\n%s", diff)
+	}
+
+	if err := db.DeleteWatch(ctx, expectedWatches[0]); err != nil {
+		t.Errorf("Failed to delete watch: %s", err)
+	}
+
+	if err := db.DeleteWatch(ctx, expectedWatches[0]); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_delete_user.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for _, id := range []int64{12, 13} {
+		if err := db.SaveUser(ctx, User{EtsyUserID: id}); err != nil {
+			t.Fatalf("Failed to save user: %s", err)
+		}
+		if err := db.SaveWatch(ctx, Watch{EtsyUserID: id, ListingID: 42}); err != nil {
+			t.Fatalf("Failed to save watch: %s", err)
+		}
+		if err := db.SaveListingState(ctx, ListingState{EtsyUserID: id, ListingID: id}); err != nil {
+			t.Fatalf("Failed to save listing state: %s", err)
+		}
+
+		update := Update{UserID: id, ListingID: id, State: soldOut, LastModifiedTSZ: 1000}
+		if _, err := db.SeenUpdate(ctx, update.seenKey(), time.Hour); err != nil {
+			t.Fatalf("Failed to save seen update: %s", err)
+		}
+
+		for _, err := range []error{
+			db.SaveSubscription(ctx, Subscription{EtsyUserID: id, ChatID: id}),
+			db.CountUpdate(ctx, id, time.Now()),
+			db.SaveEvent(ctx, Event{EtsyUserID: id, ListingID: id, Time: time.Now()}),
+			db.SaveMute(ctx, Mute{EtsyUserID: id, ListingID: id}),
+			db.SaveEmailVerification(ctx, EmailVerification{EtsyUserID: id, Address: "shop@example.com"}),
+			db.EnqueueWebhookDelivery(ctx, WebhookDelivery{EtsyUserID: id, WebhookID: 1}),
+			db.LogWebhookAttempt(ctx, WebhookAttempt{EtsyUserID: id, WebhookID: 1}),
+			db.DeferAlert(ctx, 99, Message{Text: "Sold out", Alert: &AlertData{Update: update}}),
+			db.EnqueueMessage(ctx, OutboxMessage{ChatID: 99, EtsyUserID: id}),
+			db.DeadLetter(ctx, OutboxMessage{ID: uint64(id), ChatID: 99, EtsyUserID: id}),
+		} {
+			if err != nil {
+				t.Fatalf("Failed to save records: %s", err)
+			}
+		}
+
+		if _, err := db.AddWebhook(ctx, Webhook{EtsyUserID: id, URL: "https://example.com/hook"}); err != nil {
+			t.Fatalf("Failed to add webhook: %s", err)
+		}
+	}
+
+	// Both users have the same records, half of every bucket is left.
+	counts := func() map[string]int {
+		counts := map[string]int{}
+		db.db.View(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				counts[string(name)] = b.Stats().KeyN
+				return nil
+			})
+		})
+		return counts
+	}
+
+	before := counts()
+
+	if err := db.DeleteUser(ctx, 12); err != nil {
+		t.Fatalf("Failed to delete user: %s", err)
+	}
+
+	for name, n := range counts() {
+		if name == string(tokensBucket) || name == string(cursorBucket) {
+			continue
+		}
+
+		if n*2 != before[name] {
+			t.Errorf("Got %d records in %s, expected: %d", n, name, before[name]/2)
+		}
+	}
+
+	if _, err := db.User(ctx, 12); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if watches, _ := db.Watches(ctx, 12); len(watches) != 0 {
+		t.Errorf("Got %d watches of deleted user, expected: 0", len(watches))
+	}
+
+	if _, err := db.ListingState(ctx, 12); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if _, err := db.User(ctx, 13); err != nil {
+		t.Errorf("Other user is affected: %s", err)
+	}
+
+	if watches, _ := db.Watches(ctx, 13); len(watches) != 1 {
+		t.Errorf("Got %d watches of other user, expected: 1", len(watches))
+	}
+
+	if err := db.DeleteUser(ctx, 12); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestDeleteTokenDetails(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_delete_tokens.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.SaveTokenDetails(ctx, TokenDetails{ID: 7, Token: "t"}); err != nil {
+		t.Fatalf("Failed to save token details: %s", err)
+	}
+
+	if err := db.DeleteTokenDetails(ctx, 7); err != nil {
+		t.Errorf("Failed to delete token details: %s", err)
+	}
+
+	if _, err := db.TokenDetails(ctx, 7); err != ErrNotFound {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestSeenUpdate(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_seen.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for i, expected := range []bool{false, true, true} {
+		seen, err := db.SeenUpdate(ctx, "42/sold_out/1000", time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to check update: %s", err)
+		}
+
+		if seen != expected {
+			t.Errorf("Got seen: %t on call %d, expected: %t", seen, i, expected)
+		}
+	}
+
+	if err := db.ForgetUpdate(ctx, "42/sold_out/1000"); err != nil {
+		t.Fatalf("Failed to forget update: %s", err)
+	}
+
+	seen, err := db.SeenUpdate(ctx, "42/sold_out/1000", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to check update: %s", err)
+	}
+
+	if seen {
+		t.Error("Forgotten update is still seen")
+	}
+
+	if err := db.PurgeExpired(ctx, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("Failed to purge: %s", err)
+	}
+
+	seen, err = db.SeenUpdate(ctx, "42/sold_out/1000", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to check update: %s", err)
+	}
+
+	if seen {
+		t.Error("Purged update is still seen")
+	}
+}
+
+func TestUpdateCount(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_stats.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, at := range []time.Time{now, now, now.Add(-2 * time.Hour), now.Add(-30 * time.Hour)} {
+		if err := db.CountUpdate(ctx, 42, at); err != nil {
+			t.Fatalf("Failed to count update: %s", err)
+		}
+	}
+
+	if err := db.CountUpdate(ctx, 4, now); err != nil {
+		t.Fatalf("Failed to count update: %s", err)
+	}
+
+	count, err := db.UpdateCount(ctx, 42, now.Add(-statsPeriod))
+	if err != nil {
+		t.Fatalf("Failed to get update count: %s", err)
+	}
+
+	if count != 3 {
+		t.Errorf("Got %d updates, expected: 3", count)
+	}
+
+	if err := db.PurgeExpired(ctx, now); err != nil {
+		t.Fatalf("Failed to purge: %s", err)
+	}
+
+	count, err = db.UpdateCount(ctx, 42, now.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to get update count: %s", err)
+	}
+
+	if count != 3 {
+		t.Errorf("Got %d updates after purge, expected: 3", count)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_events.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	events := []Event{
+		Event{EtsyUserID: 42, ListingID: 1, Kind: "sold_out", Title: "Mug", Time: now.Add(-10 * 24 * time.Hour)},
+		Event{EtsyUserID: 42, ListingID: 2, Kind: "low_stock", Title: "Plate", Quantity: 2, Time: now.Add(-2 * time.Hour)},
+		Event{EtsyUserID: 42, ListingID: 1, Kind: "restocked", Title: "Mug", Quantity: 5, Time: now.Add(-time.Hour)},
+		Event{EtsyUserID: 4, ListingID: 3, Kind: "sold_out", Title: "Cup", Time: now.Add(-time.Hour)},
+	}
+
+	for _, e := range events {
+		if err := db.SaveEvent(ctx, e); err != nil {
+			t.Fatalf("Failed to save event: %s", err)
+		}
+	}
+
+	actual, err := db.Events(ctx, 42, now.Add(-3*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to get events: %s", err)
+	}
+
+	if diff := cmp.Diff(events[1:3], actual); diff != "" {
+		t.Errorf("Events do not match:\n%s", diff)
+	}
+
+	if err := db.PurgeExpired(ctx, now); err != nil {
+		t.Fatalf("Failed to purge: %s", err)
+	}
+
+	actual, err = db.Events(ctx, 42, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("Failed to get events: %s", err)
+	}
+
+	if len(actual) != 2 {
+		t.Errorf("Got %d events after purge, expected: 2", len(actual))
+	}
+}
+
+func TestDeferredAlerts(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_deferred.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	alerts := []Message{
+		Message{Text: "first", Buttons: [][]Button{[]Button{Button{Text: "Open", URL: "https://example.com"}}}},
+		Message{Text: "second"},
+	}
+
+	for _, msg := range alerts {
+		if err := db.DeferAlert(ctx, -100, msg); err != nil {
+			t.Fatalf("Failed to defer alert: %s", err)
+		}
+	}
+
+	if err := db.DeferAlert(ctx, 100, Message{Text: "other chat"}); err != nil {
+		t.Fatalf("Failed to defer alert: %s", err)
+	}
+
+	actual, err := db.DeferredAlerts(ctx, -100)
+	if err != nil {
+		t.Fatalf("Failed to get deferred alerts: %s", err)
+	}
+
+	var messages []Message
+	for _, alert := range actual {
+		messages = append(messages, alert.Message)
+	}
+
+	if diff := cmp.Diff(alerts, messages); diff != "" {
+		t.Errorf("Alerts do not match:\n%s", diff)
+	}
+
+	// Alerts are kept until deleted.
+	if err := db.DeleteDeferredAlerts(ctx, -100, []uint64{actual[0].ID}); err != nil {
+		t.Fatalf("Failed to delete deferred alerts: %s", err)
+	}
+
+	actual, err = db.DeferredAlerts(ctx, -100)
+	if err != nil {
+		t.Fatalf("Failed to get deferred alerts: %s", err)
+	}
+
+	if len(actual) != 1 || actual[0].Message.Text != "second" {
+		t.Errorf("Got alerts: %+v, expected the second one only", actual)
+	}
+
+	actual, err = db.DeferredAlerts(ctx, 100)
+	if err != nil {
+		t.Fatalf("Failed to get deferred alerts: %s", err)
+	}
+
+	if len(actual) != 1 {
+		t.Errorf("Got %d alerts of the other chat, expected: 1", len(actual))
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_outbox.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	created := time.Unix(1590000000, 0).UTC()
+
+	for _, text := range []string{"first", "second", "third"} {
+		if err := db.EnqueueMessage(ctx, OutboxMessage{ChatID: -100, Message: Message{Text: text}, Created: created}); err != nil {
+			t.Fatalf("Failed to enqueue message: %s", err)
+		}
+	}
+
+	queue, err := db.OutboxMessages(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get outbox messages: %s", err)
+	}
+
+	if len(queue) != 3 || queue[0].Message.Text != "first" || queue[2].Message.Text != "third" {
+		t.Fatalf("Unexpected queue: %+v", queue)
+	}
+
+	retry := queue[1]
+	retry.Attempts = 1
+	retry.NextAttempt = created.Add(time.Minute)
+	retry.LastError = "bad gateway"
+
+	if err := db.SaveOutboxMessage(ctx, retry); err != nil {
+		t.Fatalf("Failed to save outbox message: %s", err)
+	}
+
+	if err := db.DeleteOutboxMessage(ctx, queue[0].ID); err != nil {
+		t.Fatalf("Failed to delete outbox message: %s", err)
+	}
+
+	if err := db.DeadLetter(ctx, queue[2]); err != nil {
+		t.Fatalf("Failed to dead-letter outbox message: %s", err)
+	}
+
+	actual, err := db.OutboxMessages(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get outbox messages: %s", err)
+	}
+
+	if diff := cmp.Diff([]OutboxMessage{retry}, actual); diff != "" {
+		t.Errorf("Outbox does not match:\n%s", diff)
+	}
+
+	// Messages that left the queue are not added back.
+	if err := db.SaveOutboxMessage(ctx, queue[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if err := db.PurgeExpired(ctx, created.Add(deadLetterTTL+time.Hour)); err != nil {
+		t.Fatalf("Failed to purge expired records: %s", err)
+	}
+
+	if err := db.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(deadBucket).Stats().KeyN; n != 0 {
+			t.Errorf("Got %d dead letters after purge, expected none", n)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to read dead letters: %s", err)
+	}
+}
+
+func TestMutes(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_mutes.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	mutes := []Mute{
+		Mute{EtsyUserID: 1, ListingID: 42, Until: now.Add(-time.Minute).Unix()},
+		Mute{EtsyUserID: 1, SKU: "MUG-RED"},
+		Mute{EtsyUserID: 2, ListingID: 7},
+	}
+
+	for _, m := range mutes {
+		if err := db.SaveMute(ctx, m); err != nil {
+			t.Fatalf("Failed to save mute: %s", err)
+		}
+	}
+
+	if err := db.PurgeExpired(ctx, now); err != nil {
+		t.Fatalf("Failed to purge expired records: %s", err)
+	}
+
+	actual, err := db.Mutes(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get mutes: %s", err)
+	}
+
+	if diff := cmp.Diff([]Mute{mutes[1]}, actual); diff != "" {
+		t.Errorf("Mutes do not match:\n%s", diff)
+	}
+
+	if err := db.DeleteMute(ctx, mutes[1]); err != nil {
+		t.Fatalf("Failed to delete mute: %s", err)
+	}
+
+	if err := db.DeleteMute(ctx, mutes[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestEmailVerifications(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_emails.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	expired := EmailVerification{EtsyUserID: 1, Address: "old@example.com", Code: "111111", Expires: now.Add(-time.Minute).Unix()}
+	pending := EmailVerification{EtsyUserID: 2, Address: "books@example.com", Code: "123456", Expires: now.Add(time.Hour).Unix()}
+
+	for _, v := range []EmailVerification{expired, pending} {
+		if err := db.SaveEmailVerification(ctx, v); err != nil {
+			t.Fatalf("Failed to save email verification: %s", err)
+		}
+	}
+
+	if err := db.PurgeExpired(ctx, now); err != nil {
+		t.Fatalf("Failed to purge expired records: %s", err)
+	}
+
+	if _, err := db.EmailVerification(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	actual, err := db.EmailVerification(ctx, 2)
+	if err != nil {
+		t.Fatalf("Failed to get email verification: %s", err)
+	}
+
+	if diff := cmp.Diff(pending, actual); diff != "" {
+		t.Errorf("Email verifications do not match:\n%s", diff)
+	}
+
+	if err := db.DeleteEmailVerification(ctx, 2); err != nil {
+		t.Fatalf("Failed to delete email verification: %s", err)
+	}
+
+	if err := db.DeleteEmailVerification(ctx, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_webhooks.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	created := time.Unix(1590000000, 0).UTC()
+
+	hook := Webhook{EtsyUserID: 1, URL: "https://erp.example.com/hooks", Secret: "s3cret", Created: created}
+
+	id, err := db.AddWebhook(ctx, hook)
+	if err != nil {
+		t.Fatalf("Failed to add webhook: %s", err)
+	}
+	hook.ID = id
+
+	if _, err := db.AddWebhook(ctx, Webhook{EtsyUserID: 12, URL: "https://other.example.com", Created: created}); err != nil {
+		t.Fatalf("Failed to add webhook: %s", err)
+	}
+
+	hooks, err := db.Webhooks(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get webhooks: %s", err)
+	}
+
+	if diff := cmp.Diff([]Webhook{hook}, hooks); diff != "" {
+		t.Errorf("Webhooks do not match:\n%s", diff)
+	}
+
+	for i := 1; i <= maxWebhookAttempts+2; i++ {
+		a := WebhookAttempt{EtsyUserID: 1, WebhookID: id, DeliveryID: uint64(i), Attempt: 1, Status: 200, Time: created}
+		if err := db.LogWebhookAttempt(ctx, a); err != nil {
+			t.Fatalf("Failed to log webhook attempt: %s", err)
+		}
+	}
+
+	attempts, err := db.WebhookAttempts(ctx, 1, id)
+	if err != nil {
+		t.Fatalf("Failed to get webhook attempts: %s", err)
+	}
+
+	if len(attempts) != maxWebhookAttempts || attempts[0].DeliveryID != maxWebhookAttempts+2 {
+		t.Errorf("Expected last %d attempts, the last one first, got: %+v", maxWebhookAttempts, attempts)
+	}
+
+	if err := db.DeleteWebhook(ctx, 1, id); err != nil {
+		t.Fatalf("Failed to delete webhook: %s", err)
+	}
+
+	if err := db.DeleteWebhook(ctx, 1, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if attempts, _ := db.WebhookAttempts(ctx, 1, id); len(attempts) != 0 {
+		t.Errorf("Delivery log is kept after the webhook is deleted: %+v", attempts)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	dbFile := filepath.Join(os.TempDir(), "lowstock_test_deliveries.db")
+	defer os.Remove(dbFile)
+
+	db, err := NewBoltStorage(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to init DB: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	created := time.Unix(1590000000, 0).UTC()
+
+	for _, event := range []string{alertSoldOut, alertRestocked} {
+		d := WebhookDelivery{EtsyUserID: 1, WebhookID: 3, Event: event, Payload: []byte(`{"version":1}`), Created: created}
+		if err := db.EnqueueWebhookDelivery(ctx, d); err != nil {
+			t.Fatalf("Failed to enqueue webhook delivery: %s", err)
+		}
+	}
+
+	queue, err := db.WebhookDeliveries(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get webhook deliveries: %s", err)
+	}
+
+	if len(queue) != 2 || queue[0].Event != alertSoldOut || queue[1].Event != alertRestocked {
+		t.Fatalf("Unexpected queue: %+v", queue)
+	}
+
+	retry := queue[0]
+	retry.Attempts = 1
+	retry.NextAttempt = created.Add(time.Minute)
+	if err := db.SaveWebhookDelivery(ctx, retry); err != nil {
+		t.Fatalf("Failed to save webhook delivery: %s", err)
+	}
+
+	if err := db.DeleteWebhookDelivery(ctx, queue[1].ID); err != nil {
+		t.Fatalf("Failed to delete webhook delivery: %s", err)
+	}
+
+	if err := db.SaveWebhookDelivery(ctx, queue[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error: %v, expected: %v", err, ErrNotFound)
+	}
+
+	queue, err = db.WebhookDeliveries(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get webhook deliveries: %s", err)
+	}
+
+	if diff := cmp.Diff([]WebhookDelivery{retry}, queue); diff != "" {
+		t.Errorf("Webhook deliveries do not match:\n%s", diff)
+	}
+}
@@ -0,0 +1,188 @@
+package telegram
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Bot API limits: about 30 messages per second overall and 1 message per second in a chat.
+var (
+	globalRate  = 30.0
+	globalBurst = 30.0
+	chatRate    = 1.0
+	chatBurst   = 1.0
+
+	// Idle chat buckets are dropped once there are more than this many.
+	maxChatBuckets = 1000
+)
+
+var (
+	throttledCounter  = metrics.NewCounter(`tg_throttled_sends_total{reason="limit"}`)
+	retryAfterCounter = metrics.NewCounter(`tg_throttled_sends_total{reason="retry_after"}`)
+)
+
+// bucket is a token bucket, it is refilled with rate tokens a second up to burst.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst float64, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// wait returns how long it takes until a token is available.
+func (b *bucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration(math.Ceil((1 - b.tokens) / b.rate * float64(time.Second)))
+}
+
+// limiter keeps sends within the global and per chat limits.
+// Once the Bot API answers with retry_after, sends wait until it passes.
+type limiter struct {
+	mu sync.Mutex
+
+	global *bucket
+	chats  map[int64]*bucket
+
+	// Set from retry_after, chat zero is global.
+	blocked map[int64]time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		global:  newBucket(globalRate, globalBurst, time.Now()),
+		chats:   map[int64]*bucket{},
+		blocked: map[int64]time.Time{},
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+}
+
+// delay returns how long a send to the chat has to wait and the bucket of the chat, the caller holds the lock.
+// Chat zero is for calls that are not sent to a chat, only the global limit applies.
+func (l *limiter) delay(chatID int64, now time.Time) (time.Duration, *bucket) {
+	var wait time.Duration
+	for _, id := range []int64{0, chatID} {
+		if until, ok := l.blocked[id]; ok {
+			if d := until.Sub(now); d > wait {
+				wait = d
+			} else if d <= 0 {
+				delete(l.blocked, id)
+			}
+		}
+	}
+
+	if d := l.global.wait(now); d > wait {
+		wait = d
+	}
+
+	var chat *bucket
+	if chatID != 0 {
+		chat = l.chat(chatID, now)
+		if d := chat.wait(now); d > wait {
+			wait = d
+		}
+	}
+
+	return wait, chat
+}
+
+// reserve takes a token for the chat or returns how long to wait for it.
+func (l *limiter) reserve(chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	wait, chat := l.delay(chatID, l.now())
+	if wait > 0 {
+		return wait
+	}
+
+	l.global.tokens--
+	if chat != nil {
+		chat.tokens--
+	}
+
+	return 0
+}
+
+// pending returns how long a send to the chat would wait now, no token is taken.
+func (l *limiter) pending(chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	wait, _ := l.delay(chatID, l.now())
+
+	return wait
+}
+
+func (l *limiter) chat(chatID int64, now time.Time) *bucket {
+	if b, ok := l.chats[chatID]; ok {
+		return b
+	}
+
+	if len(l.chats) >= maxChatBuckets {
+		for id, b := range l.chats {
+			if b.refill(now); b.tokens >= b.burst {
+				delete(l.chats, id)
+			}
+		}
+	}
+
+	b := newBucket(chatRate, chatBurst, now)
+	l.chats[chatID] = b
+
+	return b
+}
+
+// wait blocks until a message can be sent to the chat.
+func (l *limiter) wait(chatID int64) {
+	throttled := false
+	for {
+		d := l.reserve(chatID)
+		if d <= 0 {
+			return
+		}
+
+		if !throttled {
+			throttled = true
+			throttledCounter.Inc()
+		}
+		l.sleep(d)
+	}
+}
+
+// retryAfter holds sends to the chat back for d.
+func (l *limiter) retryAfter(chatID int64, d time.Duration) {
+	retryAfterCounter.Inc()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := l.now().Add(d)
+	if until.After(l.blocked[chatID]) {
+		l.blocked[chatID] = until
+	}
+}
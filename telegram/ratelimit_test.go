@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeLimiter returns a limiter with a clock that moves only when it sleeps.
+func fakeLimiter() (*limiter, *time.Duration) {
+	start := time.Unix(1590000000, 0)
+	var slept time.Duration
+
+	l := newLimiter()
+	l.now = func() time.Time { return start.Add(slept) }
+	l.sleep = func(d time.Duration) { slept += d }
+	l.global = newBucket(globalRate, globalBurst, start)
+
+	return l, &slept
+}
+
+func TestLimiterChat(t *testing.T) {
+	l, slept := fakeLimiter()
+
+	l.wait(-100)
+	if *slept != 0 {
+		t.Errorf("First message waited for %s", *slept)
+	}
+
+	l.wait(-100)
+	if *slept != time.Second {
+		t.Errorf("Got wait: %s, expected: 1s", *slept)
+	}
+
+	// Other chats are not held back.
+	l.wait(42)
+	if *slept != time.Second {
+		t.Errorf("Got wait: %s for another chat, expected none", *slept-time.Second)
+	}
+}
+
+func TestLimiterGlobal(t *testing.T) {
+	l, slept := fakeLimiter()
+
+	for chatID := int64(1); chatID <= int64(globalBurst); chatID++ {
+		l.wait(chatID)
+	}
+
+	if *slept != 0 {
+		t.Fatalf("Burst waited for %s", *slept)
+	}
+
+	l.wait(1000)
+	if expected := time.Duration(float64(time.Second) / globalRate); *slept < expected || *slept > expected+time.Microsecond {
+		t.Errorf("Got wait: %s, expected: %s", *slept, expected)
+	}
+}
+
+func TestLimiterRetryAfter(t *testing.T) {
+	l, slept := fakeLimiter()
+
+	l.retryAfter(-100, 7*time.Second)
+
+	l.wait(42)
+	if *slept != 0 {
+		t.Errorf("Got wait: %s for another chat, expected none", *slept)
+	}
+
+	l.wait(-100)
+	if *slept != 7*time.Second {
+		t.Errorf("Got wait: %s, expected: 7s", *slept)
+	}
+
+	// Global flood control holds every chat back.
+	l.retryAfter(0, 3*time.Second)
+
+	l.wait(43)
+	if *slept != 10*time.Second {
+		t.Errorf("Got wait: %s, expected: 10s", *slept)
+	}
+}
+
+func TestLimiterPending(t *testing.T) {
+	l, _ := fakeLimiter()
+
+	if d := l.pending(-100); d != 0 {
+		t.Errorf("Got delay: %s before the first message, expected none", d)
+	}
+
+	// Asking takes no token.
+	l.wait(-100)
+	if d := l.pending(-100); d != time.Second {
+		t.Errorf("Got delay: %s, expected: 1s", d)
+	}
+
+	l.retryAfter(42, 7*time.Second)
+	if d := l.pending(42); d != 7*time.Second {
+		t.Errorf("Got delay: %s, expected: 7s", d)
+	}
+
+	if d := l.pending(43); d != 0 {
+		t.Errorf("Got delay: %s for another chat, expected none", d)
+	}
+}
@@ -3,21 +3,32 @@ package telegram
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/cooldarkdryplace/lowstock"
 
 	"github.com/VictoriaMetrics/metrics"
 )
 
+var baseURL = "https://api.telegram.org/bot"
+
 const (
-	baseURL           = "https://api.telegram.org/bot"
-	methodSendMessage = "sendMessage"
-	methodGetUpdates  = "getUpdates"
+	methodSendMessage   = "sendMessage"
+	methodGetUpdates    = "getUpdates"
+	methodGetChatMember = "getChatMember"
+	methodGetMe         = "getMe"
+
+	methodEditMessageText     = "editMessageText"
+	methodAnswerCallbackQuery = "answerCallbackQuery"
+
+	methodSetWebhook    = "setWebhook"
+	methodDeleteWebhook = "deleteWebhook"
 
 	// Wait timeout for longpolling
 	timeout = 60
@@ -29,14 +40,30 @@ var (
 
 	msgSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="sendMessage"}`)
 	msgFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="sendMessage"}`)
+
+	memberSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="getChatMember"}`)
+	memberFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="getChatMember"}`)
+
+	meSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="getMe"}`)
+	meFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="getMe"}`)
+
+	editSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="editMessageText"}`)
+	editFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="editMessageText"}`)
+
+	answerSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="answerCallbackQuery"}`)
+	answerFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="answerCallbackQuery"}`)
 )
 
 type Telegram struct {
-	token string
+	token   string
+	limiter *limiter
+
+	// Username of the bot, commands addressed to other bots are ignored.
+	username string
 }
 
 func New(t string) *Telegram {
-	return &Telegram{token: t}
+	return &Telegram{token: t, limiter: newLimiter()}
 }
 
 type UpdatesResponse struct {
@@ -44,28 +71,76 @@ type UpdatesResponse struct {
 	Updates []Update `json:"result"`
 }
 
-func toMessengerUpdate(u Update) lowstock.MessengerUpdate {
+func toMessengerUpdate(u Update, botUsername string) lowstock.MessengerUpdate {
 	return lowstock.MessengerUpdate{
 		ID:      u.ID,
-		Command: u.Command(),
-		Text:    u.Text(),
+		Command: u.Command(botUsername),
+		Text:    u.Text(botUsername),
 		ChatID:  u.ChatID(),
 		UserID:  u.UserID(),
+
+		ChatType:     u.ChatType(),
+		LanguageCode: u.LanguageCode(),
+
+		CallbackID: u.CallbackID(),
+		MessageID:  u.MessageID(),
 	}
 }
 
-func toMessengerUpdates(tu []Update) []lowstock.MessengerUpdate {
+func toMessengerUpdates(tu []Update, botUsername string) []lowstock.MessengerUpdate {
 	updates := make([]lowstock.MessengerUpdate, 0, len(tu))
 
 	for _, upd := range tu {
-		updates = append(updates, toMessengerUpdate(upd))
+		updates = append(updates, toMessengerUpdate(upd, botUsername))
 	}
 
 	return updates
 }
 
+type MeResponse struct {
+	Ok     bool `json:"ok"`
+	Result User `json:"result"`
+}
+
+// botUsername returns the username of the bot, it is requested once.
+func (t *Telegram) botUsername() (string, error) {
+	if t.username != "" {
+		return t.username, nil
+	}
+
+	url := fmt.Sprintf("%s%s/%s", baseURL, t.token, methodGetMe)
+
+	r, err := http.Get(url)
+	if err != nil {
+		meFailureCounter.Inc()
+		return "", fmt.Errorf("failed to call API: %w", err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		meFailureCounter.Inc()
+		return "", fmt.Errorf("unexpected status code: %s", r.Status)
+	}
+
+	apiResponse := &MeResponse{}
+	if err := json.NewDecoder(r.Body).Decode(apiResponse); err != nil {
+		meFailureCounter.Inc()
+		return "", fmt.Errorf("failed to unmarshal bot user: %w", err)
+	}
+
+	meSuccessCounter.Inc()
+
+	t.username = apiResponse.Result.UserName
+	return t.username, nil
+}
+
 // Updates provide Telegram Bot updates with IDs greater than provided value.
 func (t *Telegram) Updates(lastMsgID int64) ([]lowstock.MessengerUpdate, error) {
+	username, err := t.botUsername()
+	if err != nil {
+		return nil, err
+	}
+
 	url := fmt.Sprintf("%s%s/%s?timeout=%d&offset=%d", baseURL, t.token, methodGetUpdates, timeout, lastMsgID)
 
 	apiResponse := &UpdatesResponse{}
@@ -88,12 +163,13 @@ func (t *Telegram) Updates(lastMsgID int64) ([]lowstock.MessengerUpdate, error)
 	}
 
 	updSuccessCounter.Inc()
-	return toMessengerUpdates(apiResponse.Updates), nil
+	return toMessengerUpdates(apiResponse.Updates, username), nil
 }
 
 type InlineKeyboardButton struct {
-	Text string `json:"text"`
-	URL  string `json:"url"`
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
 }
 
 type InlineKeyboardMarkup struct {
@@ -110,37 +186,98 @@ type SendMessageRequest struct {
 	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
 }
 
-func (t *Telegram) sendMessage(msg SendMessageRequest) error {
-	data, err := json.Marshal(msg)
+type EditMessageTextRequest struct {
+	ChatID                int64                 `json:"chat_id"`
+	MessageID             int64                 `json:"message_id"`
+	Text                  string                `json:"text"`
+	ParseMode             string                `json:"parse_mode"`
+	DisableWebPagePreview bool                  `json:"disable_web_page_preview"`
+	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type AnswerCallbackQueryRequest struct {
+	CallbackQueryID string `json:"callback_query_id"`
+}
+
+// ErrorResponse is returned by the Bot API for failed requests.
+type ErrorResponse struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// apiError wraps failures of flood control into lowstock.RetryAfterError.
+// Bad requests, e.g. broken HTML, and blocked bots fail again on retries, they are lowstock.ErrUndeliverable.
+func apiError(method string, resp *http.Response, body []byte) error {
+	err := fmt.Errorf("failed to call %s, status: %s, body: %s", method, resp.Status, string(body))
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %s", lowstock.ErrUndeliverable, err)
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return err
+	}
+
+	var apiResp ErrorResponse
+	if json.Unmarshal(body, &apiResp) != nil || apiResp.Parameters.RetryAfter <= 0 {
+		return err
+	}
+
+	return &lowstock.RetryAfterError{
+		RetryAfter: time.Duration(apiResp.Parameters.RetryAfter) * time.Second,
+		Err:        err,
+	}
+}
+
+// post sends the request as JSON to the Bot API method within rate limits of the chat.
+func (t *Telegram) post(method string, chatID int64, request interface{}, success, failure *metrics.Counter) error {
+	data, err := json.Marshal(request)
 	if err != nil {
-		return fmt.Errorf("failed to serialize message: %w", err)
+		return fmt.Errorf("failed to serialize request: %w", err)
 	}
 
-	apiURL := fmt.Sprintf("%s%s/%s", baseURL, t.token, methodSendMessage)
+	t.limiter.wait(chatID)
+
+	apiURL := fmt.Sprintf("%s%s/%s", baseURL, t.token, method)
 
 	resp, err := http.Post(apiURL, "application/json", bytes.NewReader(data))
 	if err != nil {
-		msgFailureCounter.Inc()
-		return fmt.Errorf("failed to send message: %w", err)
+		failure.Inc()
+		return fmt.Errorf("failed to call %s: %w", method, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		msgFailureCounter.Inc()
+		failure.Inc()
 
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return fmt.Errorf("failed to read response body: %w", err)
 		}
 
-		return fmt.Errorf("failed to send message, status: %s, body: %s", resp.Status, string(body))
+		err = apiError(method, resp, body)
+
+		var retryErr *lowstock.RetryAfterError
+		if errors.As(err, &retryErr) {
+			t.limiter.retryAfter(chatID, retryErr.RetryAfter)
+		}
+
+		return err
 	}
 
-	msgSuccessCounter.Inc()
+	success.Inc()
 
 	return nil
 }
 
+func (t *Telegram) sendMessage(msg SendMessageRequest) error {
+	return t.post(methodSendMessage, msg.ChatID, msg, msgSuccessCounter, msgFailureCounter)
+}
+
 // SendTextMessage to the chat with provided ID.
 func (t *Telegram) SendTextMessage(text string, chatID int64) error {
 	msg := SendMessageRequest{
@@ -152,6 +289,67 @@ func (t *Telegram) SendTextMessage(text string, chatID int64) error {
 	return t.sendMessage(msg)
 }
 
+func toInlineKeyboard(buttons [][]lowstock.Button) *InlineKeyboardMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+
+	keyboard := &InlineKeyboardMarkup{
+		InlineKeyboard: make([][]InlineKeyboardButton, 0, len(buttons)),
+	}
+
+	for _, row := range buttons {
+		kbRow := make([]InlineKeyboardButton, 0, len(row))
+		for _, btn := range row {
+			kbRow = append(kbRow, InlineKeyboardButton{Text: btn.Text, URL: btn.URL, CallbackData: btn.Data})
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, kbRow)
+	}
+
+	return keyboard
+}
+
+// SendMessage with inline keyboard buttons to the chat with provided ID.
+func (t *Telegram) SendMessage(m lowstock.Message, chatID int64) error {
+	msg := SendMessageRequest{
+		ChatID:                chatID,
+		Text:                  m.Text,
+		ParseMode:             "HTML",
+		ReplyMarkup:           toInlineKeyboard(m.Buttons),
+		DisableWebPagePreview: true,
+		DisableNotification:   m.Silent,
+	}
+
+	return t.sendMessage(msg)
+}
+
+// SendDelay is how long a message to the chat would wait for rate limits now.
+// The outbox skips the chat until then instead of waiting, messages to other chats go on.
+func (t *Telegram) SendDelay(chatID int64) time.Duration {
+	return t.limiter.pending(chatID)
+}
+
+// EditMessage replaces text and buttons of the message sent by the bot.
+func (t *Telegram) EditMessage(m lowstock.Message, chatID, messageID int64) error {
+	msg := EditMessageTextRequest{
+		ChatID:                chatID,
+		MessageID:             messageID,
+		Text:                  m.Text,
+		ParseMode:             "HTML",
+		ReplyMarkup:           toInlineKeyboard(m.Buttons),
+		DisableWebPagePreview: true,
+	}
+
+	return t.post(methodEditMessageText, chatID, msg, editSuccessCounter, editFailureCounter)
+}
+
+// AnswerCallback confirms the pressed button, Telegram shows a progress indicator until then.
+func (t *Telegram) AnswerCallback(callbackID string) error {
+	req := AnswerCallbackQueryRequest{CallbackQueryID: callbackID}
+
+	return t.post(methodAnswerCallbackQuery, 0, req, answerSuccessCounter, answerFailureCounter)
+}
+
 func (t *Telegram) SendLoginURL(text, uri string, chatID int64) error {
 	btn := InlineKeyboardButton{
 		Text: "Login to Etsy",
@@ -185,6 +383,8 @@ type User struct {
 	ID        int64  `json:"id"`
 	FirstName string `json:"first_name"`
 	UserName  string `json:"username"`
+	// IETF language tag of the user's client, optional.
+	LanguageCode string `json:"language_code"`
 }
 
 type Entity struct {
@@ -202,12 +402,25 @@ type Message struct {
 	From     User     `json:"from"`
 }
 
+// CallbackQuery is sent when an inline keyboard button with callback data is pressed.
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message"`
+	Data    string   `json:"data"`
+}
+
 type Update struct {
-	ID      int64   `json:"update_id"`
-	Message Message `json:"message"`
+	ID            int64          `json:"update_id"`
+	Message       Message        `json:"message"`
+	CallbackQuery *CallbackQuery `json:"callback_query"`
 }
 
 func (u Update) Type() string {
+	if u.CallbackQuery != nil {
+		return ""
+	}
+
 	if len(u.Message.Entities) == 0 {
 		return ""
 	}
@@ -215,29 +428,146 @@ func (u Update) Type() string {
 	return u.Message.Entities[0].Type
 }
 
-func extractCommand(text string) string {
-	return strings.Split(text, " ")[0]
+// extractCommand returns the command without the bot username, "/help@lowstock_bot" is "/help".
+// ok is false for commands addressed to other bots, e.g. "/help@other_bot" in a group.
+func extractCommand(text, botUsername string) (command string, ok bool) {
+	command = strings.Split(text, " ")[0]
+	if i := strings.Index(command, "@"); i >= 0 {
+		// Usernames are case-insensitive.
+		if !strings.EqualFold(command[i+1:], botUsername) {
+			return "", false
+		}
+		command = command[:i]
+	}
+
+	return command, true
 }
 
-func (u Update) Command() string {
+func (u Update) Command(botUsername string) string {
+	// Callback data of bot buttons is a command with arguments.
+	if u.CallbackQuery != nil && strings.HasPrefix(u.CallbackQuery.Data, "/") {
+		command, _ := extractCommand(u.CallbackQuery.Data, botUsername)
+		return command
+	}
+
 	if t := u.Type(); t != "bot_command" {
 		log.Println("Not a command, ignoring")
 		return ""
 	}
 
-	command := extractCommand(u.Message.Text)
+	command, ok := extractCommand(u.Message.Text, botUsername)
+	if !ok {
+		log.Println("Command for another bot, ignoring")
+	}
 
 	return command
 }
 
+// message is the message of the update, for callbacks it is the message with the pressed button.
+func (u Update) message() Message {
+	if u.CallbackQuery != nil && u.CallbackQuery.Message != nil {
+		return *u.CallbackQuery.Message
+	}
+
+	return u.Message
+}
+
 func (u Update) ChatID() int64 {
-	return u.Message.Chat.ID
+	return u.message().Chat.ID
 }
 
 func (u Update) UserID() int64 {
+	if u.CallbackQuery != nil {
+		return u.CallbackQuery.From.ID
+	}
+
 	return u.Message.From.ID
 }
 
-func (u Update) Text() string {
-	return u.Message.Text
+// Text of the message, the bot username is removed from the command.
+// For callbacks it is the button callback data.
+func (u Update) Text(botUsername string) string {
+	if u.CallbackQuery != nil {
+		return u.CallbackQuery.Data
+	}
+
+	if u.Type() != "bot_command" {
+		return u.Message.Text
+	}
+
+	command := strings.Split(u.Message.Text, " ")[0]
+
+	stripped, ok := extractCommand(command, botUsername)
+	if !ok {
+		return u.Message.Text
+	}
+
+	return stripped + strings.TrimPrefix(u.Message.Text, command)
+}
+
+func (u Update) ChatType() string {
+	return u.message().Chat.Type
+}
+
+func (u Update) LanguageCode() string {
+	if u.CallbackQuery != nil {
+		return u.CallbackQuery.From.LanguageCode
+	}
+
+	return u.Message.From.LanguageCode
+}
+
+func (u Update) CallbackID() string {
+	if u.CallbackQuery == nil {
+		return ""
+	}
+
+	return u.CallbackQuery.ID
+}
+
+// MessageID of the message with the pressed button, zero for other updates.
+func (u Update) MessageID() int64 {
+	if u.CallbackQuery == nil || u.CallbackQuery.Message == nil {
+		return 0
+	}
+
+	return u.CallbackQuery.Message.ID
+}
+
+type ChatMember struct {
+	Status string `json:"status"`
+	User   User   `json:"user"`
+}
+
+type ChatMemberResponse struct {
+	Ok     bool       `json:"ok"`
+	Result ChatMember `json:"result"`
+}
+
+// IsChatAdmin reports whether the user is the creator or an administrator of the chat.
+func (t *Telegram) IsChatAdmin(chatID, userID int64) (bool, error) {
+	url := fmt.Sprintf("%s%s/%s?chat_id=%d&user_id=%d", baseURL, t.token, methodGetChatMember, chatID, userID)
+
+	r, err := http.Get(url)
+	if err != nil {
+		memberFailureCounter.Inc()
+		return false, fmt.Errorf("failed to call API: %w", err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		memberFailureCounter.Inc()
+		return false, fmt.Errorf("unexpected status code: %s", r.Status)
+	}
+
+	apiResponse := &ChatMemberResponse{}
+	if err := json.NewDecoder(r.Body).Decode(apiResponse); err != nil {
+		memberFailureCounter.Inc()
+		return false, fmt.Errorf("failed to unmarshal chat member: %w", err)
+	}
+
+	memberSuccessCounter.Inc()
+
+	status := apiResponse.Result.Status
+	return status == "creator" || status == "administrator", nil
 }
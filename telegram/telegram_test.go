@@ -1,7 +1,13 @@
 package telegram
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/cooldarkdryplace/lowstock"
 
@@ -10,11 +16,12 @@ import (
 
 func TestToMessengerUpdate(t *testing.T) {
 	var (
-		id      int64 = 42
-		chatID  int64 = 13
-		userID  int64 = 2546
-		command       = "/test"
-		text          = "/test"
+		id       int64 = 42
+		chatID   int64 = 13
+		userID   int64 = 2546
+		command        = "/test"
+		text           = "/test"
+		language       = "de-AT"
 	)
 
 	expectedMsgUpd := lowstock.MessengerUpdate{
@@ -23,6 +30,8 @@ func TestToMessengerUpdate(t *testing.T) {
 		UserID:  userID,
 		Command: command,
 		Text:    text,
+
+		LanguageCode: language,
 	}
 
 	input := Update{
@@ -35,16 +44,261 @@ func TestToMessengerUpdate(t *testing.T) {
 				ID: chatID,
 			},
 			From: User{
-				ID: userID,
+				ID:           userID,
+				LanguageCode: language,
 			},
 			Text: text,
 		},
 	}
 
-	actualMsgUpd := toMessengerUpdate(input)
+	actualMsgUpd := toMessengerUpdate(input, "lowstock_bot")
 
 	if diff := cmp.Diff(expectedMsgUpd, actualMsgUpd); diff != "" {
 		t.Errorf("Updates do not match:\n%s", diff)
 	}
 
 }
+
+func TestToInlineKeyboard(t *testing.T) {
+	buttons := [][]lowstock.Button{
+		[]lowstock.Button{
+			lowstock.Button{Text: "Open listing", URL: "https://example.com/1"},
+			lowstock.Button{Text: "Edit", URL: "https://example.com/2"},
+		},
+	}
+
+	expected := &InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			[]InlineKeyboardButton{
+				InlineKeyboardButton{Text: "Open listing", URL: "https://example.com/1"},
+				InlineKeyboardButton{Text: "Edit", URL: "https://example.com/2"},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(expected, toInlineKeyboard(buttons)); diff != "" {
+		t.Errorf("Keyboards do not match:\n%s", diff)
+	}
+
+	if keyboard := toInlineKeyboard(nil); keyboard != nil {
+		t.Errorf("Got keyboard: %+v, expected none", keyboard)
+	}
+}
+
+func TestCommandWithBotUsername(t *testing.T) {
+	u := Update{
+		Message: Message{
+			Entities: []Entity{Entity{Type: "bot_command"}},
+			Chat:     Chat{ID: -100, Type: "group"},
+			Text:     "/pin@lowstock_bot 76279961",
+		},
+	}
+
+	if command := u.Command("Lowstock_Bot"); command != "/pin" {
+		t.Errorf("Got command: %q, expected: %q", command, "/pin")
+	}
+
+	if text := u.Text("Lowstock_Bot"); text != "/pin 76279961" {
+		t.Errorf("Got text: %q, expected: %q", text, "/pin 76279961")
+	}
+
+	if chatType := toMessengerUpdate(u, "Lowstock_Bot").ChatType; chatType != "group" {
+		t.Errorf("Got chat type: %q, expected: %q", chatType, "group")
+	}
+
+	// Commands addressed to other bots in the group are ignored.
+	u.Message.Text = "/pin@other_bot 76279961"
+	if command := u.Command("Lowstock_Bot"); command != "" {
+		t.Errorf("Got command: %q, expected none", command)
+	}
+
+	if text := u.Text("Lowstock_Bot"); text != u.Message.Text {
+		t.Errorf("Got text: %q, expected: %q", text, u.Message.Text)
+	}
+}
+
+func TestBotUsername(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/bottoken/getMe" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"first_name":"Lowstock","username":"lowstock_bot"}}`)
+	}))
+	defer server.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = server.URL + "/bot"
+
+	tg := New("token")
+	for i := 0; i < 2; i++ {
+		username, err := tg.botUsername()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if username != "lowstock_bot" {
+			t.Errorf("Got username: %q, expected: %q", username, "lowstock_bot")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Got %d getMe calls, expected: 1", calls)
+	}
+}
+
+func TestCallbackQueryToMessengerUpdate(t *testing.T) {
+	input := Update{
+		ID: 43,
+		CallbackQuery: &CallbackQuery{
+			ID:   "cb-1",
+			From: User{ID: 7, LanguageCode: "uk"},
+			Message: &Message{
+				ID:   99,
+				Chat: Chat{ID: -100, Type: "supergroup"},
+				Text: "Low and sold-out listings",
+			},
+			Data: "/stock 2",
+		},
+	}
+
+	expected := lowstock.MessengerUpdate{
+		ID:      43,
+		ChatID:  -100,
+		UserID:  7,
+		Command: "/stock",
+		Text:    "/stock 2",
+
+		ChatType:     "supergroup",
+		LanguageCode: "uk",
+
+		CallbackID: "cb-1",
+		MessageID:  99,
+	}
+
+	if diff := cmp.Diff(expected, toMessengerUpdate(input, "lowstock_bot")); diff != "" {
+		t.Errorf("Updates do not match:\n%s", diff)
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottoken/editMessageText" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+
+		var req EditMessageTextRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %s", err)
+		}
+
+		expected := EditMessageTextRequest{
+			ChatID:                -100,
+			MessageID:             99,
+			Text:                  "page 2",
+			ParseMode:             "HTML",
+			DisableWebPagePreview: true,
+			ReplyMarkup: &InlineKeyboardMarkup{
+				InlineKeyboard: [][]InlineKeyboardButton{
+					[]InlineKeyboardButton{InlineKeyboardButton{Text: "« 1", CallbackData: "/stock 1"}},
+				},
+			},
+		}
+
+		if diff := cmp.Diff(expected, req); diff != "" {
+			t.Errorf("Requests do not match:\n%s", diff)
+		}
+
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = server.URL + "/bot"
+
+	msg := lowstock.Message{
+		Text:    "page 2",
+		Buttons: [][]lowstock.Button{[]lowstock.Button{lowstock.Button{Text: "« 1", Data: "/stock 1"}}},
+	}
+
+	if err := New("token").EditMessage(msg, -100, 99); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestIsChatAdmin(t *testing.T) {
+	statuses := map[string]bool{
+		"creator":       true,
+		"administrator": true,
+		"member":        false,
+		"left":          false,
+	}
+
+	for status, expected := range statuses {
+		t.Run(status, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/bottoken/getChatMember" {
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+
+				if q := r.URL.Query(); q.Get("chat_id") != "-100" || q.Get("user_id") != "7" {
+					t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+				}
+
+				fmt.Fprintf(w, `{"ok":true,"result":{"status":%q,"user":{"id":7}}}`, status)
+			}))
+			defer server.Close()
+
+			defer func(u string) { baseURL = u }(baseURL)
+			baseURL = server.URL + "/bot"
+
+			admin, err := New("token").IsChatAdmin(-100, 7)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if admin != expected {
+				t.Errorf("Got admin: %t, expected: %t", admin, expected)
+			}
+		})
+	}
+}
+
+func TestSendMessageRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`)
+	}))
+	defer server.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = server.URL + "/bot"
+
+	err := New("token").SendMessage(lowstock.Message{Text: "Sold out"}, -100)
+
+	var retryErr *lowstock.RetryAfterError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("Got error: %v, expected RetryAfterError", err)
+	}
+
+	if retryErr.RetryAfter != 7*time.Second {
+		t.Errorf("Got retry after: %s, expected: 7s", retryErr.RetryAfter)
+	}
+}
+
+func TestSendMessageUndeliverable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`)
+	}))
+	defer server.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = server.URL + "/bot"
+
+	if err := New("token").SendMessage(lowstock.Message{Text: "Sold out"}, 42); !errors.Is(err, lowstock.ErrUndeliverable) {
+		t.Errorf("Got error: %v, expected: %v", err, lowstock.ErrUndeliverable)
+	}
+}
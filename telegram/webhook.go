@@ -0,0 +1,132 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+var (
+	setWebhookSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="setWebhook"}`)
+	setWebhookFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="setWebhook"}`)
+
+	deleteWebhookSuccessCounter = metrics.NewCounter(`tg_api_calls{status="success", method="deleteWebhook"}`)
+	deleteWebhookFailureCounter = metrics.NewCounter(`tg_api_calls{status="failure", method="deleteWebhook"}`)
+
+	webhookUpdatesCounter  = metrics.NewCounter(`tg_webhook_requests_total{status="accepted"}`)
+	webhookRejectedCounter = metrics.NewCounter(`tg_webhook_requests_total{status="rejected"}`)
+)
+
+// UpdateHandler processes an update pushed to the webhook, e.g. LowStock.HandleMessengerUpdate.
+type UpdateHandler func(ctx context.Context, upd lowstock.MessengerUpdate)
+
+type SetWebhookRequest struct {
+	URL            string   `json:"url"`
+	SecretToken    string   `json:"secret_token"`
+	MaxConnections int      `json:"max_connections"`
+	AllowedUpdates []string `json:"allowed_updates"`
+}
+
+type DeleteWebhookRequest struct {
+	DropPendingUpdates bool `json:"drop_pending_updates"`
+}
+
+// SetWebhook asks Telegram to push updates to the URL with the secret in the header.
+// Updates are pushed one at a time, so they are handled in order like with long polling.
+func (t *Telegram) SetWebhook(url, secret string) error {
+	req := SetWebhookRequest{
+		URL:            url,
+		SecretToken:    secret,
+		MaxConnections: 1,
+		AllowedUpdates: []string{"message", "callback_query"},
+	}
+
+	return t.post(methodSetWebhook, 0, req, setWebhookSuccessCounter, setWebhookFailureCounter)
+}
+
+// DeleteWebhook switches back to long polling, pending updates are kept.
+func (t *Telegram) DeleteWebhook() error {
+	return t.post(methodDeleteWebhook, 0, DeleteWebhookRequest{}, deleteWebhookSuccessCounter, deleteWebhookFailureCounter)
+}
+
+// WebhookHandler accepts update POSTs from Telegram that carry the secret.
+// Updates are acknowledged once handled, failed commands are logged by the handler and not retried.
+// Commands addressed to bots other than botUsername are ignored.
+func WebhookHandler(secret, botUsername string, handle UpdateHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			webhookRejectedCounter.Inc()
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(secretHeader)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			webhookRejectedCounter.Inc()
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		var upd Update
+		if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+			webhookRejectedCounter.Inc()
+			http.Error(w, "failed to unmarshal update", http.StatusBadRequest)
+			return
+		}
+
+		webhookUpdatesCounter.Inc()
+		handle(r.Context(), toMessengerUpdate(upd, botUsername))
+	})
+}
+
+// ServeWebhook sets the webhook and serves updates on addr until ctx is done.
+// Telegram only pushes to HTTPS URLs, addr is expected behind a TLS terminating proxy.
+// The webhook is deleted on return, so the bot can be started with long polling again.
+func (t *Telegram) ServeWebhook(ctx context.Context, addr, url, secret string, handle UpdateHandler) error {
+	if secret == "" {
+		return errors.New("webhook secret is empty")
+	}
+
+	username, err := t.botUsername()
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: addr, Handler: WebhookHandler(secret, username, handle)}
+
+	if err := t.SetWebhook(url, secret); err != nil {
+		return err
+	}
+	defer func() {
+		if err := t.DeleteWebhook(); err != nil {
+			log.Printf("Failed to delete webhook: %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		log.Println("Stopping webhook server...")
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Printf("Failed to stop webhook server: %s", err)
+		}
+	}()
+
+	log.Printf("Serving Telegram webhook on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cooldarkdryplace/lowstock"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	body := `{"update_id":42,"message":{"text":"/status","entities":[{"type":"bot_command"}],"chat":{"id":-100,"type":"group"},"from":{"id":7,"language_code":"de"}}}`
+
+	tests := []struct {
+		name     string
+		method   string
+		secret   string
+		body     string
+		status   int
+		expected []lowstock.MessengerUpdate
+	}{
+		{
+			name:   "accepted",
+			method: http.MethodPost,
+			secret: "s3cret",
+			body:   body,
+			status: http.StatusOK,
+			expected: []lowstock.MessengerUpdate{
+				lowstock.MessengerUpdate{ID: 42, Command: "/status", Text: "/status", ChatID: -100, UserID: 7, ChatType: "group", LanguageCode: "de"},
+			},
+		},
+		{
+			name:   "wrong secret",
+			method: http.MethodPost,
+			secret: "guess",
+			body:   body,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "no secret",
+			method: http.MethodPost,
+			body:   body,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "not a POST",
+			method: http.MethodGet,
+			secret: "s3cret",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "bad update",
+			method: http.MethodPost,
+			secret: "s3cret",
+			body:   `{"update_id":`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled []lowstock.MessengerUpdate
+			handler := WebhookHandler("s3cret", "lowstock_bot", func(ctx context.Context, upd lowstock.MessengerUpdate) {
+				handled = append(handled, upd)
+			})
+
+			r := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				r.Header.Set(secretHeader, tt.secret)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("Got status: %d, expected: %d", w.Code, tt.status)
+			}
+
+			if diff := cmp.Diff(tt.expected, handled); diff != "" {
+				t.Errorf("Handled updates do not match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetWebhook(t *testing.T) {
+	var calls []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		if r.URL.Path == "/bottoken/setWebhook" {
+			var req SetWebhookRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Failed to decode request: %s", err)
+			}
+
+			expected := SetWebhookRequest{
+				URL:            "https://bot.example.com/telegram",
+				SecretToken:    "s3cret",
+				MaxConnections: 1,
+				AllowedUpdates: []string{"message", "callback_query"},
+			}
+
+			if diff := cmp.Diff(expected, req); diff != "" {
+				t.Errorf("Requests do not match:\n%s", diff)
+			}
+		}
+
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}))
+	defer server.Close()
+
+	defer func(u string) { baseURL = u }(baseURL)
+	baseURL = server.URL + "/bot"
+
+	tg := New("token")
+
+	if err := tg.SetWebhook("https://bot.example.com/telegram", "s3cret"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := tg.DeleteWebhook(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"/bottoken/setWebhook", "/bottoken/deleteWebhook"}, calls); diff != "" {
+		t.Errorf("Calls do not match:\n%s", diff)
+	}
+}